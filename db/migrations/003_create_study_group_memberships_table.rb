@@ -0,0 +1,73 @@
+Sequel.migration do
+  up do
+    puts "creating study_group_memberships table"
+    create_table(:study_group_memberships, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :user_id,        :users,        :null=>false, :key=>[:id], :on_delete=>:cascade
+      foreign_key :study_group_id, :study_groups, :null=>false, :key=>[:id], :on_delete=>:cascade
+      String      :role,           :size=>20,     :null=>false, :default=>"member"
+      String      :status,         :size=>20,     :null=>false, :default=>"waitlisted"
+      DateTime    :joined_on,      :null=>false
+
+      index [:user_id, :study_group_id], :name=>:study_group_memberships_user_id_study_group_id_key, :unique=>true
+      index [:study_group_id, :status]
+    end
+
+    puts "copying owners, members and waitlists into study_group_memberships"
+    run <<-SQL
+      INSERT INTO study_group_memberships (user_id, study_group_id, role, status, joined_on)
+      SELECT user_id, id, 'owner', 'active', created_on FROM study_groups;
+
+      INSERT INTO study_group_memberships (user_id, study_group_id, role, status, joined_on)
+      SELECT DISTINCT m.user_id::int, sg.id, 'member', 'active', sg.updated_on
+      FROM study_groups sg, regexp_split_to_table(sg.members, ',') AS m(user_id)
+      WHERE m.user_id <> ''
+      ON CONFLICT DO NOTHING;
+
+      INSERT INTO study_group_memberships (user_id, study_group_id, role, status, joined_on)
+      SELECT DISTINCT w.user_id::int, sg.id, 'member', 'waitlisted', sg.updated_on
+      FROM study_groups sg, regexp_split_to_table(sg.waitlist, ',') AS w(user_id)
+      WHERE w.user_id <> ''
+      ON CONFLICT DO NOTHING;
+    SQL
+
+    alter_table(:study_groups) do
+      drop_column :members
+      drop_column :waitlist
+    end
+
+    alter_table(:users) do
+      drop_column :study_groups
+      drop_column :waitlists
+    end
+  end
+
+  down do
+    alter_table(:users) do
+      add_column :study_groups, String, :size=>255
+      add_column :waitlists,    String, :size=>255
+    end
+
+    alter_table(:study_groups) do
+      add_column :members,  String, :size=>255
+      add_column :waitlist, String, :size=>255
+    end
+
+    run <<-SQL
+      UPDATE study_groups sg SET
+        members  = (SELECT string_agg(user_id::text, ',') FROM study_group_memberships
+                    WHERE study_group_id = sg.id AND role <> 'owner' AND status = 'active'),
+        waitlist = (SELECT string_agg(user_id::text, ',') FROM study_group_memberships
+                    WHERE study_group_id = sg.id AND status = 'waitlisted');
+
+      UPDATE users u SET
+        study_groups = (SELECT string_agg(study_group_id::text, ',') FROM study_group_memberships
+                        WHERE user_id = u.id AND role <> 'owner' AND status = 'active'),
+        waitlists    = (SELECT string_agg(study_group_id::text, ',') FROM study_group_memberships
+                        WHERE user_id = u.id AND status = 'waitlisted');
+    SQL
+
+    puts "dropping study_group_memberships table"
+    drop_table(:study_group_memberships)
+  end
+end
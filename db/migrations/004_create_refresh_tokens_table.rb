@@ -0,0 +1,23 @@
+Sequel.migration do
+  up do
+    puts "creating refresh_tokens table"
+    create_table(:refresh_tokens, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :user_id,    :users,    :null=>false, :key=>[:id], :on_delete=>:cascade
+      String      :session_id, :size=>32, :null=>false
+      String      :token_hash, :size=>64, :null=>false
+      DateTime    :expires_on, :null=>false
+      DateTime    :revoked_on
+      DateTime    :created_on, :null=>false
+
+      index [:token_hash], :name=>:refresh_tokens_token_hash_key, :unique=>true
+      index [:session_id]
+      index [:user_id]
+    end
+  end
+
+  down do
+    puts "dropping refresh_tokens table"
+    drop_table(:refresh_tokens)
+  end
+end
@@ -0,0 +1,21 @@
+Sequel.migration do
+  up do
+    puts "creating password_reset_tokens table"
+    create_table(:password_reset_tokens, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :user_id,    :users,    :null=>false, :key=>[:id], :on_delete=>:cascade
+      String      :token_hash, :size=>64, :null=>false
+      DateTime    :expires_on, :null=>false
+      DateTime    :used_on
+      DateTime    :created_on, :null=>false
+
+      index [:token_hash], :name=>:password_reset_tokens_token_hash_key, :unique=>true
+      index [:user_id]
+    end
+  end
+
+  down do
+    puts "dropping password_reset_tokens table"
+    drop_table(:password_reset_tokens)
+  end
+end
@@ -0,0 +1,19 @@
+Sequel.migration do
+  up do
+    puts "adding email verification columns to users table"
+    alter_table(:users) do
+      add_column :email_verified_on,    DateTime
+      add_column :verification_sent_on, DateTime
+    end
+
+    # accounts created before verification existed are trusted
+    run "UPDATE users SET email_verified_on = created_on"
+  end
+
+  down do
+    alter_table(:users) do
+      drop_column :email_verified_on
+      drop_column :verification_sent_on
+    end
+  end
+end
@@ -0,0 +1,24 @@
+Sequel.migration do
+  up do
+    puts "creating email_outbox table"
+    create_table(:email_outbox) do
+      primary_key :id
+      String      :recipient,       :size=>60, :null=>false
+      String      :subject,         :size=>140, :null=>false
+      String      :html,            :text=>true, :null=>false
+      Integer     :attempts,        :null=>false, :default=>0
+      DateTime    :next_attempt_on, :null=>false
+      DateTime    :sent_on
+      DateTime    :failed_on
+      String      :last_error,      :text=>true
+      DateTime    :created_on,      :null=>false
+
+      index [:next_attempt_on], :where=>{:sent_on=>nil, :failed_on=>nil}
+    end
+  end
+
+  down do
+    puts "dropping email_outbox table"
+    drop_table(:email_outbox)
+  end
+end
@@ -0,0 +1,29 @@
+Sequel.migration do
+  up do
+    puts "adding admission_policy to study_groups table"
+    alter_table(:study_groups) do
+      add_column :admission_policy, String, :size=>20, :null=>false, :default=>"manual"
+    end
+
+    # waitlisted users no longer hold a spot, only members do
+    run <<-SQL
+      UPDATE study_groups sg SET available_spots = GREATEST(0, sg.members_limit - (
+        SELECT count(*) FROM study_group_memberships m
+        WHERE m.study_group_id = sg.id AND m.status = 'active' AND m.role <> 'owner'
+      ))
+    SQL
+  end
+
+  down do
+    run <<-SQL
+      UPDATE study_groups sg SET available_spots = GREATEST(0, sg.members_limit - (
+        SELECT count(*) FROM study_group_memberships m
+        WHERE m.study_group_id = sg.id AND m.role <> 'owner'
+      ))
+    SQL
+
+    alter_table(:study_groups) do
+      drop_column :admission_policy
+    end
+  end
+end
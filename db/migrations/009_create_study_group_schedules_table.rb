@@ -0,0 +1,41 @@
+Sequel.migration do
+  up do
+    puts "creating study_group_schedules table"
+    create_table(:study_group_schedules, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :study_group_id,     :study_groups, :null=>false, :key=>[:id], :on_delete=>:cascade
+      DateTime    :starts_on,          :null=>false
+      Integer     :duration_minutes,   :null=>false, :default=>60
+      String      :timezone,           :size=>64, :null=>false, :default=>"UTC"
+      String      :rrule,              :size=>255
+      column      :exdates,            "date[]", :null=>false, :default=>Sequel.lit("'{}'")
+      DateTime    :materialized_until, :null=>false
+      DateTime    :created_on,         :null=>false
+      DateTime    :updated_on,         :null=>false
+
+      index [:study_group_id], :name=>:study_group_schedules_study_group_id_key, :unique=>true
+      index [:materialized_until]
+    end
+
+    # occurrences are expanded from the schedules up to a year ahead so study
+    # groups can be searched by the dates they meet on
+    puts "creating study_group_occurrences table"
+    create_table(:study_group_occurrences, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :study_group_id, :study_groups, :null=>false, :key=>[:id], :on_delete=>:cascade
+      DateTime    :starts_on,      :null=>false
+      Date        :local_date,     :null=>false
+
+      index [:study_group_id, :starts_on]
+      index [:local_date]
+    end
+  end
+
+  down do
+    puts "dropping study_group_occurrences table"
+    drop_table(:study_group_occurrences)
+
+    puts "dropping study_group_schedules table"
+    drop_table(:study_group_schedules)
+  end
+end
@@ -0,0 +1,16 @@
+Sequel.migration do
+  up do
+    puts "adding calendar_token to users table"
+    alter_table(:users) do
+      add_column :calendar_token, String, :size=>64
+      add_index  :calendar_token, :name=>:users_calendar_token_key, :unique=>true
+    end
+  end
+
+  down do
+    alter_table(:users) do
+      drop_index  :calendar_token, :name=>:users_calendar_token_key
+      drop_column :calendar_token
+    end
+  end
+end
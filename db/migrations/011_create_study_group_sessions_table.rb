@@ -0,0 +1,38 @@
+Sequel.migration do
+  up do
+    puts "creating study_group_sessions table"
+    create_table(:study_group_sessions, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :study_group_id,          :study_groups, :null=>false, :key=>[:id], :on_delete=>:cascade
+      DateTime    :starts_on,               :null=>false
+      DateTime    :ends_on,                 :null=>false
+      String      :location,                :size=>140
+      String      :status,                  :size=>20, :null=>false, :default=>"scheduled"
+      String      :checkin_code_hash,       :size=>64
+      DateTime    :checkin_code_expires_on
+      DateTime    :created_on,              :null=>false
+      DateTime    :updated_on,              :null=>false
+
+      index [:study_group_id, :starts_on]
+    end
+
+    puts "creating session_attendance table"
+    create_table(:session_attendance, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :session_id,    :study_group_sessions, :null=>false, :key=>[:id], :on_delete=>:cascade
+      foreign_key :user_id,       :users,                :null=>false, :key=>[:id], :on_delete=>:cascade
+      DateTime    :checked_in_on, :null=>false
+
+      index [:session_id, :user_id], :name=>:session_attendance_session_id_user_id_key, :unique=>true
+      index [:user_id]
+    end
+  end
+
+  down do
+    puts "dropping session_attendance table"
+    drop_table(:session_attendance)
+
+    puts "dropping study_group_sessions table"
+    drop_table(:study_group_sessions)
+  end
+end
@@ -0,0 +1,40 @@
+Sequel.migration do
+  up do
+    puts "creating threads table"
+    create_table(:threads, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :study_group_id,  :study_groups, :null=>false, :key=>[:id], :on_delete=>:cascade
+      foreign_key :user_id,         :users,        :key=>[:id], :on_delete=>:set_null
+      String      :title,           :size=>140, :null=>false
+      TrueClass   :locked,          :null=>false, :default=>false
+      DateTime    :last_message_on, :null=>false
+      DateTime    :deleted_on
+      DateTime    :created_on,      :null=>false
+      DateTime    :updated_on,      :null=>false
+
+      index [:study_group_id, :last_message_on], :where=>{:deleted_on=>nil}
+    end
+
+    puts "creating messages table"
+    create_table(:messages, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :thread_id,  :threads, :null=>false, :key=>[:id], :on_delete=>:cascade
+      foreign_key :user_id,    :users,   :key=>[:id], :on_delete=>:set_null
+      String      :body,       :size=>2000, :null=>false
+      DateTime    :edited_on
+      DateTime    :deleted_on
+      foreign_key :deleted_by, :users,   :key=>[:id], :on_delete=>:set_null
+      DateTime    :created_on, :null=>false
+
+      index [:thread_id, :id]
+    end
+  end
+
+  down do
+    puts "dropping messages table"
+    drop_table(:messages)
+
+    puts "dropping threads table"
+    drop_table(:threads)
+  end
+end
@@ -0,0 +1,22 @@
+Sequel.migration do
+  up do
+    puts "creating notifications table"
+    create_table(:notifications, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :user_id,        :users,        :null=>false, :key=>[:id], :on_delete=>:cascade
+      String      :type,           :size=>40, :null=>false
+      foreign_key :study_group_id, :study_groups, :key=>[:id], :on_delete=>:set_null
+      String      :text,           :size=>255, :null=>false
+      DateTime    :read_on
+      DateTime    :created_on,     :null=>false
+
+      index [:user_id, :id]
+      index [:user_id], :where=>{:read_on=>nil}
+    end
+  end
+
+  down do
+    puts "dropping notifications table"
+    drop_table(:notifications)
+  end
+end
@@ -0,0 +1,20 @@
+Sequel.migration do
+  up do
+    # users without a row get the default settings
+    puts "creating notification_settings table"
+    create_table(:notification_settings, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :user_id,          :users, :null=>false, :key=>[:id], :on_delete=>:cascade
+      String      :digest_frequency, :size=>10, :null=>false, :default=>"weekly"
+      column      :deliveries,       :jsonb, :null=>false, :default=>Sequel.lit("'{}'")
+      DateTime    :updated_on,       :null=>false
+
+      index [:user_id], :name=>:notification_settings_user_id_key, :unique=>true
+    end
+  end
+
+  down do
+    puts "dropping notification_settings table"
+    drop_table(:notification_settings)
+  end
+end
@@ -0,0 +1,14 @@
+Sequel.migration do
+  up do
+    puts "adding last_digest_sent_on to notification_settings table"
+    alter_table(:notification_settings) do
+      add_column :last_digest_sent_on, DateTime
+    end
+  end
+
+  down do
+    alter_table(:notification_settings) do
+      drop_column :last_digest_sent_on
+    end
+  end
+end
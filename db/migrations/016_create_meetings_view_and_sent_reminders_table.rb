@@ -0,0 +1,58 @@
+Sequel.migration do
+  up do
+    puts "adding reminder_hours to notification_settings table"
+    alter_table(:notification_settings) do
+      add_column :reminder_hours, Integer, :null=>false, :default=>24
+    end
+
+    # every upcoming meeting of every study group, whether it's a session, an
+    # occurrence of its schedule or its meeting date. Occurrences whose
+    # session was cancelled are left out, and a session at the same time as
+    # an occurrence only shows once.
+    puts "creating meetings view"
+    run <<-SQL
+      CREATE VIEW meetings AS
+      SELECT DISTINCT ON (m.study_group_id, m.starts_on)
+        m.study_group_id, m.starts_on, coalesce(m.location, sg.location) AS location
+      FROM (
+        SELECT study_group_id, starts_on, location FROM study_group_sessions
+        WHERE status = 'scheduled'
+        UNION ALL
+        SELECT study_group_id, starts_on, NULL FROM study_group_occurrences o
+        WHERE NOT EXISTS (
+          SELECT 1 FROM study_group_sessions s
+          WHERE s.study_group_id = o.study_group_id AND s.starts_on = o.starts_on AND s.status = 'cancelled'
+        )
+        UNION ALL
+        SELECT id, meeting_date, NULL FROM study_groups
+        WHERE meeting_date IS NOT NULL
+      ) m
+      JOIN study_groups sg ON sg.id = m.study_group_id
+      ORDER BY m.study_group_id, m.starts_on, m.location NULLS LAST
+    SQL
+
+    puts "creating sent_reminders table"
+    create_table(:sent_reminders, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :user_id,        :users,        :null=>false, :key=>[:id], :on_delete=>:cascade
+      foreign_key :study_group_id, :study_groups, :null=>false, :key=>[:id], :on_delete=>:cascade
+      DateTime    :starts_on,      :null=>false
+      DateTime    :sent_on,        :null=>false
+
+      index [:user_id, :study_group_id, :starts_on], :name=>:sent_reminders_meeting_key, :unique=>true
+      index [:starts_on]
+    end
+  end
+
+  down do
+    puts "dropping sent_reminders table"
+    drop_table(:sent_reminders)
+
+    puts "dropping meetings view"
+    run "DROP VIEW meetings"
+
+    alter_table(:notification_settings) do
+      drop_column :reminder_hours
+    end
+  end
+end
@@ -0,0 +1,24 @@
+Sequel.migration do
+  up do
+    puts "creating study_group_invites table"
+    create_table(:study_group_invites, :ignore_index_errors=>true) do
+      primary_key :id
+      foreign_key :study_group_id, :study_groups, :null=>false, :key=>[:id], :on_delete=>:cascade
+      foreign_key :created_by,     :users,        :key=>[:id], :on_delete=>:set_null
+      String      :code,           :size=>16, :null=>false
+      Integer     :max_uses
+      Integer     :uses,           :null=>false, :default=>0
+      DateTime    :expires_on,     :null=>false
+      DateTime    :revoked_on
+      DateTime    :created_on,     :null=>false
+
+      index [:code], :name=>:study_group_invites_code_key, :unique=>true
+      index [:study_group_id]
+    end
+  end
+
+  down do
+    puts "dropping study_group_invites table"
+    drop_table(:study_group_invites)
+  end
+end
@@ -0,0 +1,14 @@
+Sequel.migration do
+  up do
+    puts "adding visibility to study_groups table"
+    alter_table(:study_groups) do
+      add_column :visibility, String, :size=>10, :null=>false, :default=>"public"
+    end
+  end
+
+  down do
+    alter_table(:study_groups) do
+      drop_column :visibility
+    end
+  end
+end
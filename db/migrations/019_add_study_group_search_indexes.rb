@@ -0,0 +1,56 @@
+Sequel.migration do
+  up do
+    puts "enabling pg_trgm"
+    run "CREATE EXTENSION IF NOT EXISTS pg_trgm"
+
+    # the search document and text are built by functions so the expression
+    # indexes and the search queries are sure to match
+    puts "creating study group search functions"
+    run <<-SQL
+      CREATE FUNCTION study_group_document(name text, description text, location text, course text)
+      RETURNS tsvector LANGUAGE sql IMMUTABLE AS $$
+        SELECT
+          setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+          setweight(to_tsvector('simple', coalesce(nullif(course, '')::json ->> 'code', '')), 'A') ||
+          setweight(to_tsvector('english', coalesce(nullif(course, '')::json ->> 'name', '')), 'B') ||
+          setweight(to_tsvector('english', coalesce(description, '')), 'C') ||
+          setweight(to_tsvector('english', coalesce(location, '')), 'D')
+      $$
+    SQL
+
+    run <<-SQL
+      CREATE FUNCTION study_group_search_text(name text, location text, course text)
+      RETURNS text LANGUAGE sql IMMUTABLE AS $$
+        SELECT
+          coalesce(name, '') || ' ' ||
+          coalesce(location, '') || ' ' ||
+          coalesce(nullif(course, '')::json ->> 'code', '') || ' ' ||
+          coalesce(nullif(course, '')::json ->> 'name', '')
+      $$
+    SQL
+
+    puts "creating study group search indexes"
+    run <<-SQL
+      CREATE INDEX study_groups_document_index ON study_groups
+      USING gin (study_group_document(name, description, location, course::text))
+    SQL
+
+    run <<-SQL
+      CREATE INDEX study_groups_search_text_index ON study_groups
+      USING gin (study_group_search_text(name, location, course::text) gin_trgm_ops)
+    SQL
+
+    run "CREATE INDEX study_groups_name_trgm_index ON study_groups USING gin (name gin_trgm_ops)"
+    run "CREATE INDEX study_groups_location_trgm_index ON study_groups USING gin (location gin_trgm_ops)"
+  end
+
+  down do
+    run "DROP INDEX study_groups_location_trgm_index"
+    run "DROP INDEX study_groups_name_trgm_index"
+    run "DROP INDEX study_groups_search_text_index"
+    run "DROP INDEX study_groups_document_index"
+
+    run "DROP FUNCTION study_group_search_text(text, text, text)"
+    run "DROP FUNCTION study_group_document(text, text, text, text)"
+  end
+end
@@ -0,0 +1,16 @@
+Sequel.migration do
+  up do
+    # the keyset pages of the study group search seek on these, ties broken
+    # by id
+    puts "creating study group sort indexes"
+    run "CREATE INDEX study_groups_created_on_index ON study_groups (created_on DESC, id DESC)"
+    run "CREATE INDEX study_groups_available_spots_index ON study_groups (available_spots DESC, id DESC)"
+    run "CREATE INDEX study_groups_meeting_date_index ON study_groups (COALESCE(meeting_date, 'infinity'), id)"
+  end
+
+  down do
+    run "DROP INDEX study_groups_meeting_date_index"
+    run "DROP INDEX study_groups_available_spots_index"
+    run "DROP INDEX study_groups_created_on_index"
+  end
+end
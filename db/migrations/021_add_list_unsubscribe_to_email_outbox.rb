@@ -0,0 +1,14 @@
+Sequel.migration do
+  up do
+    puts "adding list_unsubscribe to email_outbox table"
+    alter_table(:email_outbox) do
+      add_column :list_unsubscribe, String, :text=>true
+    end
+  end
+
+  down do
+    alter_table(:email_outbox) do
+      drop_column :list_unsubscribe
+    end
+  end
+end
@@ -0,0 +1,12 @@
+Sequel.migration do
+  up do
+    # the meeting sort goes by the next meeting in the meetings view now, so
+    # nothing sorts by the meeting date alone
+    puts "dropping study_groups_meeting_date_index"
+    run "DROP INDEX study_groups_meeting_date_index"
+  end
+
+  down do
+    run "CREATE INDEX study_groups_meeting_date_index ON study_groups (COALESCE(meeting_date, 'infinity'), id)"
+  end
+end
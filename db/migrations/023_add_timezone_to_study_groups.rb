@@ -0,0 +1,60 @@
+Sequel.migration do
+  up do
+    # meeting_date is wall clock time in the study group's time zone
+    puts "adding timezone to study_groups table"
+    alter_table(:study_groups) do
+      add_column :timezone, String, :size=>64, :null=>false, :default=>"UTC"
+    end
+
+    # meetings are in UTC, like sessions and occurrences, so meeting dates
+    # are converted from their study group's time zone
+    puts "updating meetings view"
+    run <<-SQL
+      CREATE OR REPLACE VIEW meetings AS
+      SELECT DISTINCT ON (m.study_group_id, m.starts_on)
+        m.study_group_id, m.starts_on, coalesce(m.location, sg.location) AS location
+      FROM (
+        SELECT study_group_id, starts_on, location FROM study_group_sessions
+        WHERE status = 'scheduled'
+        UNION ALL
+        SELECT study_group_id, starts_on, NULL FROM study_group_occurrences o
+        WHERE NOT EXISTS (
+          SELECT 1 FROM study_group_sessions s
+          WHERE s.study_group_id = o.study_group_id AND s.starts_on = o.starts_on AND s.status = 'cancelled'
+        )
+        UNION ALL
+        SELECT id, meeting_date AT TIME ZONE timezone AT TIME ZONE 'UTC', NULL FROM study_groups
+        WHERE meeting_date IS NOT NULL
+      ) m
+      JOIN study_groups sg ON sg.id = m.study_group_id
+      ORDER BY m.study_group_id, m.starts_on, m.location NULLS LAST
+    SQL
+  end
+
+  down do
+    run <<-SQL
+      CREATE OR REPLACE VIEW meetings AS
+      SELECT DISTINCT ON (m.study_group_id, m.starts_on)
+        m.study_group_id, m.starts_on, coalesce(m.location, sg.location) AS location
+      FROM (
+        SELECT study_group_id, starts_on, location FROM study_group_sessions
+        WHERE status = 'scheduled'
+        UNION ALL
+        SELECT study_group_id, starts_on, NULL FROM study_group_occurrences o
+        WHERE NOT EXISTS (
+          SELECT 1 FROM study_group_sessions s
+          WHERE s.study_group_id = o.study_group_id AND s.starts_on = o.starts_on AND s.status = 'cancelled'
+        )
+        UNION ALL
+        SELECT id, meeting_date, NULL FROM study_groups
+        WHERE meeting_date IS NOT NULL
+      ) m
+      JOIN study_groups sg ON sg.id = m.study_group_id
+      ORDER BY m.study_group_id, m.starts_on, m.location NULLS LAST
+    SQL
+
+    alter_table(:study_groups) do
+      drop_column :timezone
+    end
+  end
+end
@@ -0,0 +1,71 @@
+Sequel.migration do
+  up do
+    # the occurrence a session stands in for, so moving or cancelling the
+    # session doesn't bring the occurrence back
+    puts "adding occurrence_starts_on to study_group_sessions table"
+    alter_table(:study_group_sessions) do
+      add_column :occurrence_starts_on, DateTime
+      add_index [:study_group_id, :occurrence_starts_on]
+    end
+
+    run <<-SQL
+      UPDATE study_group_sessions s SET occurrence_starts_on = s.starts_on
+      WHERE EXISTS (
+        SELECT 1 FROM study_group_occurrences o
+        WHERE o.study_group_id = s.study_group_id AND o.starts_on = s.starts_on
+      )
+    SQL
+
+    # occurrences are left out when a session stands in for them, whether
+    # it was moved, cancelled or kept at the same time
+    puts "updating meetings view"
+    run <<-SQL
+      CREATE OR REPLACE VIEW meetings AS
+      SELECT DISTINCT ON (m.study_group_id, m.starts_on)
+        m.study_group_id, m.starts_on, coalesce(m.location, sg.location) AS location
+      FROM (
+        SELECT study_group_id, starts_on, location FROM study_group_sessions
+        WHERE status = 'scheduled'
+        UNION ALL
+        SELECT study_group_id, starts_on, NULL FROM study_group_occurrences o
+        WHERE NOT EXISTS (
+          SELECT 1 FROM study_group_sessions s
+          WHERE s.study_group_id = o.study_group_id AND s.occurrence_starts_on = o.starts_on
+        )
+        UNION ALL
+        SELECT id, meeting_date AT TIME ZONE timezone AT TIME ZONE 'UTC', NULL FROM study_groups
+        WHERE meeting_date IS NOT NULL
+      ) m
+      JOIN study_groups sg ON sg.id = m.study_group_id
+      ORDER BY m.study_group_id, m.starts_on, m.location NULLS LAST
+    SQL
+  end
+
+  down do
+    run <<-SQL
+      CREATE OR REPLACE VIEW meetings AS
+      SELECT DISTINCT ON (m.study_group_id, m.starts_on)
+        m.study_group_id, m.starts_on, coalesce(m.location, sg.location) AS location
+      FROM (
+        SELECT study_group_id, starts_on, location FROM study_group_sessions
+        WHERE status = 'scheduled'
+        UNION ALL
+        SELECT study_group_id, starts_on, NULL FROM study_group_occurrences o
+        WHERE NOT EXISTS (
+          SELECT 1 FROM study_group_sessions s
+          WHERE s.study_group_id = o.study_group_id AND s.starts_on = o.starts_on AND s.status = 'cancelled'
+        )
+        UNION ALL
+        SELECT id, meeting_date AT TIME ZONE timezone AT TIME ZONE 'UTC', NULL FROM study_groups
+        WHERE meeting_date IS NOT NULL
+      ) m
+      JOIN study_groups sg ON sg.id = m.study_group_id
+      ORDER BY m.study_group_id, m.starts_on, m.location NULLS LAST
+    SQL
+
+    alter_table(:study_group_sessions) do
+      drop_index [:study_group_id, :occurrence_starts_on]
+      drop_column :occurrence_starts_on
+    end
+  end
+end
@@ -0,0 +1,35 @@
+Sequel.migration do
+  up do
+    # calendar tokens are kept as hashes like the other secrets, hashed the
+    # same way as server.HashToken so existing feed URLs keep working
+    puts "hashing calendar tokens"
+    alter_table(:users) do
+      drop_index    :calendar_token, :name=>:users_calendar_token_key
+      rename_column :calendar_token, :calendar_token_hash
+    end
+
+    run <<-SQL
+      UPDATE users SET calendar_token_hash = encode(sha256(convert_to(calendar_token_hash, 'UTF8')), 'hex')
+      WHERE calendar_token_hash IS NOT NULL
+    SQL
+
+    alter_table(:users) do
+      add_index :calendar_token_hash, :name=>:users_calendar_token_hash_key, :unique=>true
+    end
+  end
+
+  # the tokens can't be recovered from their hashes, so feed URLs stop
+  # working and users have to get new ones
+  down do
+    alter_table(:users) do
+      drop_index    :calendar_token_hash, :name=>:users_calendar_token_hash_key
+      rename_column :calendar_token_hash, :calendar_token
+    end
+
+    run "UPDATE users SET calendar_token = NULL"
+
+    alter_table(:users) do
+      add_index :calendar_token, :name=>:users_calendar_token_key, :unique=>true
+    end
+  end
+end
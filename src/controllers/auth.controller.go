@@ -6,10 +6,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	mailchimp "github.com/beeker1121/mailchimp-go"
 	"github.com/beeker1121/mailchimp-go/lists/members"
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/email-notifications"
 	"github.com/prosperoa/study-groups/src/models"
 	"github.com/prosperoa/study-groups/src/server"
 	"golang.org/x/crypto/bcrypt"
@@ -84,3 +87,277 @@ func Signup(credentials models.SignUpCredentials) (models.User, int, error) {
 
 	return user, http.StatusOK, nil
 }
+
+// CreateSession starts a new login session for the user and returns its
+// first auth and refresh token pair.
+func CreateSession(userID int) (models.AuthTokens, int, error) {
+	var tokens models.AuthTokens
+	internalErr := errors.New("unable to create session")
+
+	sessionID, err := server.GenerateRandomToken(16)
+	if err != nil {
+		return tokens, http.StatusInternalServerError, internalErr
+	}
+
+	tokens, err = issueTokens(server.DB, userID, sessionID)
+	if err != nil {
+		log.Println(err.Error())
+		return tokens, http.StatusInternalServerError, internalErr
+	}
+
+	return tokens, http.StatusOK, nil
+}
+
+// RefreshSession exchanges a refresh token for a new token pair. The
+// refresh token used is revoked; presenting it again ends the session.
+func RefreshSession(refreshToken string) (models.AuthTokens, int, error) {
+	var tokens models.AuthTokens
+	var current models.RefreshToken
+
+	invalidErr := errors.New("invalid refresh token")
+	internalErr := errors.New("unable to refresh session")
+
+	tx, err := server.DB.Beginx()
+	if err != nil {
+		return tokens, http.StatusInternalServerError, internalErr
+	}
+
+	err = current.GetForUpdate(tx, refreshToken)
+
+	switch {
+	case err == sql.ErrNoRows:
+		tx.Rollback()
+		return tokens, http.StatusUnauthorized, invalidErr
+	case err != nil:
+		tx.Rollback()
+		return tokens, http.StatusInternalServerError, internalErr
+	case current.RevokedOn.Valid:
+		// token reuse, end the session for whoever holds it
+		if err = models.RevokeSession(tx, current.SessionID); err != nil {
+			tx.Rollback()
+			return tokens, http.StatusInternalServerError, internalErr
+		}
+
+		if err = tx.Commit(); err != nil {
+			return tokens, http.StatusInternalServerError, internalErr
+		}
+
+		return tokens, http.StatusUnauthorized, invalidErr
+	case current.IsExpired():
+		tx.Rollback()
+		return tokens, http.StatusUnauthorized, invalidErr
+	}
+
+	if err = current.Revoke(tx); err != nil {
+		tx.Rollback()
+		return tokens, http.StatusInternalServerError, internalErr
+	}
+
+	tokens, err = issueTokens(tx, current.UserID, current.SessionID)
+	if err != nil {
+		log.Println(err.Error())
+		tx.Rollback()
+		return tokens, http.StatusInternalServerError, internalErr
+	}
+
+	if err = tx.Commit(); err != nil {
+		return tokens, http.StatusInternalServerError, internalErr
+	}
+
+	return tokens, http.StatusOK, nil
+}
+
+func Logout(sessionID string) (int, error) {
+	if err := models.RevokeSession(server.DB, sessionID); err != nil {
+		return http.StatusInternalServerError, errors.New("unable to logout")
+	}
+
+	return http.StatusOK, nil
+}
+
+func issueTokens(db sqlx.Queryer, userID int, sessionID string) (models.AuthTokens, error) {
+	var tokens models.AuthTokens
+
+	refreshToken, err := server.GenerateRandomToken(32)
+	if err != nil { return tokens, err }
+
+	rt := models.RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+	}
+
+	if err = rt.Create(db, refreshToken); err != nil {
+		return tokens, err
+	}
+
+	authToken, err := server.GenerateAuthToken(strconv.Itoa(userID), sessionID)
+	if err != nil { return tokens, err }
+
+	tokens.AuthToken = authToken
+	tokens.RefreshToken = refreshToken
+
+	return tokens, nil
+}
+
+// ForgotPassword emails a password reset link to the account's address.
+// Unknown addresses aren't reported so accounts can't be discovered.
+func ForgotPassword(email string) (int, error) {
+	var user models.User
+	internalErr := errors.New("unable to reset password")
+
+	err := server.DB.Get(&user, "SELECT * FROM users WHERE email = $1", email)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusOK, nil
+	case err != nil:
+		return http.StatusInternalServerError, internalErr
+	}
+
+	token, err := server.GenerateRandomToken(32)
+	if err != nil {
+		return http.StatusInternalServerError, internalErr
+	}
+
+	tx, err := server.DB.Beginx()
+	if err != nil {
+		return http.StatusInternalServerError, internalErr
+	}
+
+	resetToken := models.PasswordResetToken{UserID: user.ID}
+
+	if err = resetToken.Create(tx, token); err != nil {
+		log.Println(err.Error())
+		tx.Rollback()
+		return http.StatusInternalServerError, internalErr
+	}
+
+	if err = tx.Commit(); err != nil {
+		return http.StatusInternalServerError, internalErr
+	}
+
+	if err = emails.PasswordResetNotification(user.FirstName, user.Email, token); err != nil {
+		log.Println(err.Error())
+	}
+
+	return http.StatusOK, nil
+}
+
+// ResetPassword sets a new password using an emailed reset token, uses up
+// the token and signs out every session of the user.
+func ResetPassword(token, newPassword string) (int, error) {
+	var resetToken models.PasswordResetToken
+
+	invalidErr := errors.New("invalid or expired reset token")
+	internalErr := errors.New("unable to reset password")
+
+	tx, err := server.DB.Beginx()
+	if err != nil {
+		return http.StatusInternalServerError, internalErr
+	}
+
+	err = resetToken.GetForUpdate(tx, token)
+
+	switch {
+	case err == sql.ErrNoRows:
+		tx.Rollback()
+		return http.StatusBadRequest, invalidErr
+	case err != nil:
+		tx.Rollback()
+		return http.StatusInternalServerError, internalErr
+	case !resetToken.IsUsable():
+		tx.Rollback()
+		return http.StatusBadRequest, invalidErr
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.MinCost)
+	if err != nil {
+		tx.Rollback()
+		return http.StatusInternalServerError, internalErr
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET password = $1, updated_on = $2 WHERE id = $3",
+		passwordHash,
+		time.Now(),
+		resetToken.UserID,
+	)
+
+	if err == nil { err = resetToken.MarkUsed(tx) }
+	if err == nil { err = models.RevokeUserSessions(tx, resetToken.UserID) }
+
+	if err != nil {
+		log.Println(err.Error())
+		tx.Rollback()
+		return http.StatusInternalServerError, internalErr
+	}
+
+	if err = tx.Commit(); err != nil {
+		return http.StatusInternalServerError, internalErr
+	}
+
+	return http.StatusOK, nil
+}
+
+// SendEmailVerification emails the user a signed link confirming their
+// address, at most once every models.VerificationResendInterval.
+func SendEmailVerification(userID int) (int, error) {
+	user := models.User{ID: userID}
+	internalErr := errors.New("unable to send verification email")
+
+	err := user.Get()
+
+	switch {
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound, errors.New("user not found")
+	case err != nil:
+		return http.StatusInternalServerError, internalErr
+	case user.IsEmailVerified():
+		return http.StatusBadRequest, errors.New("email already verified")
+	}
+
+	ok, err := user.MarkVerificationSent()
+
+	switch {
+	case err != nil:
+		return http.StatusInternalServerError, internalErr
+	case !ok:
+		return http.StatusTooManyRequests, errors.New(
+			"verification email recently sent, please try again later",
+		)
+	}
+
+	token, err := server.GenerateEmailVerificationToken(strconv.Itoa(user.ID), user.Email)
+	if err != nil {
+		return http.StatusInternalServerError, internalErr
+	}
+
+	if err = emails.EmailVerificationNotification(user.FirstName, user.Email, token); err != nil {
+		log.Println(err.Error())
+		return http.StatusInternalServerError, internalErr
+	}
+
+	return http.StatusOK, nil
+}
+
+func VerifyEmail(token string) (int, error) {
+	userID, email, err := server.ParseEmailVerificationToken(token)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	uID, _ := strconv.Atoi(userID)
+	user := models.User{ID: uID}
+
+	verified, err := user.VerifyEmail(email)
+
+	// nothing to verify: the user is gone, already verified or changed email
+	switch {
+	case err != nil:
+		return http.StatusInternalServerError, errors.New("unable to verify email")
+	case !verified:
+		return http.StatusBadRequest, errors.New("invalid verification token")
+	}
+
+	return http.StatusOK, nil
+}
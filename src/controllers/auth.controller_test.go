@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/prosperoa/study-groups/src/email-notifications"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/testdb"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var resetLink = regexp.MustCompile(`/reset_password\?token=([0-9a-f]+)`)
+
+// requestReset asks for a password reset and returns the token from the
+// emailed link.
+func requestReset(t *testing.T, email string) string {
+	t.Helper()
+
+	if status, err := ForgotPassword(email); status != http.StatusOK || err != nil {
+		t.Fatalf("ForgotPassword: %d %v", status, err)
+	}
+
+	mailer := &emails.MemoryMailer{}
+	if err := emails.DrainOutbox(mailer); err != nil { t.Fatal(err) }
+
+	sent := mailer.Sent()
+	if len(sent) != 1 { t.Fatalf("sent %d emails, want 1", len(sent)) }
+
+	if sent[0].To[0] != email { t.Errorf("reset email sent to %v", sent[0].To) }
+
+	match := resetLink.FindSubmatch(sent[0].HTML)
+	if match == nil { t.Fatalf("no reset link in:\n%s", sent[0].HTML) }
+
+	return string(match[1])
+}
+
+func checkPassword(t *testing.T, userID int, password string) bool {
+	t.Helper()
+
+	var passwordHash string
+	if err := server.DB.Get(&passwordHash, "SELECT password FROM users WHERE id = $1", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+}
+
+func TestForgotPasswordIssuesToken(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	user := createUser(t, "Ada", "ada@example.com", "old password")
+	token := requestReset(t, user.Email)
+
+	// only the hash of the emailed token is stored
+	var resetToken models.PasswordResetToken
+	err := server.DB.Get(&resetToken, "SELECT * FROM password_reset_tokens WHERE user_id = $1", user.ID)
+	if err != nil { t.Fatal(err) }
+
+	if resetToken.TokenHash != server.HashToken(token) {
+		t.Errorf("stored %q for token %q", resetToken.TokenHash, token)
+	}
+
+	if !resetToken.IsUsable() { t.Errorf("new token isn't usable: %+v", resetToken) }
+
+	if status, err := ResetPassword(token, "new password"); status != http.StatusOK || err != nil {
+		t.Fatalf("ResetPassword: %d %v", status, err)
+	}
+
+	if !checkPassword(t, user.ID, "new password") { t.Error("password wasn't changed") }
+}
+
+func TestResetPasswordTokenIsSingleUse(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	user := createUser(t, "Ada", "ada@example.com", "old password")
+	token := requestReset(t, user.Email)
+
+	if status, err := ResetPassword(token, "new password"); status != http.StatusOK {
+		t.Fatalf("ResetPassword: %d %v", status, err)
+	}
+
+	if status, err := ResetPassword(token, "another password"); status != http.StatusBadRequest || err == nil {
+		t.Errorf("reusing the token: %d %v, want 400", status, err)
+	}
+
+	if !checkPassword(t, user.ID, "new password") { t.Error("reused token changed the password") }
+}
+
+func TestResetPasswordOnlyLatestTokenWorks(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	user := createUser(t, "Ada", "ada@example.com", "old password")
+	first := requestReset(t, user.Email)
+	second := requestReset(t, user.Email)
+
+	if status, _ := ResetPassword(first, "new password"); status != http.StatusBadRequest {
+		t.Errorf("superseded token: %d, want 400", status)
+	}
+
+	if status, err := ResetPassword(second, "new password"); status != http.StatusOK {
+		t.Errorf("latest token: %d %v", status, err)
+	}
+}
+
+func TestResetPasswordRejectsExpiredToken(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	user := createUser(t, "Ada", "ada@example.com", "old password")
+	token := requestReset(t, user.Email)
+
+	_, err := server.DB.Exec(
+		"UPDATE password_reset_tokens SET expires_on = $1 WHERE user_id = $2",
+		time.Now().Add(-time.Minute),
+		user.ID,
+	)
+	if err != nil { t.Fatal(err) }
+
+	if status, err := ResetPassword(token, "new password"); status != http.StatusBadRequest || err == nil {
+		t.Errorf("expired token: %d %v, want 400", status, err)
+	}
+
+	if !checkPassword(t, user.ID, "old password") { t.Error("expired token changed the password") }
+}
+
+func TestResetPasswordRejectsUnknownToken(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	if status, _ := ResetPassword("not-a-token", "new password"); status != http.StatusBadRequest {
+		t.Errorf("unknown token: %d, want 400", status)
+	}
+}
+
+func TestForgotPasswordDoesNotRevealAccounts(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	createUser(t, "Ada", "ada@example.com", "old password")
+
+	knownStatus, knownErr := ForgotPassword("ada@example.com")
+	unknownStatus, unknownErr := ForgotPassword("nobody@example.com")
+
+	if knownStatus != unknownStatus || knownErr != unknownErr {
+		t.Errorf("known address: %d %v, unknown address: %d %v",
+			knownStatus, knownErr, unknownStatus, unknownErr,
+		)
+	}
+
+	mailer := &emails.MemoryMailer{}
+	if err := emails.DrainOutbox(mailer); err != nil { t.Fatal(err) }
+
+	for _, e := range mailer.Sent() {
+		if e.To[0] == "nobody@example.com" { t.Error("emailed an address without an account") }
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prosperoa/study-groups/src/ical"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+const (
+	// calendarLookback keeps recent meetings in calendar feeds so they don't
+	// vanish from calendar apps the moment they're over
+	calendarLookback = time.Hour * 24 * 30
+
+	// meetingLength is how long a meeting set through meeting_date lasts,
+	// since those don't have a duration
+	meetingLength = time.Hour
+)
+
+func GetStudyGroupCalendar(studyGroupID string) (ical.Calendar, int, error) {
+	calendar := ical.Calendar{}
+	errMsg := errors.New("unable to get study group calendar")
+
+	studyGroup, status, err := GetStudyGroup(studyGroupID)
+	if err != nil { return calendar, status, err }
+
+	calendar.Name = studyGroup.Name
+
+	calendar.Events, err = studyGroupEvents(studyGroup)
+	if err != nil {
+		log.Println(err.Error())
+		return calendar, http.StatusInternalServerError, errMsg
+	}
+
+	return calendar, http.StatusOK, nil
+}
+
+// GetUserCalendar returns the meetings of every study group the owner of
+// the calendar token belongs to.
+func GetUserCalendar(token string) (ical.Calendar, int, error) {
+	var user models.User
+	calendar := ical.Calendar{Name: "Study Groups"}
+	errMsg := errors.New("unable to get calendar")
+
+	err := user.GetByCalendarToken(token)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return calendar, http.StatusNotFound, errors.New("calendar not found")
+	case err != nil:
+		log.Println(err.Error())
+		return calendar, http.StatusInternalServerError, errMsg
+	}
+
+	studyGroups, err := models.GetUserStudyGroups(server.DB, user.ID)
+	if err != nil {
+		log.Println(err.Error())
+		return calendar, http.StatusInternalServerError, errMsg
+	}
+
+	for _, studyGroup := range studyGroups {
+		events, err := studyGroupEvents(studyGroup)
+		if err != nil {
+			log.Println(err.Error())
+			return calendar, http.StatusInternalServerError, errMsg
+		}
+
+		calendar.Events = append(calendar.Events, events...)
+	}
+
+	return calendar, http.StatusOK, nil
+}
+
+// GetCalendarToken returns the token of the user's calendar feed, replacing
+// it first if reset is set. The token is only known when it's made, so
+// without reset it's "" for users who already have one.
+func GetCalendarToken(userID int, reset bool) (string, int, error) {
+	var token string
+	var err error
+
+	user := models.User{ID: userID}
+
+	if reset {
+		token, err = user.ResetCalendarToken()
+	} else {
+		token, err = user.CreateCalendarToken()
+	}
+
+	switch {
+	case err == sql.ErrNoRows:
+		return token, http.StatusNotFound, errors.New("user not found")
+	case err != nil:
+		log.Println(err.Error())
+		return token, http.StatusInternalServerError, errors.New(
+			"unable to get calendar token",
+		)
+	}
+
+	return token, http.StatusOK, nil
+}
+
+// studyGroupEvents lists the meetings of the study group from its schedule,
+// from a month ago up to a year ahead. Study groups without a schedule get
+// a single event for their meeting_date, if they have one, in the study
+// group's time zone.
+func studyGroupEvents(studyGroup models.StudyGroup) ([]ical.Event, error) {
+	var events []ical.Event
+	var schedule models.StudyGroupSchedule
+
+	err := schedule.Get(server.DB, studyGroup.ID)
+
+	switch {
+	case err == sql.ErrNoRows && studyGroup.MeetingDate.Valid:
+		start, err := studyGroup.MeetingTime()
+		if err != nil { return events, err }
+
+		return append(events, studyGroupEvent(studyGroup, start, start.Add(meetingLength))), nil
+	case err == sql.ErrNoRows:
+		return events, nil
+	case err != nil:
+		return events, err
+	}
+
+	occurrences, err := schedule.Occurrences(
+		time.Now().Add(-calendarLookback),
+		time.Now().Add(models.OccurrenceHorizon),
+	)
+	if err != nil { return events, err }
+
+	for _, occurrence := range occurrences {
+		events = append(events, studyGroupEvent(studyGroup, occurrence.StartsOn, occurrence.EndsOn))
+	}
+
+	return events, nil
+}
+
+func studyGroupEvent(studyGroup models.StudyGroup, start, end time.Time) ical.Event {
+	// the UID stays the same for a meeting across feed refreshes, so
+	// calendar apps update it instead of adding a copy
+	uid := "study-group-" + strconv.Itoa(studyGroup.ID) + "-" +
+		start.UTC().Format("20060102T150405") + "@studygroups"
+
+	return ical.Event{
+		UID:         uid,
+		Start:       start,
+		End:         end,
+		Summary:     studyGroup.Name,
+		Description: studyGroup.Description.String,
+		Location:    studyGroup.Location.String,
+	}
+}
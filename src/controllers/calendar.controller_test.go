@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/testdb"
+)
+
+func TestCalendarTokens(t *testing.T) {
+	testdb.Open(t, "users")
+
+	user := createUser(t, "Ada", "ada@example.com", "password")
+
+	token, _, err := GetCalendarToken(user.ID, false)
+	if err != nil { t.Fatal(err) }
+
+	if token == "" { t.Fatal("no calendar token was made") }
+
+	var stored string
+
+	err = server.DB.Get(&stored, "SELECT calendar_token_hash FROM users WHERE id = $1", user.ID)
+	if err != nil { t.Fatal(err) }
+
+	if stored != server.HashToken(token) { t.Errorf("stored %q, want the hash of the token", stored) }
+
+	if again, _, err := GetCalendarToken(user.ID, false); again != "" || err != nil {
+		t.Errorf("second GetCalendarToken = %q, %v, want no token", again, err)
+	}
+
+	if _, status, err := GetUserCalendar(token); err != nil {
+		t.Fatalf("GetUserCalendar = %d, %v", status, err)
+	}
+
+	newToken, _, err := GetCalendarToken(user.ID, true)
+	if err != nil { t.Fatal(err) }
+
+	if _, status, _ := GetUserCalendar(token); status != http.StatusNotFound {
+		t.Errorf("old token: status %d, want %d", status, http.StatusNotFound)
+	}
+
+	if _, status, err := GetUserCalendar(newToken); err != nil {
+		t.Errorf("new token: GetUserCalendar = %d, %v", status, err)
+	}
+
+	if _, status, _ := GetUserCalendar(stored); status != http.StatusNotFound {
+		t.Errorf("stored hash used as a token: status %d, want %d", status, http.StatusNotFound)
+	}
+}
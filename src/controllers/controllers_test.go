@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// page asks for the first page of a list.
+func page(size int) models.PageFilter {
+	return models.PageFilter{BaseFilter: models.BaseFilter{PageSize: size}}
+}
+
+// createUser adds a user with a verified email and the given password.
+func createUser(t *testing.T, firstName, email, password string) models.User {
+	t.Helper()
+
+	var user models.User
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil { t.Fatal(err) }
+
+	err = server.DB.Get(&user,
+	 `INSERT INTO users (first_name, email, password, email_verified_on, created_on, updated_on)
+		VALUES ($1, $2, $3, $4, $4, $4)
+		RETURNING *`,
+		firstName,
+		email,
+		string(passwordHash),
+		time.Now(),
+	)
+	if err != nil { t.Fatal(err) }
+
+	return user
+}
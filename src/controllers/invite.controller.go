@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+func CreateInvite(studyGroupID string, userID int, newInvite models.NewInvite) (models.Invite, int, error) {
+	invite := models.Invite{
+		CreatedBy: null.IntFrom(int64(userID)),
+		MaxUses:   null.NewInt(int64(newInvite.MaxUses), newInvite.MaxUses != 0),
+		ExpiresOn: time.Now().Add(models.DefaultInviteTTL),
+	}
+
+	invite.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	if newInvite.ExpiresInHours != 0 {
+		invite.ExpiresOn = time.Now().Add(time.Hour * time.Duration(newInvite.ExpiresInHours))
+	}
+
+	if err := invite.Create(server.DB); err != nil {
+		log.Println(err.Error())
+		return invite, http.StatusInternalServerError, errors.New(
+			"unable to create invite",
+		)
+	}
+
+	return withLink(invite), http.StatusCreated, nil
+}
+
+func GetInvites(studyGroupID string) ([]models.Invite, int, error) {
+	id, _ := strconv.Atoi(studyGroupID)
+
+	invites, err := models.GetStudyGroupInvites(server.DB, id)
+	if err != nil {
+		log.Println(err.Error())
+		return invites, http.StatusInternalServerError, errors.New(
+			"unable to get invites",
+		)
+	}
+
+	for i := range invites {
+		invites[i] = withLink(invites[i])
+	}
+
+	return invites, http.StatusOK, nil
+}
+
+func RevokeInvite(studyGroupID string, inviteID int) (models.Invite, int, error) {
+	invite := models.Invite{ID: inviteID}
+	invite.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	err := invite.Revoke(server.DB)
+
+	switch {
+	case err == models.ErrInviteNotFound:
+		return invite, http.StatusNotFound, err
+	case err != nil:
+		log.Println(err.Error())
+		return invite, http.StatusInternalServerError, errors.New(
+			"unable to revoke invite",
+		)
+	}
+
+	return withLink(invite), http.StatusOK, nil
+}
+
+// GetInvite returns the study group an invite is for, so users can see
+// what they're joining. Invites that can't be used anymore are not found.
+func GetInvite(code string) (models.StudyGroup, int, error) {
+	var invite models.Invite
+
+	err := invite.GetByCode(server.DB, code)
+
+	switch {
+	case err == models.ErrInviteNotFound, err == nil && !invite.Usable():
+		return models.StudyGroup{}, http.StatusNotFound, models.ErrInviteNotFound
+	case err != nil:
+		log.Println(err.Error())
+		return models.StudyGroup{}, http.StatusInternalServerError, errors.New(
+			"unable to get invite",
+		)
+	}
+
+	return GetStudyGroup(strconv.Itoa(invite.StudyGroupID))
+}
+
+func JoinWithInvite(code string, userID int) (models.StudyGroup, models.StudyGroupMembership, int, error) {
+	var invite models.Invite
+	var membership models.StudyGroupMembership
+
+	err := invite.GetByCode(server.DB, code)
+
+	switch {
+	case err == models.ErrInviteNotFound:
+		return models.StudyGroup{}, membership, http.StatusNotFound, err
+	case err != nil:
+		log.Println(err.Error())
+		return models.StudyGroup{}, membership, http.StatusInternalServerError, errors.New(
+			"unable to join study group",
+		)
+	}
+
+	studyGroup, status, err := studyGroupTx(invite.StudyGroupID, "unable to join study group",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) (err error) {
+			membership, err = studyGroup.JoinWithInvite(tx, userID, &invite)
+			return err
+		},
+	)
+
+	return studyGroup, membership, status, err
+}
+
+func withLink(invite models.Invite) models.Invite {
+	invite.Link = server.ClientURL + "/invites/" + invite.Code
+	return invite
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/testdb"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestJoinWithInviteIntoFullStudyGroup(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	owner := createUser(t, "Owner", "owner@example.com", "password")
+	first := createUser(t, "First", "first@example.com", "password")
+	second := createUser(t, "Second", "second@example.com", "password")
+
+	studyGroup, _, err := CreateStudyGroup(models.StudyGroup{
+		UserID:          owner.ID,
+		Name:            "Organic Chemistry",
+		MembersLimit:    null.IntFrom(1),
+		AdmissionPolicy: models.AdmissionPolicyManual,
+		Visibility:      models.VisibilityPrivate,
+	})
+	if err != nil { t.Fatal(err) }
+
+	studyGroupID := strconv.Itoa(studyGroup.ID)
+
+	invite, _, err := CreateInvite(studyGroupID, owner.ID, models.NewInvite{MaxUses: 2})
+	if err != nil { t.Fatal(err) }
+
+	if _, _, _, err := JoinWithInvite(invite.Code, first.ID); err != nil { t.Fatal(err) }
+
+	_, _, status, err := JoinWithInvite(invite.Code, second.ID)
+	if err != models.ErrStudyGroupFull || status != http.StatusForbidden {
+		t.Fatalf("joining a full study group = %d, %v, want %d, %v",
+			status, err, http.StatusForbidden, models.ErrStudyGroupFull,
+		)
+	}
+
+	var waitlisted int
+
+	err = server.DB.Get(&waitlisted,
+	 `SELECT count(*) FROM study_group_memberships
+		WHERE study_group_id = $1 AND user_id = $2`,
+		studyGroup.ID,
+		second.ID,
+	)
+	if err != nil { t.Fatal(err) }
+
+	if waitlisted != 0 { t.Errorf("refused join left a membership behind") }
+
+	if err := invite.GetByCode(server.DB, invite.Code); err != nil { t.Fatal(err) }
+
+	if invite.Uses != 1 { t.Errorf("invite uses = %d, want 1", invite.Uses) }
+
+	// once a spot opens up the invite still works
+	if _, _, _, err := LeaveStudyGroup(studyGroupID, strconv.Itoa(first.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, membership, _, err := JoinWithInvite(invite.Code, second.ID)
+	if err != nil { t.Fatal(err) }
+
+	if membership.Status != models.MembershipStatusActive {
+		t.Errorf("membership status = %q, want %q", membership.Status, models.MembershipStatusActive)
+	}
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
+	"github.com/prosperoa/study-groups/src/query"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+// GetNotifications returns a page of the user's notifications, newest
+// first, along with where the next page starts.
+func GetNotifications(userID int, unreadOnly bool, filter models.PageFilter) ([]models.Notification, pagination.Info, int, error) {
+	var rows []struct {
+		models.Notification
+		SortKey string `db:"sort_key"`
+	}
+
+	notifications := []models.Notification{}
+	sort := query.NotificationsSort
+
+	page, err := selectPage(&rows, query.Notifications(userID, unreadOnly), sort, filter)
+
+	switch {
+	case err == pagination.ErrInvalidCursor:
+		return notifications, page, http.StatusBadRequest, err
+	case err != nil:
+		log.Println(err.Error())
+		return notifications, page, http.StatusInternalServerError, errors.New(
+			"unable to get notifications",
+		)
+	}
+
+	for i, row := range rows {
+		if i == filter.PageSize { break }
+		notifications = append(notifications, row.Notification)
+	}
+
+	if len(notifications) > 0 {
+		last := rows[len(notifications) - 1]
+		cursor := sort.Cursor(last.SortKey, last.ID)
+
+		page.NextCursor, page.HasMore = pagination.Next(len(rows), filter.PageSize, cursor)
+	}
+
+	return notifications, page, http.StatusOK, nil
+}
+
+func GetUnreadNotificationCount(userID int) (int, int, error) {
+	count, err := models.GetUnreadNotificationCount(server.DB, userID)
+	if err != nil {
+		log.Println(err.Error())
+		return count, http.StatusInternalServerError, errors.New(
+			"unable to count unread notifications",
+		)
+	}
+
+	return count, http.StatusOK, nil
+}
+
+func MarkNotificationRead(userID, notificationID int) (models.Notification, int, error) {
+	notification := models.Notification{ID: notificationID, UserID: userID}
+
+	err := notification.MarkRead(server.DB)
+
+	switch {
+	case err == models.ErrNotificationNotFound:
+		return notification, http.StatusNotFound, err
+	case err != nil:
+		log.Println(err.Error())
+		return notification, http.StatusInternalServerError, errors.New(
+			"unable to mark notification as read",
+		)
+	}
+
+	return notification, http.StatusOK, nil
+}
+
+func MarkAllNotificationsRead(userID int) (int64, int, error) {
+	count, err := models.MarkAllNotificationsRead(server.DB, userID)
+	if err != nil {
+		log.Println(err.Error())
+		return count, http.StatusInternalServerError, errors.New(
+			"unable to mark notifications as read",
+		)
+	}
+
+	return count, http.StatusOK, nil
+}
+
+func GetNotificationSettings(userID int) (models.NotificationSettings, int, error) {
+	var settings models.NotificationSettings
+
+	if err := settings.Get(server.DB, userID); err != nil {
+		log.Println(err.Error())
+		return settings, http.StatusInternalServerError, errors.New(
+			"unable to get notification settings",
+		)
+	}
+
+	return settings, http.StatusOK, nil
+}
+
+func UpdateNotificationSettings(userID int, preferences models.NotificationPreferences) (models.NotificationSettings, int, error) {
+	var settings models.NotificationSettings
+	errMsg := errors.New("unable to update notification settings")
+
+	err := server.Transact(func(tx *sqlx.Tx) error {
+		if err := settings.Get(tx, userID); err != nil {
+			return err
+		}
+
+		if preferences.DigestFrequency != "" {
+			settings.DigestFrequency = preferences.DigestFrequency
+		}
+
+		if preferences.ReminderHours != 0 {
+			settings.ReminderHours = preferences.ReminderHours
+		}
+
+		for notificationType, delivery := range preferences.Deliveries {
+			settings.Deliveries[notificationType] = delivery
+		}
+
+		return settings.Save(tx)
+	})
+
+	if err != nil {
+		log.Println(err.Error())
+		return settings, http.StatusInternalServerError, errMsg
+	}
+
+	return settings, http.StatusOK, nil
+}
+
+// CheckUnsubscribeToken returns the user an unsubscribe link was sent to
+// and the notification type it stops, without unsubscribing them. Links
+// are checked on GET so that link scanners opening them change nothing.
+func CheckUnsubscribeToken(token string) (models.User, string, int, error) {
+	userID, notificationType, err := server.ParseUnsubscribeToken(token)
+	if err != nil {
+		return models.User{}, "", http.StatusBadRequest, err
+	}
+
+	if !models.IsUnsubscribeType(notificationType) {
+		return models.User{}, "", http.StatusBadRequest, models.ErrInvalidNotificationType
+	}
+
+	uID, _ := strconv.Atoi(userID)
+	user := models.User{ID: uID}
+
+	err = user.Get()
+
+	switch {
+	case err == sql.ErrNoRows:
+		return user, "", http.StatusNotFound, errors.New("user not found")
+	case err != nil:
+		log.Println(err.Error())
+		return user, "", http.StatusInternalServerError, errors.New("unable to unsubscribe")
+	}
+
+	return user, notificationType, http.StatusOK, nil
+}
+
+// Unsubscribe stops the emails an unsubscribe link was sent in, returning
+// their notification type.
+func Unsubscribe(token string) (string, int, error) {
+	user, notificationType, status, err := CheckUnsubscribeToken(token)
+	if err != nil { return "", status, err }
+
+	err = server.Transact(func(tx *sqlx.Tx) error {
+		var settings models.NotificationSettings
+
+		if err := settings.Get(tx, user.ID); err != nil {
+			return err
+		}
+
+		if err := settings.Unsubscribe(notificationType); err != nil {
+			return err
+		}
+
+		return settings.Save(tx)
+	})
+
+	switch {
+	case err == models.ErrInvalidNotificationType:
+		return "", http.StatusBadRequest, err
+	case err != nil:
+		log.Println(err.Error())
+		return "", http.StatusInternalServerError, errors.New("unable to unsubscribe")
+	}
+
+	return notificationType, http.StatusOK, nil
+}
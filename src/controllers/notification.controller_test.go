@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/testdb"
+)
+
+func TestGetNotificationsPages(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	user := createUser(t, "Ada", "ada@example.com", "password")
+	other := createUser(t, "Alan", "alan@example.com", "password")
+
+	for i := 0; i < 25; i++ {
+		n := models.Notification{UserID: user.ID, Type: models.NotificationMemberLeft, Text: fmt.Sprint(i)}
+		if err := n.Create(server.DB); err != nil { t.Fatal(err) }
+
+		// every fifth one is read
+		if i % 5 == 0 {
+			if err := n.MarkRead(server.DB); err != nil { t.Fatal(err) }
+		}
+	}
+
+	n := models.Notification{UserID: other.ID, Type: models.NotificationMemberLeft, Text: "not yours"}
+	if err := n.Create(server.DB); err != nil { t.Fatal(err) }
+
+	filter := page(10)
+	filter.Total = true
+
+	var unread []models.Notification
+	pages := 0
+
+	for {
+		notifications, info, status, err := GetNotifications(user.ID, true, filter)
+		if err != nil { t.Fatalf("status %d: %v", status, err) }
+
+		if info.Total == nil || *info.Total != 20 { t.Errorf("total = %v, want 20", info.Total) }
+
+		unread = append(unread, notifications...)
+		pages++
+
+		if !info.HasMore { break }
+		filter.Cursor = info.NextCursor
+	}
+
+	if len(unread) != 20 || pages != 2 {
+		t.Fatalf("%d unread notifications on %d pages, want 20 on 2", len(unread), pages)
+	}
+
+	for i, n := range unread {
+		if n.ReadOn.Valid || n.UserID != user.ID { t.Errorf("got %+v", n) }
+
+		if i > 0 && n.ID >= unread[i - 1].ID {
+			t.Errorf("notification %d came after %d", n.ID, unread[i - 1].ID)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+var errNoSchedule = errors.New("study group has no schedule")
+
+func GetStudyGroupSchedule(studyGroupID string) (models.StudyGroupSchedule, int, error) {
+	var schedule models.StudyGroupSchedule
+	id, _ := strconv.Atoi(studyGroupID)
+
+	err := schedule.Get(server.DB, id)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return schedule, http.StatusNotFound, errNoSchedule
+	case err != nil:
+		log.Println(err.Error())
+		return schedule, http.StatusInternalServerError, errors.New(
+			"unable to get study group schedule",
+		)
+	}
+
+	return schedule, http.StatusOK, nil
+}
+
+// SaveStudyGroupSchedule sets the schedule of the study group, replacing
+// the one it had, and returns the study group so its members can be told.
+func SaveStudyGroupSchedule(schedule models.StudyGroupSchedule) (models.StudyGroup, models.StudyGroupSchedule, int, error) {
+	studyGroup, status, err := studyGroupTx(schedule.StudyGroupID, "unable to save study group schedule",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			return schedule.Save(tx)
+		},
+	)
+
+	return studyGroup, schedule, status, err
+}
+
+func DeleteStudyGroupSchedule(studyGroupID string) (models.StudyGroup, int, error) {
+	var deleted bool
+
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to delete study group schedule",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			err := models.DeleteStudyGroupSchedule(tx, studyGroup.ID)
+
+			// the study group exists, so no rows means there's no schedule
+			if err == sql.ErrNoRows { return nil }
+
+			deleted = err == nil
+			return err
+		},
+	)
+
+	if err == nil && !deleted {
+		return studyGroup, http.StatusNotFound, errNoSchedule
+	}
+
+	return studyGroup, status, err
+}
+
+// GetStudyGroupOccurrences expands the meetings of the study group from the
+// start of the from date through the end of the to date, both read in the
+// schedule's time zone.
+func GetStudyGroupOccurrences(studyGroupID string, from, to time.Time) ([]models.Occurrence, int, error) {
+	schedule, status, err := GetStudyGroupSchedule(studyGroupID)
+	if err != nil { return nil, status, err }
+
+	loc := schedule.StartsOn.Location()
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	to = time.Date(to.Year(), to.Month(), to.Day() + 1, 0, 0, 0, 0, loc)
+
+	occurrences, err := schedule.Occurrences(from, to)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, http.StatusInternalServerError, errors.New(
+			"unable to get study group meetings",
+		)
+	}
+
+	return occurrences, http.StatusOK, nil
+}
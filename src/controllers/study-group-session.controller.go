@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+type CheckInCode struct {
+	Code      string    `json:"code"`
+	ExpiresOn time.Time `json:"expires_on"`
+}
+
+func GetStudyGroupSessions(studyGroupID string) ([]models.StudyGroupSession, int, error) {
+	id, _ := strconv.Atoi(studyGroupID)
+
+	sessions, err := models.GetStudyGroupSessions(server.DB, id)
+	if err != nil {
+		log.Println(err.Error())
+		return sessions, http.StatusInternalServerError, errors.New(
+			"unable to get sessions",
+		)
+	}
+
+	return sessions, http.StatusOK, nil
+}
+
+func CreateStudyGroupSession(session models.StudyGroupSession) (models.StudyGroupSession, int, error) {
+	_, status, err := studyGroupTx(session.StudyGroupID, "unable to create session",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			return session.Create(tx)
+		},
+	)
+
+	return session, status, err
+}
+
+// CancelSession returns the study group along with the cancelled session
+// so members can be told about it.
+func CancelStudyGroupSession(studyGroupID string, sessionID int) (models.StudyGroup, models.StudyGroupSession, int, error) {
+	var session models.StudyGroupSession
+
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to cancel session",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			if err := session.GetForUpdate(tx, studyGroup.ID, sessionID); err != nil {
+				return err
+			}
+
+			return session.Cancel(tx)
+		},
+	)
+
+	return studyGroup, session, status, err
+}
+
+func RescheduleStudyGroupSession(studyGroupID string, sessionID int, params models.StudyGroupSession) (models.StudyGroup, models.StudyGroupSession, int, error) {
+	var session models.StudyGroupSession
+
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to reschedule session",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			if err := session.GetForUpdate(tx, studyGroup.ID, sessionID); err != nil {
+				return err
+			}
+
+			return session.Reschedule(tx, params.StartsOn, params.EndsOn, params.Location)
+		},
+	)
+
+	return studyGroup, session, status, err
+}
+
+func NewCheckInCode(studyGroupID string, sessionID int) (CheckInCode, int, error) {
+	var checkInCode CheckInCode
+
+	status, err := sessionTx(studyGroupID, sessionID, "unable to create check-in code",
+		func(tx *sqlx.Tx, session *models.StudyGroupSession) (err error) {
+			checkInCode.Code, checkInCode.ExpiresOn, err = session.NewCheckInCode(tx)
+			return err
+		},
+	)
+
+	return checkInCode, status, err
+}
+
+func CheckIn(studyGroupID string, sessionID, userID int, code string) (int, error) {
+	return sessionTx(studyGroupID, sessionID, "unable to check in",
+		func(tx *sqlx.Tx, session *models.StudyGroupSession) error {
+			return session.CheckIn(tx, userID, code)
+		},
+	)
+}
+
+func GetSessionAttendees(studyGroupID string, sessionID int) (models.Users, int, error) {
+	id, _ := strconv.Atoi(studyGroupID)
+
+	attendees, err := models.GetSessionAttendees(server.DB, id, sessionID)
+	if err != nil {
+		log.Println(err.Error())
+		return attendees, http.StatusInternalServerError, errors.New(
+			"unable to get attendance",
+		)
+	}
+
+	return attendees, http.StatusOK, nil
+}
+
+// GetAttendance returns how often each member and waitlisted user of the
+// study group came to its sessions.
+func GetAttendance(studyGroupID string) ([]models.AttendanceSummary, int, error) {
+	id, _ := strconv.Atoi(studyGroupID)
+
+	summaries, err := models.GetAttendanceSummaries(server.DB, id)
+	if err != nil {
+		log.Println(err.Error())
+		return summaries, http.StatusInternalServerError, errors.New(
+			"unable to get attendance",
+		)
+	}
+
+	return summaries, http.StatusOK, nil
+}
+
+func GetMemberAttendance(studyGroupID string, userID int) ([]models.MemberAttendance, int, error) {
+	id, _ := strconv.Atoi(studyGroupID)
+
+	attendance, err := models.GetMemberAttendance(server.DB, id, userID)
+	if err != nil {
+		log.Println(err.Error())
+		return attendance, http.StatusInternalServerError, errors.New(
+			"unable to get attendance",
+		)
+	}
+
+	return attendance, http.StatusOK, nil
+}
+
+// sessionTx locks only the session, not its study group, and runs fn
+// against it in a single transaction, so checking in doesn't hold up joins
+// or changes to the study group. Errors map to statuses the same way as in
+// studyGroupTx.
+func sessionTx(
+	studyGroupID string,
+	sessionID int,
+	errMsg string,
+	fn func(tx *sqlx.Tx, session *models.StudyGroupSession) error,
+) (int, error) {
+	id, _ := strconv.Atoi(studyGroupID)
+
+	err := server.Transact(func(tx *sqlx.Tx) error {
+		var session models.StudyGroupSession
+
+		if err := session.GetForUpdate(tx, id, sessionID); err != nil {
+			return err
+		}
+
+		return fn(tx, &session)
+	})
+
+	return txStatus(err, errMsg)
+}
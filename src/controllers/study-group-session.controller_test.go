@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/testdb"
+)
+
+func TestCheckIn(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	owner := createUser(t, "Owner", "owner@example.com", "password")
+	member := createUser(t, "Member", "member@example.com", "password")
+	outsider := createUser(t, "Outsider", "outsider@example.com", "password")
+
+	studyGroup, _, err := CreateStudyGroup(models.StudyGroup{
+		UserID:          owner.ID,
+		Name:            "Thermodynamics",
+		AdmissionPolicy: models.AdmissionPolicyAutoAccept,
+		Visibility:      models.VisibilityPublic,
+	})
+	if err != nil { t.Fatal(err) }
+
+	studyGroupID := strconv.Itoa(studyGroup.ID)
+
+	if _, _, _, err := JoinStudyGroup(studyGroupID, strconv.Itoa(member.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	newSession := func() models.StudyGroupSession {
+		t.Helper()
+
+		session, _, err := CreateStudyGroupSession(models.StudyGroupSession{
+			StudyGroupID: studyGroup.ID,
+			StartsOn:     time.Now(),
+			EndsOn:       time.Now().Add(time.Hour),
+		})
+		if err != nil { t.Fatal(err) }
+
+		return session
+	}
+
+	newCode := func(session models.StudyGroupSession) string {
+		t.Helper()
+
+		checkInCode, _, err := NewCheckInCode(studyGroupID, session.ID)
+		if err != nil { t.Fatal(err) }
+
+		return checkInCode.Code
+	}
+
+	attendees := func(session models.StudyGroupSession) int {
+		t.Helper()
+
+		users, _, err := GetSessionAttendees(studyGroupID, session.ID)
+		if err != nil { t.Fatal(err) }
+
+		return len(users)
+	}
+
+	t.Run("valid code", func(t *testing.T) {
+		session := newSession()
+		code := newCode(session)
+
+		for i := 0; i < 2; i++ {
+			if _, err := CheckIn(studyGroupID, session.ID, member.ID, code); err != nil {
+				t.Fatalf("check in %d: %v", i + 1, err)
+			}
+		}
+
+		if n := attendees(session); n != 1 { t.Errorf("attendees = %d, want 1", n) }
+	})
+
+	t.Run("expired code", func(t *testing.T) {
+		session := newSession()
+		code := newCode(session)
+
+		_, err := server.DB.Exec(
+			"UPDATE study_group_sessions SET checkin_code_expires_on = $1 WHERE id = $2",
+			time.Now().Add(-time.Minute),
+			session.ID,
+		)
+		if err != nil { t.Fatal(err) }
+
+		status, err := CheckIn(studyGroupID, session.ID, member.ID, code)
+		if err != models.ErrInvalidCheckInCode || status != http.StatusForbidden {
+			t.Errorf("CheckIn = %d, %v, want %d, %v",
+				status, err, http.StatusForbidden, models.ErrInvalidCheckInCode,
+			)
+		}
+
+		if n := attendees(session); n != 0 { t.Errorf("attendees = %d, want 0", n) }
+	})
+
+	t.Run("cancelled session", func(t *testing.T) {
+		session := newSession()
+		code := newCode(session)
+
+		if _, _, _, err := CancelStudyGroupSession(studyGroupID, session.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		status, err := CheckIn(studyGroupID, session.ID, member.ID, code)
+		if err != models.ErrSessionCancelled || status != http.StatusForbidden {
+			t.Errorf("CheckIn = %d, %v, want %d, %v",
+				status, err, http.StatusForbidden, models.ErrSessionCancelled,
+			)
+		}
+
+		if _, status, err := NewCheckInCode(studyGroupID, session.ID); err != models.ErrSessionCancelled {
+			t.Errorf("NewCheckInCode = %d, %v, want %v", status, err, models.ErrSessionCancelled)
+		}
+	})
+
+	t.Run("non-member", func(t *testing.T) {
+		session := newSession()
+		code := newCode(session)
+
+		status, err := CheckIn(studyGroupID, session.ID, outsider.ID, code)
+		if err != models.ErrNotMember || status != http.StatusForbidden {
+			t.Errorf("CheckIn = %d, %v, want %d, %v",
+				status, err, http.StatusForbidden, models.ErrNotMember,
+			)
+		}
+
+		if n := attendees(session); n != 0 { t.Errorf("attendees = %d, want 0", n) }
+	})
+
+	t.Run("session of another study group", func(t *testing.T) {
+		session := newSession()
+		code := newCode(session)
+
+		status, err := CheckIn(strconv.Itoa(studyGroup.ID + 1), session.ID, member.ID, code)
+		if err != models.ErrSessionNotFound || status != http.StatusNotFound {
+			t.Errorf("CheckIn = %d, %v, want %d, %v",
+				status, err, http.StatusNotFound, models.ErrSessionNotFound,
+			)
+		}
+	})
+}
@@ -3,13 +3,15 @@ package controllers
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
+	"github.com/prosperoa/study-groups/src/query"
 	"github.com/prosperoa/study-groups/src/server"
 )
 
@@ -30,116 +32,107 @@ func GetStudyGroup(id string) (models.StudyGroup, int, error) {
 	return studyGroup, http.StatusOK, nil
 }
 
-func GetStudyGroups(filter models.StudyGroupsFilter, userID int) ([]models.StudyGroup, int, error) {
-	var studyGroups []models.StudyGroup
-
-	query := fmt.Sprintf(
-		"SELECT * FROM study_groups WHERE user_id != %d AND available_spots >= %d",
-		userID,
-		filter.AvailableSpots,
-	)
-
-	query += fmt.Sprintf(`
-		AND %d != ANY(
-			(SELECT	regexp_split_to_array(members, ',')	FROM study_groups)::int[]
-		)`,
-		userID,
-	)
-
-	if filter.StudyGroupName != "" {
-		query += fmt.Sprintf(" AND levenshtein(name, '%s') < 5", filter.StudyGroupName)
+// GetStudyGroups returns a page of the study group search along with where
+// the next page starts. The total is only counted when the filter asks for
+// it.
+func GetStudyGroups(filter models.StudyGroupsFilter, userID int) ([]models.StudyGroup, pagination.Info, int, error) {
+	var page pagination.Info
+	var rows []struct {
+		models.StudyGroup
+		SortKey string `db:"sort_key"`
 	}
 
-	if filter.Location != "" {
-		query += fmt.Sprintf(" AND levenshtein(location, '%s') < 5", filter.Location)
-	}
+	studyGroups := []models.StudyGroup{}
 
-	if filter.MeetingDate != "" {
-		date := strings.Split(filter.MeetingDate, "T")[0]
-		query += fmt.Sprintf(" AND to_char(meeting_date, 'YYYY-MM-DD') LIKE '%s'", date)
-	}
+	sort, err := query.StudyGroupSort(filter)
+	if err != nil { return studyGroups, page, http.StatusBadRequest, err }
 
-	if filter.CourseCode != "" {
-		query += fmt.Sprintf(" AND levenshtein(course ->> 'code', '%s') < 5", filter.CourseCode)
-	}
-
-	if filter.CourseName != "" {
-		query += fmt.Sprintf(" AND levenshtein(course ->> 'name', '%s') < 5", filter.CourseName)
-	}
+	page, err = selectPage(&rows, query.StudyGroups(filter, userID, sort), sort, filter.PageFilter)
 
-	if filter.Instructor != "" {
-		query += fmt.Sprintf(" AND levenshtein(course ->> 'instructor', '%s') < 5", filter.Instructor)
+	switch {
+	case err == pagination.ErrInvalidCursor:
+		return studyGroups, page, http.StatusBadRequest, err
+	case err != nil:
+		log.Println(err.Error())
+		return studyGroups, page, http.StatusInternalServerError, errors.New(
+			"unable to get study groups",
+		)
 	}
 
-	if filter.Term != "" {
-		query += fmt.Sprintf(" AND levenshtein(course ->> 'term', '%s') < 5", filter.Term)
+	for i, row := range rows {
+		if i == filter.PageSize { break }
+		studyGroups = append(studyGroups, row.StudyGroup)
 	}
 
-	query += fmt.Sprintf(" LIMIT %d OFFSET %d", filter.PageSize, filter.PageIndex)
+	if len(studyGroups) > 0 {
+		last := rows[len(studyGroups) - 1]
+		cursor := sort.Cursor(last.SortKey, last.ID)
 
-	if err := server.DB.Select(&studyGroups, query); err != nil {
-		return studyGroups, http.StatusInternalServerError, errors.New(
-			"unable to get study groups",
-		)
+		page.NextCursor, page.HasMore = pagination.Next(len(rows), filter.PageSize, cursor)
 	}
 
-	return studyGroups, http.StatusOK, nil
+	return studyGroups, page, http.StatusOK, nil
 }
 
-func GetStudyGroupMembers(studyGroupID string) (interface{}, int, error) {
-	var (
-		studyGroup models.StudyGroup
-		members []models.User
-		waitlist []models.User
-		users = map[string][]models.User{
-			"members": []models.User{},
-			"waitlist": []models.User{},
-		}
-	)
-	errMsg := errors.New("unable to get study group members")
-
-	getUsers := func (userIDsCSV, usersType string, sgUsers []models.User) error {
-		if userIDsCSV == "" { return nil }
+// selectPage loads the page of q that filter asks for into rows, a pointer
+// to a slice, with one row more than the page size for pagination.Next.
+// The total is counted first when filter asks for it. Cursors that weren't
+// made for sort are ErrInvalidCursor.
+func selectPage(rows interface{}, q *query.Builder, sort pagination.Sort, filter models.PageFilter) (pagination.Info, error) {
+	var page pagination.Info
 
-		query := "SELECT * FROM users WHERE id = "
-		for i, userID := range strings.Split(userIDsCSV, ",") {
-			if i == 0 {
-				query += userID
-				continue
-			}
+	cursor, err := sort.Decode(filter.Cursor)
+	if err != nil { return page, err }
 
-			query += " OR id = " + userID
-		}
+	if filter.Total {
+		total, count := 0, q.Count()
 
-		if err := server.DB.Select(&sgUsers, query); err != nil {
-			return errMsg
+		if err := server.DB.Get(&total, count.SQL(), count.Args()...); err != nil {
+			return page, err
 		}
 
-		users[usersType] = sgUsers
-		return nil
+		page.Total = &total
 	}
 
+	q.Paginate(sort, cursor, filter.PageSize, filter.PageIndex)
 
-	err := server.DB.Get(&studyGroup,
-		`SELECT members, waitlist
-		 FROM study_groups
-		 WHERE id = $1`,
-		studyGroupID,
-	)
+	return page, server.DB.Select(rows, q.SQL(), q.Args()...)
+}
+
+func GetStudyGroupMembers(studyGroupID string) (interface{}, int, error) {
+	var exists bool
+	errMsg := errors.New("unable to get study group members")
+
+	id, _ := strconv.Atoi(studyGroupID)
+
+	err := server.DB.Get(&exists, "SELECT exists(SELECT 1 FROM study_groups WHERE id = $1)", id)
 
 	switch {
-		case err == sql.ErrNoRows:
-			return nil, http.StatusNotFound, errors.New("study group doesn't exist")
 		case err != nil:
 			return nil, http.StatusInternalServerError, errMsg
+		case !exists:
+			return nil, http.StatusNotFound, errors.New("study group doesn't exist")
+	}
+
+	owners, err := models.GetStudyGroupOwners(server.DB, id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errMsg
 	}
 
-	if err = getUsers(studyGroup.Members.String, "members", members); err != nil {
-		return users, http.StatusInternalServerError, err
+	members, err := models.GetStudyGroupMembers(server.DB, id, models.MembershipStatusActive)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errMsg
+	}
+
+	waitlist, err := models.GetStudyGroupUsers(server.DB, id, models.MembershipStatusWaitlisted)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errMsg
 	}
 
-	if err = getUsers(studyGroup.Waitlist.String, "waitlist", waitlist); err != nil {
-		return users, http.StatusInternalServerError, err
+	users := map[string]interface{}{
+		"owners":   owners,
+		"members":  members,
+		"waitlist": waitlist,
 	}
 
 	return users, http.StatusOK, nil
@@ -148,13 +141,16 @@ func GetStudyGroupMembers(studyGroupID string) (interface{}, int, error) {
 func CreateStudyGroup(studyGroup models.StudyGroup) (models.StudyGroup, int, error) {
 	var newStudyGroup models.StudyGroup
 
-	err := server.DB.Get(
-	 &newStudyGroup,
-	 `INSERT INTO study_groups
-			(user_id, name, members_limit, available_spots, location, description, meeting_date, course, created_on, updated_on)
-		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING *`,
+	if studyGroup.Timezone == "" { studyGroup.Timezone = models.DefaultTimezone }
+
+	err := server.Transact(func(tx *sqlx.Tx) error {
+		err := tx.Get(
+		 &newStudyGroup,
+		 `INSERT INTO study_groups
+				(user_id, name, members_limit, available_spots, location, description, meeting_date, timezone, course, admission_policy, visibility, created_on, updated_on)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING *`,
 			studyGroup.UserID,
 			studyGroup.Name,
 			studyGroup.MembersLimit,
@@ -162,358 +158,246 @@ func CreateStudyGroup(studyGroup models.StudyGroup) (models.StudyGroup, int, err
 			studyGroup.Location,
 			studyGroup.Description,
 			studyGroup.MeetingDate,
+			studyGroup.Timezone,
 			studyGroup.Course,
+			studyGroup.AdmissionPolicy,
+			studyGroup.Visibility,
 			time.Now(),
 			time.Now(),
 		)
+		if err != nil { return err }
 
-		if err != nil {
-			log.Println(err.Error())
-			return newStudyGroup, http.StatusInternalServerError,
-				errors.New("unable to create study group")
+		owner := models.StudyGroupMembership{
+			UserID:       newStudyGroup.UserID,
+			StudyGroupID: newStudyGroup.ID,
+			Role:         models.MembershipRoleOwner,
+			Status:       models.MembershipStatusActive,
 		}
 
-		return newStudyGroup, http.StatusOK, nil
-}
-
-func UpdateStudyGroup(studyGroup models.StudyGroup) (models.StudyGroup, int, error) {
-	var updatedStudyGroup models.StudyGroup
-
-	_, err := server.DB.Exec(
-	 `UPDATE study_groups
-		SET
-			name          = $1,
-			members_limit = $2,
-			description   = $3,
-			meeting_date  = $4,
-			location      = $5
-		WHERE id = $6
-		RETURNING *`,
-		studyGroup.Name,
-		studyGroup.MembersLimit,
-		studyGroup.Description,
-		studyGroup.MeetingDate,
-		studyGroup.Location,
-		studyGroup.ID,
-	)
+		return owner.Create(tx)
+	})
 
 	if err != nil {
-		return updatedStudyGroup, http.StatusInternalServerError,
-			errors.New("unable to update study group")
+		log.Println(err.Error())
+		return newStudyGroup, http.StatusInternalServerError,
+			errors.New("unable to create study group")
 	}
 
-	return updatedStudyGroup, http.StatusOK, nil
+	return newStudyGroup, http.StatusOK, nil
 }
 
-func DeleteStudyGroup(studyGroupID, userID string) (int, error) {
-	var studyGroup models.StudyGroup
-
-	internalErr := func () (int, error) {
-		return http.StatusInternalServerError, errors.New("unable delete study group")
-	}
+// UpdateStudyGroup saves the study group's details. Open spots are
+// recounted against the new members limit and, with the auto promote
+// policy, filled from the waitlist; the IDs of promoted users are returned.
+func UpdateStudyGroup(studyGroup models.StudyGroup) (models.StudyGroup, []int, int, error) {
+	var promoted []int
+
+	updatedStudyGroup, status, err := studyGroupTx(studyGroup.ID, "unable to update study group",
+		func(tx *sqlx.Tx, updatedStudyGroup *models.StudyGroup) (err error) {
+			err = tx.Get(
+			 updatedStudyGroup,
+			 `UPDATE study_groups
+				SET
+					name             = $1,
+					members_limit    = $2,
+					description      = $3,
+					meeting_date     = $4,
+					timezone         = COALESCE(NULLIF($12, ''), timezone),
+					location         = $5,
+					admission_policy = COALESCE(NULLIF($6, ''), admission_policy),
+					visibility       = COALESCE(NULLIF($11, ''), visibility),
+					available_spots  = GREATEST(0, $2 - (
+						SELECT count(*) FROM study_group_memberships
+						WHERE study_group_id = $8 AND status = $9 AND role <> $10
+					)),
+					updated_on       = $7
+				WHERE id = $8
+				RETURNING *`,
+				studyGroup.Name,
+				studyGroup.MembersLimit,
+				studyGroup.Description,
+				studyGroup.MeetingDate,
+				studyGroup.Location,
+				studyGroup.AdmissionPolicy,
+				time.Now(),
+				studyGroup.ID,
+				models.MembershipStatusActive,
+				models.MembershipRoleOwner,
+				studyGroup.Visibility,
+				studyGroup.Timezone,
+			)
+			if err != nil { return err }
 
-	err := server.DB.Get(
-	 &studyGroup,
-	 "SELECT members, waitlist FROM study_groups WHERE id = $1 AND user_id = $2",
-		studyGroupID, userID,
+			promoted, err = updatedStudyGroup.PromoteFromWaitlist(tx)
+			return err
+		},
 	)
 
-	if err != nil {	return internalErr() }
-
-	var studyGroupUserIDs []string
-	membersCSV := studyGroup.Members.String
-	waitlistCSV := studyGroup.Waitlist.String
-
-	if membersCSV != "" {
-		studyGroupUserIDs = append(
-			studyGroupUserIDs,
-			strings.Split(membersCSV, ",")...
-		)
-	}
-
-	if waitlistCSV != "" {
-		studyGroupUserIDs = append(
-			studyGroupUserIDs,
-			strings.Split(waitlistCSV, ",")...
-		)
-	}
-
-	if studyGroupUserIDs != nil {
-		query := "SELECT id, study_groups, waitlists FROM users WHERE id = " + studyGroupUserIDs[0]
-
-		for i := 1; i < len(studyGroupUserIDs); i++ {
-			query += " OR id = " + studyGroupUserIDs[i]
-		}
-
-		var users []models.User
-		if err = server.DB.Select(&users, query); err != nil {
-			return internalErr()
-		}
-
-		{
-			tx, err := server.DB.Begin()
-
-			defer func() (int, error) {
-				if err != nil {
-					log.Println(err.Error())
-					tx.Rollback()
-					return internalErr()
-				}
-
-				return 0, nil
-			}()
-
-			for _, user := range users {
-				user.LeaveStudyGroup(studyGroupID)
-
-				_, err = tx.Exec(
-				 "UPDATE users SET study_groups = $1, waitlists = $2 WHERE id = $3",
-					user.StudyGroups,
-					user.Waitlists,
-					user.ID,
-				)
-			}
-
-			_, err = tx.Exec("DELETE FROM study_groups WHERE id = $1", studyGroupID)
-			err = tx.Commit()
-		}
-	}
-
-	return http.StatusOK, nil
+	return updatedStudyGroup, promoted, status, err
 }
 
-func JoinStudyGroup(studyGroupID, userID string) (models.StudyGroup, int, error) {
-	var user models.User
-	var studyGroup models.StudyGroup
-
-	internalErr := func() (models.StudyGroup, int, error) {
-		return studyGroup, http.StatusInternalServerError, errors.New("unable to join study group")
-	}
-
-	err := server.DB.Get(
-		&studyGroup,
-		"SELECT user_id, members, waitlist, available_spots FROM study_groups WHERE id = $1",
-		studyGroupID,
+// DeleteStudyGroup deletes the study group and returns it along with the
+// members it had, so they can be told about it. Any of its owners may
+// delete it.
+func DeleteStudyGroup(studyGroupID string) (models.StudyGroup, models.Users, int, error) {
+	var members models.Users
+
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable delete study group",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) (err error) {
+			members, err = models.GetStudyGroupUsers(tx, studyGroup.ID, models.MembershipStatusActive)
+			if err != nil { return err }
+
+			// memberships are removed along with the study group by ON DELETE CASCADE
+			_, err = tx.Exec("DELETE FROM study_groups WHERE id = $1", studyGroup.ID)
+			return err
+		},
 	)
 
-	switch {
-	case err == sql.ErrNoRows:
-		return studyGroup, http.StatusNotFound, errors.New("study group not found")
-	case err != nil:
-		return internalErr()
-	}
+	return studyGroup, members, status, err
+}
 
-	err = server.DB.Get(
-		&user,
-		"SELECT study_groups, waitlists FROM users WHERE id = $1",
-		userID,
+// JoinStudyGroup returns the user's new membership, which tells whether
+// they were let in right away or put on the waitlist.
+func JoinStudyGroup(studyGroupID, userID string) (models.StudyGroup, models.StudyGroupMembership, int, error) {
+	var membership models.StudyGroupMembership
+	uID, _ := strconv.Atoi(userID)
+
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to join study group",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) (err error) {
+			membership, err = studyGroup.Join(tx, uID)
+			return err
+		},
 	)
 
-	switch {
-	case err == sql.ErrNoRows:
-		return studyGroup, http.StatusNotFound, errors.New("user not found")
-	case err != nil:
-		return internalErr()
-	}
-
-	if err = studyGroup.AddUserToWaitlist(userID); err != nil {
-		return studyGroup, http.StatusForbidden, err
-	}
-	if err = user.AddStudyGroupToWaitlists(studyGroupID); err != nil {
-		return studyGroup, http.StatusForbidden, err
-	}
-
-	{
-		tx, err := server.DB.Begin()
-		if err != nil {
-			return internalErr()
-		}
-
-		defer func() (models.StudyGroup, int, error) {
-			if err != nil {
-				log.Println(err.Error())
-				tx.Rollback()
-				return internalErr()
-			}
-
-			return studyGroup, 0, nil
-		}()
-
-		if studyGroup.Waitlist.String == "" {
-			_, err = tx.Exec(
-				"UPDATE study_groups SET waitlist = null, available_spots = $1 WHERE id = $2",
-				studyGroup.AvailableSpots,
-				studyGroupID,
-			)
-		} else {
-			_, err = tx.Exec(
-				"UPDATE study_groups SET waitlist = $1, available_spots = $2 WHERE id = $3",
-				studyGroup.Waitlist.String,
-				studyGroup.AvailableSpots,
-				studyGroupID,
-			)
-		}
-
-		if user.Waitlists.String == "" {
-			_, err = tx.Exec(
-			 "UPDATE users SET waitlists = null WHERE id = $1",
-				userID,
-			)
-		} else {
-			_, err = tx.Exec(
-			 "UPDATE users SET waitlists = $1 WHERE id = $2",
-				user.Waitlists.String,
-				userID,
-			)
-		}
-
-		err = tx.Commit()
-	}
-
-	return studyGroup, http.StatusOK, nil
+	return studyGroup, membership, status, err
 }
 
 func MoveUserFromWaitlistToMembers(studyGroupID, userID string) (models.StudyGroup, int, error) {
-	var user models.User
-	var studyGroup models.StudyGroup
+	uID, _ := strconv.Atoi(userID)
 
-	internalErr := func() (models.StudyGroup, int, error) {
-		return studyGroup, http.StatusInternalServerError, errors.New("unable to move user into members")
-	}
-
-	err := server.DB.Get(&studyGroup, "SELECT * FROM study_groups WHERE id = $1", studyGroupID)
-	if err != nil {	return internalErr() }
-
-	if err := studyGroup.MoveUserFromWaitlistToMembers(userID); err != nil {
-		return studyGroup, http.StatusForbidden, err
-	}
+	return studyGroupTx(studyGroupID, "unable to move user into members",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			return studyGroup.MoveUserFromWaitlistToMembers(tx, uID)
+		},
+	)
+}
 
-	err = server.DB.Get(&user, "SELECT * FROM users WHERE id = $1", userID)
-	if err != nil {	return internalErr() }
+// LeaveStudyGroup returns the IDs of the users promoted from the waitlist
+// into the spot the user left open.
+func LeaveStudyGroup(studyGroupID, userID string) (models.StudyGroup, []int, int, error) {
+	var promoted []int
+	uID, _ := strconv.Atoi(userID)
+
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to leave study group",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) (err error) {
+			promoted, err = studyGroup.RemoveUser(tx, uID)
+			return err
+		},
+	)
 
-	{
-		tx, err := server.DB.Begin()
-		if err != nil {	return internalErr() }
+	return studyGroup, promoted, status, err
+}
 
-		defer func() (models.StudyGroup, int, error) {
-			if err != nil {
-				log.Println(err.Error())
-				tx.Rollback()
+func RejectWaitlistedUser(studyGroupID string, userID int, ban bool) (models.StudyGroup, int, error) {
+	return studyGroupTx(studyGroupID, "unable to reject user",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			return studyGroup.RejectWaitlistedUser(tx, userID, ban)
+		},
+	)
+}
 
-				return internalErr()
-			}
+// RemoveMember returns the IDs of the users promoted from the waitlist into
+// the removed member's spot.
+func RemoveMember(studyGroupID string, userID int, ban bool) (models.StudyGroup, []int, int, error) {
+	var promoted []int
 
-			return studyGroup, 0, nil
-		}()
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to remove member",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) (err error) {
+			promoted, err = studyGroup.RemoveMember(tx, userID, ban)
+			return err
+		},
+	)
 
-		_, err = tx.Exec(
-			"UPDATE study_groups SET members = $1, waitlist = $2 WHERE id = $3",
-			studyGroup.Members,
-			studyGroup.Waitlist,
-			studyGroup.ID,
-		)
+	return studyGroup, promoted, status, err
+}
 
-		_, err = tx.Exec(
-			"UPDATE users SET study_groups = $1, waitlists = $2 WHERE id = $3",
-			user.StudyGroups,
-			user.Waitlists,
-			user.ID,
-		)
+// SetMemberRole returns the IDs of the users promoted from the waitlist
+// into spots opened up by the role change.
+func SetMemberRole(studyGroupID string, userID int, role string) (models.StudyGroup, []int, int, error) {
+	var promoted []int
 
-		err = tx.Commit()
-	}
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to change member role",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) (err error) {
+			promoted, err = studyGroup.SetMemberRole(tx, userID, role)
+			return err
+		},
+	)
 
-	return studyGroup, http.StatusOK, nil
+	return studyGroup, promoted, status, err
 }
 
-func LeaveStudyGroup(studyGroupID, userID string) (int, error) {
-	var user models.User
-	var studyGroup models.StudyGroup
-
-	internalErr := func() (int, error) {
-		return http.StatusInternalServerError, errors.New("unable to leave study group")
-	}
+// TransferOwnership returns the IDs of the users promoted from the waitlist
+// into the spot the new owner left open.
+func TransferOwnership(studyGroupID string, fromUserID, toUserID int) (models.StudyGroup, []int, int, error) {
+	var promoted []int
 
-	err := server.DB.Get(
-		&studyGroup,
-		"SELECT user_id, members, waitlist, available_spots FROM study_groups WHERE id = $1",
-		studyGroupID,
+	studyGroup, status, err := studyGroupTx(studyGroupID, "unable to transfer ownership",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) (err error) {
+			promoted, err = studyGroup.TransferOwnership(tx, fromUserID, toUserID)
+			return err
+		},
 	)
 
-	switch {
-	case err == sql.ErrNoRows:
-		return http.StatusNotFound, errors.New("study group not found")
-	case err != nil:
-		return internalErr()
-	}
+	return studyGroup, promoted, status, err
+}
 
-	err = server.DB.Get(
-		&user,
-		"SELECT study_groups, waitlists FROM users WHERE id = $1",
-		userID,
+func UnbanUser(studyGroupID string, userID int) (int, error) {
+	_, status, err := studyGroupTx(studyGroupID, "unable to unban user",
+		func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error {
+			return studyGroup.Unban(tx, userID)
+		},
 	)
 
-	switch {
-	case err == sql.ErrNoRows:
-		return http.StatusNotFound, errors.New("user not found")
-	case err != nil:
-		return internalErr()
-	}
-
-	sgColumnName, sgColumnVal, err := studyGroup.RemoveUser(userID)
-	if err != nil {
-		return http.StatusForbidden, err
-	}
+	return status, err
+}
 
-	uColumnName, uColumnVal, err := user.LeaveStudyGroup(studyGroupID)
-	if err != nil {
-		return http.StatusForbidden, err
-	}
+// studyGroupTx locks the study group and runs fn against it in a single
+// transaction. Membership and session rule violations come back as 403s, a
+// missing study group or session as a 404 and anything else as a 500 with
+// errMsg.
+func studyGroupTx(
+	studyGroupID interface{},
+	errMsg string,
+	fn func(tx *sqlx.Tx, studyGroup *models.StudyGroup) error,
+) (models.StudyGroup, int, error) {
+	var studyGroup models.StudyGroup
 
-	{
-		tx, err := server.DB.Begin()
-		if err != nil {
-			return internalErr()
+	err := server.Transact(func(tx *sqlx.Tx) error {
+		if err := studyGroup.GetForUpdate(tx, studyGroupID); err != nil {
+			return err
 		}
 
-		defer func() (int, error) {
-			if err != nil {
-				log.Println(err.Error())
-				tx.Rollback()
-				return internalErr()
-			}
-
-			return 0, nil
-		}()
-
-		if sgColumnVal.String == "" {
-			_, err = tx.Exec(
-				"UPDATE study_groups SET "+sgColumnName+" = null, available_spots = $1 WHERE id = $2",
-				studyGroup.AvailableSpots,
-				studyGroupID,
-			)
-		} else {
-			_, err = tx.Exec(
-				"UPDATE study_groups SET "+sgColumnName+" = $1, available_spots = $2 WHERE id = $3",
-				sgColumnVal.String,
-				studyGroup.AvailableSpots,
-				studyGroupID,
-			)
-		}
+		return fn(tx, &studyGroup)
+	})
 
-		if uColumnVal.String == "" {
-			_, err = tx.Exec("UPDATE users SET "+uColumnName+" = null WHERE id = $1",
-				userID,
-			)
-		} else {
-			_, err = tx.Exec("UPDATE users SET "+uColumnName+" = $1 WHERE id = $2",
-				uColumnVal.String,
-				userID,
-			)
-		}
+	status, err := txStatus(err, errMsg)
+	return studyGroup, status, err
+}
 
-		err = tx.Commit()
+// txStatus is the status of a transaction run by studyGroupTx or sessionTx
+// that ended with err, along with the error to respond with.
+func txStatus(err error, errMsg string) (int, error) {
+	switch {
+	case err == nil:
+		return http.StatusOK, nil
+	case err == sql.ErrNoRows:
+		return http.StatusNotFound, errors.New("study group not found")
+	case err == models.ErrSessionNotFound, err == models.ErrInviteNotFound:
+		return http.StatusNotFound, err
+	case models.IsMembershipError(err), models.IsSessionError(err), models.IsInviteError(err):
+		return http.StatusForbidden, err
 	}
 
-	return http.StatusOK, nil
+	log.Println(err.Error())
+	return http.StatusInternalServerError, errors.New(errMsg)
 }
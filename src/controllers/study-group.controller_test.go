@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
+	"github.com/prosperoa/study-groups/src/query"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/testdb"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestConcurrentJoinsTakeOneSpot(t *testing.T) {
+	const joiners = 20
+
+	testdb.Open(t, "users", "email_outbox")
+
+	owner := createUser(t, "Owner", "owner@example.com", "password")
+
+	studyGroup, _, err := CreateStudyGroup(models.StudyGroup{
+		UserID:          owner.ID,
+		Name:            "Linear Algebra",
+		MembersLimit:    null.IntFrom(1),
+		AdmissionPolicy: models.AdmissionPolicyAutoAccept,
+		Visibility:      models.VisibilityPublic,
+	})
+	if err != nil { t.Fatal(err) }
+
+	userIDs := make([]string, joiners)
+	for i := range userIDs {
+		user := createUser(t, "User", fmt.Sprintf("user%d@example.com", i), "password")
+		userIDs[i] = strconv.Itoa(user.ID)
+	}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, joiners)
+
+	for _, userID := range userIDs {
+		wg.Add(1)
+
+		go func(userID string) {
+			defer wg.Done()
+			<-start
+
+			if _, _, _, err := JoinStudyGroup(strconv.Itoa(studyGroup.ID), userID); err != nil {
+				errs <- err
+			}
+		}(userID)
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs { t.Errorf("join failed: %v", err) }
+
+	counts := map[string]int{}
+	rows := []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}{}
+
+	err = server.DB.Select(&rows,
+	 `SELECT status, count(*) FROM study_group_memberships
+		WHERE study_group_id = $1 AND role <> $2
+		GROUP BY status`,
+		studyGroup.ID,
+		models.MembershipRoleOwner,
+	)
+	if err != nil { t.Fatal(err) }
+
+	for _, row := range rows { counts[row.Status] = row.Count }
+
+	if counts[models.MembershipStatusActive] != 1 {
+		t.Errorf("%d members, want 1", counts[models.MembershipStatusActive])
+	}
+
+	if counts[models.MembershipStatusWaitlisted] != joiners - 1 {
+		t.Errorf("%d waitlisted, want %d", counts[models.MembershipStatusWaitlisted], joiners - 1)
+	}
+
+	var availableSpots int
+	err = server.DB.Get(&availableSpots, "SELECT available_spots FROM study_groups WHERE id = $1", studyGroup.ID)
+	if err != nil { t.Fatal(err) }
+
+	if availableSpots != 0 { t.Errorf("%d available spots, want 0", availableSpots) }
+}
+
+// createStudyGroups adds a public study group owned by owner for each name,
+// with the course of the same index. The nth group has n + 1 spots.
+func createStudyGroups(t *testing.T, owner models.User, names []string, courses ...string) []models.StudyGroup {
+	t.Helper()
+
+	studyGroups := make([]models.StudyGroup, len(names))
+
+	for i, name := range names {
+		course := courses[i]
+
+		studyGroup, _, err := CreateStudyGroup(models.StudyGroup{
+			UserID:          owner.ID,
+			Name:            name,
+			MembersLimit:    null.IntFrom(int64(i + 1)),
+			Location:        null.StringFrom("Library"),
+			MeetingDate:     null.StringFrom("2024-05-06T17:00:00Z"),
+			Course:          types.NullJSONText{JSONText: types.JSONText(course), Valid: course != ""},
+			AdmissionPolicy: models.AdmissionPolicyManual,
+			Visibility:      models.VisibilityPublic,
+		})
+		if err != nil { t.Fatal(err) }
+
+		studyGroups[i] = studyGroup
+	}
+
+	return studyGroups
+}
+
+// Every filter and sort runs against the database, so a search that isn't
+// valid SQL fails here rather than with a 500.
+func TestGetStudyGroupsFilters(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	owner := createUser(t, "Owner", "owner@example.com", "password")
+	searcher := createUser(t, "Searcher", "searcher@example.com", "password")
+
+	studyGroups := createStudyGroups(t, owner,
+		[]string{"Eigenvalue Crew", "Titration Squad", "Quiet Readers"},
+		`{"code": "MATH 221", "name": "Linear Algebra", "instructor": "Gilbert Strang", "term": "Fall 2024"}`,
+		`{"code": "CHEM 101", "name": "General Chemistry", "instructor": "Marie Curie", "term": "Spring 2025"}`,
+		"",
+	)
+
+	base := models.StudyGroupsFilter{
+		PageFilter:     page(10),
+		AvailableSpots: 1,
+	}
+
+	tests := []struct {
+		name   string
+		filter func(*models.StudyGroupsFilter)
+		want   []int
+	}{
+		{"no filter", func(f *models.StudyGroupsFilter) {}, []int{2, 1, 0}},
+		{"q", func(f *models.StudyGroupsFilter) { f.Q = "linear" }, []int{0}},
+		{"name", func(f *models.StudyGroupsFilter) { f.StudyGroupName = "Titration Squad" }, []int{1}},
+		{"location", func(f *models.StudyGroupsFilter) { f.Location = "Library" }, []int{2, 1, 0}},
+		{"meeting date", func(f *models.StudyGroupsFilter) { f.MeetingDate = "2024-05-06T09:00:00Z" }, []int{2, 1, 0}},
+		{"course code", func(f *models.StudyGroupsFilter) { f.CourseCode = "CHEM 101" }, []int{1}},
+		{"course name", func(f *models.StudyGroupsFilter) { f.CourseName = "Linear Algebra" }, []int{0}},
+		{"instructor", func(f *models.StudyGroupsFilter) { f.Instructor = "Marie Curie" }, []int{1}},
+		{"term", func(f *models.StudyGroupsFilter) { f.Term = "Fall 2024" }, []int{0}},
+		{"available spots", func(f *models.StudyGroupsFilter) { f.AvailableSpots = 2 }, []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := base
+			filter.Total = true
+			tt.filter(&filter)
+
+			got, page, status, err := GetStudyGroups(filter, searcher.ID)
+			if err != nil { t.Fatalf("status %d: %v", status, err) }
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("found %d study groups, want %d: %+v", len(got), len(tt.want), got)
+			}
+
+			for i, want := range tt.want {
+				if got[i].ID != studyGroups[want].ID {
+					t.Errorf("result %d is %q, want %q", i, got[i].Name, studyGroups[want].Name)
+				}
+			}
+
+			if page.Total == nil || *page.Total != len(tt.want) {
+				t.Errorf("total = %v, want %d", page.Total, len(tt.want))
+			}
+		})
+	}
+
+	// owners don't find their own groups
+	got, _, _, err := GetStudyGroups(base, owner.ID)
+	if err != nil { t.Fatal(err) }
+
+	if len(got) != 0 { t.Errorf("owner found %d of their own study groups", len(got)) }
+}
+
+// Cursors are checked before any query runs, so no database is needed.
+func TestGetStudyGroupsRejectsCursorsOfOtherSorts(t *testing.T) {
+	filter := func(sort, q, cursor string) models.StudyGroupsFilter {
+		f := models.StudyGroupsFilter{
+			PageFilter:     page(10),
+			Q:              q,
+			Sort:           sort,
+			AvailableSpots: 1,
+		}
+		f.Cursor = cursor
+
+		return f
+	}
+
+	cursor := func(f models.StudyGroupsFilter, key string) string {
+		sort, err := query.StudyGroupSort(f)
+		if err != nil { t.Fatal(err) }
+
+		return sort.Cursor(key, 1).Encode()
+	}
+
+	created := cursor(filter(query.SortCreated, "", ""), "2024-05-06 17:00:00")
+	relevance := cursor(filter("", "calculus", ""), "0.5")
+
+	tests := []struct {
+		name   string
+		filter models.StudyGroupsFilter
+	}{
+		{"created cursor sorted by spots", filter(query.SortAvailableSpots, "", created)},
+		{"created cursor sorted by meeting", filter(query.SortMeetingDate, "", created)},
+		{"relevance cursor for another search", filter("", "chemistry", relevance)},
+		{"relevance cursor sorted by created", filter(query.SortCreated, "calculus", relevance)},
+		{"edited key", filter(query.SortAvailableSpots, "", cursor(filter(query.SortAvailableSpots, "", ""), "lots"))},
+	}
+
+	for _, tt := range tests {
+		_, _, status, err := GetStudyGroups(tt.filter, 1)
+
+		if status != http.StatusBadRequest || err != pagination.ErrInvalidCursor {
+			t.Errorf("%s: status %d, %v, want 400 invalid cursor", tt.name, status, err)
+		}
+	}
+}
+
+// Paging with cursors finds every group once, whatever the sort.
+func TestGetStudyGroupsPages(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	owner := createUser(t, "Owner", "owner@example.com", "password")
+	searcher := createUser(t, "Searcher", "searcher@example.com", "password")
+
+	names := []string{"Calculus I", "Calculus II", "Calculus III", "Calculus IV", "Calculus V"}
+	createStudyGroups(t, owner, names, "", "", "", "", "")
+
+	sorts := []string{query.SortRelevance, query.SortMeetingDate, query.SortCreated, query.SortAvailableSpots}
+
+	for _, sort := range sorts {
+		filter := models.StudyGroupsFilter{
+			PageFilter:     page(2),
+			Q:              "calculus",
+			Sort:           sort,
+			AvailableSpots: 1,
+		}
+
+		seen := map[int]bool{}
+
+		for pages := 0; pages < len(names); pages++ {
+			studyGroups, page, status, err := GetStudyGroups(filter, searcher.ID)
+			if err != nil { t.Fatalf("%s: status %d: %v", sort, status, err) }
+
+			for _, studyGroup := range studyGroups {
+				if seen[studyGroup.ID] { t.Errorf("%s: %q on two pages", sort, studyGroup.Name) }
+				seen[studyGroup.ID] = true
+			}
+
+			if !page.HasMore { break }
+			filter.Cursor = page.NextCursor
+		}
+
+		if len(seen) != len(names) {
+			t.Errorf("%s: paged through %d study groups, want %d", sort, len(seen), len(names))
+		}
+	}
+}
+
+// Groups sort by their next upcoming meeting, whether it comes from a
+// session, the schedule or the meeting date. Past meetings don't count.
+func TestGetStudyGroupsSortsByNextMeeting(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	owner := createUser(t, "Owner", "owner@example.com", "password")
+	searcher := createUser(t, "Searcher", "searcher@example.com", "password")
+
+	studyGroups := createStudyGroups(t, owner,
+		[]string{"Stale", "Scheduled", "Dated", "Session", "Nothing"},
+		"", "", "", "", "",
+	)
+
+	now := time.Now().UTC()
+	day := time.Hour * 24
+
+	stmts := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{"UPDATE study_groups SET meeting_date = $2 WHERE id = $1", []interface{}{studyGroups[0].ID, now.Add(-day * 3)}},
+		{
+			"INSERT INTO study_group_occurrences (study_group_id, starts_on, local_date) VALUES ($1, $2, $2::date), ($1, $3, $3::date)",
+			[]interface{}{studyGroups[1].ID, now.Add(-day), now.Add(day * 2)},
+		},
+		{"UPDATE study_groups SET meeting_date = NULL WHERE id = $1", []interface{}{studyGroups[1].ID}},
+		{"UPDATE study_groups SET meeting_date = $2 WHERE id = $1", []interface{}{studyGroups[2].ID, now.Add(day * 5)}},
+		{
+		 `INSERT INTO study_group_sessions (study_group_id, starts_on, ends_on, created_on, updated_on)
+			VALUES ($1, $2, $2::timestamp + interval '1 hour', $3, $3)`,
+			[]interface{}{studyGroups[3].ID, now.Add(day), now},
+		},
+		{"UPDATE study_groups SET meeting_date = NULL WHERE id IN ($1, $2)", []interface{}{studyGroups[3].ID, studyGroups[4].ID}},
+	}
+
+	for _, stmt := range stmts {
+		if _, err := server.DB.Exec(stmt.sql, stmt.args...); err != nil { t.Fatal(err) }
+	}
+
+	filter := models.StudyGroupsFilter{
+		PageFilter:     page(10),
+		Sort:           query.SortMeetingDate,
+		AvailableSpots: 1,
+	}
+
+	got, _, status, err := GetStudyGroups(filter, searcher.ID)
+	if err != nil { t.Fatalf("status %d: %v", status, err) }
+
+	// groups without upcoming meetings come last, in ID order
+	want := []int{3, 1, 2, 0, 4}
+
+	if len(got) != len(want) { t.Fatalf("found %d study groups, want %d", len(got), len(want)) }
+
+	for i, j := range want {
+		if got[i].ID != studyGroups[j].ID {
+			t.Errorf("result %d is %q, want %q", i, got[i].Name, studyGroups[j].Name)
+		}
+	}
+}
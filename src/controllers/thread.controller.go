@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
+	"github.com/prosperoa/study-groups/src/query"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+// GetThreads returns a page of the study group's threads, the most
+// recently active first, along with where the next page starts.
+func GetThreads(studyGroupID string, filter models.PageFilter) ([]models.Thread, pagination.Info, int, error) {
+	var rows []struct {
+		models.Thread
+		SortKey string `db:"sort_key"`
+	}
+
+	id, _ := strconv.Atoi(studyGroupID)
+	threads := []models.Thread{}
+	sort := query.ThreadsSort
+
+	page, err := selectPage(&rows, query.Threads(id), sort, filter)
+
+	switch {
+	case err == pagination.ErrInvalidCursor:
+		return threads, page, http.StatusBadRequest, err
+	case err != nil:
+		log.Println(err.Error())
+		return threads, page, http.StatusInternalServerError, errors.New(
+			"unable to get threads",
+		)
+	}
+
+	for i, row := range rows {
+		if i == filter.PageSize { break }
+		threads = append(threads, row.Thread)
+	}
+
+	if len(threads) > 0 {
+		last := rows[len(threads) - 1]
+		cursor := sort.Cursor(last.SortKey, last.ID)
+
+		page.NextCursor, page.HasMore = pagination.Next(len(rows), filter.PageSize, cursor)
+	}
+
+	return threads, page, http.StatusOK, nil
+}
+
+func GetThread(studyGroupID string, threadID int) (models.Thread, int, error) {
+	thread := models.Thread{ID: threadID}
+	thread.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	err := thread.Get(server.DB)
+	status, err := threadStatus(err, "unable to get thread")
+
+	return thread, status, err
+}
+
+// CreateThread starts a thread in the study group with body as its first
+// message.
+func CreateThread(studyGroupID string, userID int, title, body string) (models.Thread, models.Message, int, error) {
+	var message models.Message
+
+	thread := models.Thread{UserID: null.IntFrom(int64(userID)), Title: title}
+	thread.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	err := server.Transact(func(tx *sqlx.Tx) (err error) {
+		message, err = thread.Create(tx, body)
+		return err
+	})
+	status, err := threadStatus(err, "unable to create thread")
+
+	return thread, message, status, err
+}
+
+func LockThread(studyGroupID string, threadID int, locked bool) (models.Thread, int, error) {
+	thread := models.Thread{ID: threadID}
+	thread.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	err := server.Transact(func(tx *sqlx.Tx) error {
+		if err := thread.GetForUpdate(tx); err != nil {
+			return err
+		}
+
+		return thread.SetLocked(tx, locked)
+	})
+	status, err := threadStatus(err, "unable to lock thread")
+
+	return thread, status, err
+}
+
+func DeleteThread(studyGroupID string, threadID int, membership models.StudyGroupMembership) (int, error) {
+	thread := models.Thread{ID: threadID}
+	thread.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	err := server.Transact(func(tx *sqlx.Tx) error {
+		if err := thread.GetForUpdate(tx); err != nil {
+			return err
+		}
+
+		return thread.Delete(tx, membership)
+	})
+
+	return threadStatus(err, "unable to delete thread")
+}
+
+// GetMessages returns a page of the thread's messages, oldest first, along
+// with where the next page starts.
+func GetMessages(studyGroupID string, threadID int, filter models.PageFilter) ([]models.Message, pagination.Info, int, error) {
+	var page pagination.Info
+	var rows []struct {
+		models.Message
+		SortKey string `db:"sort_key"`
+	}
+
+	messages := []models.Message{}
+	sort := query.MessagesSort
+
+	thread, status, err := GetThread(studyGroupID, threadID)
+	if err != nil { return messages, page, status, err }
+
+	page, err = selectPage(&rows, query.Messages(thread.ID), sort, filter)
+
+	if err == pagination.ErrInvalidCursor {
+		return messages, page, http.StatusBadRequest, err
+	}
+
+	status, err = threadStatus(err, "unable to get messages")
+	if err != nil { return messages, page, status, err }
+
+	for i, row := range rows {
+		if i == filter.PageSize { break }
+		messages = append(messages, row.Message)
+	}
+
+	if len(messages) > 0 {
+		last := rows[len(messages) - 1]
+		cursor := sort.Cursor(last.SortKey, last.ID)
+
+		page.NextCursor, page.HasMore = pagination.Next(len(rows), filter.PageSize, cursor)
+	}
+
+	return messages, page, status, nil
+}
+
+func PostMessage(studyGroupID string, threadID, userID int, body string) (models.Message, int, error) {
+	var message models.Message
+
+	thread := models.Thread{ID: threadID}
+	thread.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	err := server.Transact(func(tx *sqlx.Tx) (err error) {
+		if err = thread.GetForUpdate(tx); err != nil {
+			return err
+		}
+
+		message, err = thread.AddMessage(tx, userID, body)
+		return err
+	})
+	status, err := threadStatus(err, "unable to post message")
+
+	return message, status, err
+}
+
+func EditMessage(studyGroupID string, threadID, messageID, userID int, body string) (models.Message, int, error) {
+	message := models.Message{ID: messageID}
+
+	err := messageTx(studyGroupID, threadID, &message, func(tx *sqlx.Tx) error {
+		return message.Edit(tx, userID, body)
+	})
+	status, err := threadStatus(err, "unable to edit message")
+
+	return message, status, err
+}
+
+func DeleteMessage(studyGroupID string, threadID, messageID int, membership models.StudyGroupMembership) (int, error) {
+	message := models.Message{ID: messageID}
+
+	err := messageTx(studyGroupID, threadID, &message, func(tx *sqlx.Tx) error {
+		return message.Delete(tx, membership)
+	})
+
+	return threadStatus(err, "unable to delete message")
+}
+
+// messageTx loads the message, making sure it belongs to a thread of the
+// study group that is still around, and runs fn in the same transaction.
+// Messages of locked threads can still be edited and deleted.
+func messageTx(studyGroupID string, threadID int, message *models.Message, fn func(tx *sqlx.Tx) error) error {
+	thread := models.Thread{ID: threadID}
+	thread.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	return server.Transact(func(tx *sqlx.Tx) error {
+		if err := thread.Get(tx); err != nil {
+			return err
+		}
+
+		message.ThreadID = thread.ID
+
+		if err := message.GetForUpdate(tx); err != nil {
+			return err
+		}
+
+		return fn(tx)
+	})
+}
+
+// threadStatus maps the error of a thread or message action to a status.
+// Missing threads and messages come back as 404s, other rule violations as
+// 403s and anything else as a 500 with errMsg.
+func threadStatus(err error, errMsg string) (int, error) {
+	switch {
+	case err == nil:
+		return http.StatusOK, nil
+	case err == models.ErrThreadNotFound, err == models.ErrMessageNotFound:
+		return http.StatusNotFound, err
+	case models.IsThreadError(err):
+		return http.StatusForbidden, err
+	}
+
+	log.Println(err.Error())
+	return http.StatusInternalServerError, errors.New(errMsg)
+}
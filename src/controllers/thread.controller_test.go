@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/testdb"
+)
+
+func TestGetThreadsAndMessagesPage(t *testing.T) {
+	testdb.Open(t, "users", "email_outbox")
+
+	owner := createUser(t, "Owner", "owner@example.com", "password")
+	studyGroup := createStudyGroups(t, owner, []string{"Eigenvalue Crew"}, "")[0]
+	studyGroupID := strconv.Itoa(studyGroup.ID)
+
+	threads := make([]models.Thread, 3)
+	for i := range threads {
+		thread, _, _, err := CreateThread(studyGroupID, owner.ID, fmt.Sprintf("Thread %d", i), "first")
+		if err != nil { t.Fatal(err) }
+
+		threads[i] = thread
+	}
+
+	for i := 0; i < 11; i++ {
+		if _, _, err := PostMessage(studyGroupID, threads[0].ID, owner.ID, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the thread with the latest message comes first
+	filter := page(2)
+	filter.Total = true
+
+	got, info, _, err := GetThreads(studyGroupID, filter)
+	if err != nil { t.Fatal(err) }
+
+	if len(got) != 2 || got[0].ID != threads[0].ID || got[1].ID != threads[2].ID {
+		t.Errorf("first page of threads = %+v", got)
+	}
+
+	if !info.HasMore || info.Total == nil || *info.Total != 3 {
+		t.Errorf("first page info = %+v", info)
+	}
+
+	threadsCursor := info.NextCursor
+	filter.Cursor = threadsCursor
+
+	got, info, _, err = GetThreads(studyGroupID, filter)
+	if err != nil { t.Fatal(err) }
+
+	if len(got) != 1 || got[0].ID != threads[1].ID || info.HasMore {
+		t.Errorf("last page of threads = %+v, %+v", got, info)
+	}
+
+	// messages are oldest first and pick up where the last page ended
+	var messages []models.Message
+	filter = page(10)
+
+	for {
+		page, info, _, err := GetMessages(studyGroupID, threads[0].ID, filter)
+		if err != nil { t.Fatal(err) }
+
+		messages = append(messages, page...)
+
+		if !info.HasMore { break }
+		filter.Cursor = info.NextCursor
+	}
+
+	if len(messages) != 12 { t.Fatalf("paged through %d messages, want 12", len(messages)) }
+
+	for i := 1; i < len(messages); i++ {
+		if messages[i].ID <= messages[i - 1].ID {
+			t.Errorf("message %d came after message %d", messages[i].ID, messages[i - 1].ID)
+		}
+	}
+
+	// a cursor from the threads doesn't page the messages
+	filter = page(10)
+	filter.Cursor = threadsCursor
+
+	if _, _, status, err := GetMessages(studyGroupID, threads[0].ID, filter); status != http.StatusBadRequest {
+		t.Errorf("thread cursor gave status %d: %v", status, err)
+	}
+}
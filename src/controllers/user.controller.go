@@ -20,6 +20,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
 	"github.com/prosperoa/study-groups/src/server"
 	"github.com/prosperoa/study-groups/src/utils"
 	"golang.org/x/crypto/bcrypt"
@@ -60,9 +61,34 @@ func GetUsers(c *gin.Context) {
 
 	p, _ := strconv.Atoi(page)
 	ps, _ := strconv.Atoi(pageSize)
+	if ps <= 0 { ps = 30 }
+
+	cursor, err := models.UsersSort.Decode(c.Query("cursor"))
+	if err != nil {
+		server.Respond(c, nil, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// pages after a cursor start right after it, whatever the page
+	var afterID int
+	if cursor != nil {
+		afterID, p = cursor.ID, 0
+	}
+
+	var info pagination.Info
+
+	if c.Query("total") == "true" {
+		total, err := models.CountUsers()
+		if err != nil {
+			server.Respond(c, nil, "unable to get users", http.StatusInternalServerError)
+			return
+		}
+
+		info.Total = &total
+	}
 
 	var users models.Users
-	err := users.Get(p, ps)
+	err = users.Get(afterID, p, ps)
 
 	switch {
 		case err == sql.ErrNoRows:
@@ -73,7 +99,18 @@ func GetUsers(c *gin.Context) {
 			return
 	}
 
-	server.Respond(c, users, "", http.StatusOK)
+	fetched := len(users)
+
+	if fetched > ps { users = users[:ps] }
+
+	if len(users) > 0 {
+		last := users[len(users) - 1]
+		cursor := models.UsersSort.Cursor(strconv.Itoa(last.ID), last.ID)
+
+		info.NextCursor, info.HasMore = pagination.Next(fetched, ps, cursor)
+	}
+
+	server.RespondPage(c, users, info, "", http.StatusOK)
 }
 
 func DeleteUser(c *gin.Context) {
@@ -306,7 +343,19 @@ func ChangePassword(c *gin.Context) {
 			return
 	}
 
-	server.Respond(c, nil, "password successfully changed", http.StatusOK)
+	// sign out every session, then start a new one for the caller
+	if err = models.RevokeUserSessions(server.DB, userID); err != nil {
+		server.Respond(c, nil, "unable to end sessions", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, status, err := CreateSession(userID)
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, tokens, "password successfully changed", http.StatusOK)
 }
 
 func UpdateCourses(c *gin.Context) {
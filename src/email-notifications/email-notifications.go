@@ -4,55 +4,353 @@ import (
   "bytes"
   "html/template"
   "errors"
-  "net/smtp"
   "os"
+  "path/filepath"
+  "runtime"
+  "strconv"
 
-  "github.com/jordan-wright/email"
+  "github.com/prosperoa/study-groups/src/models"
+  "github.com/prosperoa/study-groups/src/server"
+  "gopkg.in/guregu/null.v3"
 )
 
+const sender = "StudyGroups <studygroups.io@gmail.com>"
+
+// templatesDir is relative to src, where the server runs from. Tests run
+// from the directory of their package and find the templates next to this
+// file instead.
+var templatesDir = findTemplatesDir()
+
 var (
   newUserTpl = template.Must(template.New("new-user.html").ParseFiles(
-    "email-notifications/templates/new-user.html",
+    templatesDir + "new-user.html",
   ))
+
+  passwordResetTpl     = layoutTemplate("password-reset.html")
+  emailVerificationTpl = layoutTemplate("verify-email.html")
+
+  joinRequestTpl       = layoutTemplate("join-request.html")
+  requestAcceptedTpl   = layoutTemplate("request-accepted.html")
+  memberLeftTpl        = layoutTemplate("member-left.html")
+  requestRejectedTpl   = layoutTemplate("request-rejected.html")
+  memberRemovedTpl     = layoutTemplate("member-removed.html")
+  roleChangedTpl       = layoutTemplate("role-changed.html")
+  sessionChangedTpl    = layoutTemplate("session-changed.html")
+  studyGroupUpdatedTpl = layoutTemplate("study-group-updated.html")
+  studyGroupDeletedTpl = layoutTemplate("study-group-deleted.html")
+  digestTpl            = layoutTemplate("digest.html")
+  meetingReminderTpl   = layoutTemplate("meeting-reminder.html")
 )
 
-var errMsg = errors.New("unable to send email notification")
+var (
+  errMsg = errors.New("unable to send email notification")
+
+  // clientURL is where links in emails point to, e.g. the reset password page
+  clientURL = os.Getenv("CLIENT_URL")
+)
 
 type emailUser struct {
   Name  string
   Email string
+  footer
 }
 
-func NewUserNotification(userName, recipientEmail string) (errMsg error) {
-  var buf bytes.Buffer
+type emailLink struct {
+  Name string
+  Link string
+  footer
+}
+
+// footer is embedded in the data of emails that can be unsubscribed from.
+type footer struct {
+  UnsubscribeLink string
+}
+
+type membershipEvent struct {
+  footer
+  Name           string
+  UserName       string
+  StudyGroupName string
+  Link           string
+  Message        string
+  Role           string
+}
+
+type sessionEvent struct {
+  footer
+  Name           string
+  StudyGroupName string
+  Link           string
+  StartsOn       string
+  Location       string
+  Cancelled      bool
+}
+
+type unsubscribable interface {
+  setUnsubscribeLink(link string)
+}
+
+func (f *footer) setUnsubscribeLink(link string) {
+  f.UnsubscribeLink = link
+}
+
+type digest struct {
+  footer
+  Name        string
+  Frequency   string
+  Meetings    []digestItem
+  StudyGroups []digestItem
+  Link        string
+}
+
+type digestItem struct {
+  Name     string
+  Detail   string
+  Location string
+  Link     string
+}
+
+func findTemplatesDir() string {
+  dir := "email-notifications/templates/"
+  if _, err := os.Stat(dir); err == nil { return dir }
+
+  _, file, _, _ := runtime.Caller(0)
+
+  return filepath.Join(filepath.Dir(file), "templates") + "/"
+}
+
+// layoutTemplate parses a template defining a "content" block into the
+// shared email layout.
+func layoutTemplate(name string) *template.Template {
+  return template.Must(template.ParseFiles(
+    templatesDir + "layout.html",
+    templatesDir + name,
+  ))
+}
 
+// NewUserNotification welcomes the user. It isn't a notification they can
+// turn off, so its unsubscribe link stops every email but the ones needed to
+// keep the account safe, like password resets.
+func NewUserNotification(user models.User) error {
   data := emailUser{
+    Name: user.FirstName,
+    Email: user.Email,
+  }
+
+  return sendUnsubscribable(user, models.NotificationAll, "Welcome to Study Groups", newUserTpl, &data)
+}
+
+func PasswordResetNotification(userName, recipientEmail, token string) error {
+  data := emailLink{
     Name: userName,
-    Email: recipientEmail,
+    Link: clientURL + "/reset_password?token=" + token,
   }
 
-  if err := newUserTpl.Execute(&buf, &data); err != nil {
-    return errMsg
+  return send(recipientEmail, "Reset your Study Groups password", passwordResetTpl, &data)
+}
+
+func EmailVerificationNotification(userName, recipientEmail, token string) error {
+  data := emailLink{
+    Name: userName,
+    Link: clientURL + "/verify_email?token=" + token,
+  }
+
+  return send(recipientEmail, "Verify your Study Groups email", emailVerificationTpl, &data)
+}
+
+func JoinRequestNotification(recipient, requester models.User, studyGroup models.StudyGroup) error {
+  data := newMembershipEvent(recipient, requester, studyGroup)
+  subject := requester.FirstName + " wants to join " + studyGroup.Name
+
+  return notify(recipient, models.NotificationJoinRequested, subject, joinRequestTpl, &data)
+}
+
+func RequestAcceptedNotification(recipient models.User, studyGroup models.StudyGroup) error {
+  data := newMembershipEvent(recipient, recipient, studyGroup)
+  subject := "You've been accepted into " + studyGroup.Name
+
+  return notify(recipient, models.NotificationRequestAccepted, subject, requestAcceptedTpl, &data)
+}
+
+func MemberLeftNotification(recipient, member models.User, studyGroup models.StudyGroup) error {
+  data := newMembershipEvent(recipient, member, studyGroup)
+  subject := member.FirstName + " left " + studyGroup.Name
+
+  return notify(recipient, models.NotificationMemberLeft, subject, memberLeftTpl, &data)
+}
+
+func RequestRejectedNotification(recipient models.User, studyGroup models.StudyGroup, message string) error {
+  data := newMembershipEvent(recipient, recipient, studyGroup)
+  data.Link = clientURL + "/study_groups"
+  data.Message = message
+  subject := "Your request to join " + studyGroup.Name + " was declined"
+
+  return notify(recipient, models.NotificationRequestRejected, subject, requestRejectedTpl, &data)
+}
+
+func MemberRemovedNotification(recipient models.User, studyGroup models.StudyGroup, message string) error {
+  data := newMembershipEvent(recipient, recipient, studyGroup)
+  data.Link = clientURL + "/study_groups"
+  data.Message = message
+  subject := "You were removed from " + studyGroup.Name
+
+  return notify(recipient, models.NotificationMemberRemoved, subject, memberRemovedTpl, &data)
+}
+
+func RoleChangedNotification(recipient models.User, studyGroup models.StudyGroup, role string) error {
+  data := newMembershipEvent(recipient, recipient, studyGroup)
+  data.Role = role
+  subject := "Your role in " + studyGroup.Name + " changed"
+
+  return notify(recipient, models.NotificationRoleChanged, subject, roleChangedTpl, &data)
+}
+
+func StudyGroupUpdatedNotification(recipient models.User, studyGroup models.StudyGroup) error {
+  data := newMembershipEvent(recipient, recipient, studyGroup)
+  subject := studyGroup.Name + " was updated"
+
+  return notify(recipient, models.NotificationStudyGroupUpdated, subject, studyGroupUpdatedTpl, &data)
+}
+
+func StudyGroupDeletedNotification(recipient models.User, studyGroup models.StudyGroup) error {
+  data := newMembershipEvent(recipient, recipient, studyGroup)
+  data.Link = clientURL + "/study_groups"
+  subject := studyGroup.Name + " was deleted"
+
+  return notify(recipient, models.NotificationStudyGroupDeleted, subject, studyGroupDeletedTpl, &data)
+}
+
+// SessionChangedNotification tells a member a session was cancelled or
+// moved. Times are shown in UTC since we don't know the member's time zone.
+func SessionChangedNotification(recipient models.User, studyGroup models.StudyGroup, session models.StudyGroupSession) error {
+  event := newMembershipEvent(recipient, recipient, studyGroup)
+  data := sessionEvent{
+    Name:           event.Name,
+    StudyGroupName: event.StudyGroupName,
+    Link:           event.Link,
+    StartsOn:       session.StartsOn.UTC().Format("Mon, Jan 2 at 3:04pm UTC"),
+    Location:       session.Location.String,
+    Cancelled:      session.Status == models.SessionStatusCancelled,
+  }
+
+  subject := studyGroup.Name + " session moved"
+  if data.Cancelled { subject = studyGroup.Name + " session cancelled" }
+
+  return notify(recipient, models.NotificationSessionChanged, subject, sessionChangedTpl, &data)
+}
+
+// MeetingReminderNotification reminds a member of an upcoming meeting of
+// their study group.
+func MeetingReminderNotification(recipient models.User, meeting models.Meeting) error {
+  data := sessionEvent{
+    Name:           recipient.FirstName,
+    StudyGroupName: meeting.StudyGroupName,
+    Link:           clientURL + "/study_groups/" + strconv.Itoa(meeting.StudyGroupID),
+    StartsOn:       meeting.StartsOn.UTC().Format("Mon, Jan 2 at 3:04pm UTC"),
+    Location:       meeting.Location.String,
+  }
+
+  subject := meeting.StudyGroupName + " meets " + data.StartsOn
+
+  return notify(recipient, models.NotificationMeetingReminder, subject, meetingReminderTpl, &data)
+}
+
+// DigestNotification sends the recipient their upcoming meetings and the
+// new study groups for their courses. Like session emails, times are shown
+// in UTC.
+func DigestNotification(recipient models.User, frequency string, meetings []models.Meeting, studyGroups []models.StudyGroup) error {
+  data := digest{
+    Name:      recipient.FirstName,
+    Frequency: frequency,
+    Link:      clientURL + "/study_groups",
+  }
+
+  for _, meeting := range meetings {
+    data.Meetings = append(data.Meetings, digestItem{
+      Name:     meeting.StudyGroupName,
+      Detail:   meeting.StartsOn.UTC().Format("Mon, Jan 2 at 3:04pm UTC"),
+      Location: meeting.Location.String,
+      Link:     clientURL + "/study_groups/" + strconv.Itoa(meeting.StudyGroupID),
+    })
   }
 
-  email := &email.Email{
-    To: []string{recipientEmail},
-    From: "StudyGroups <studygroups.io@gmail.com>",
-    Subject: "Welcome to Study Groups",
-    HTML: []byte(buf.String()),
+  for _, studyGroup := range studyGroups {
+    var course models.Course
+    studyGroup.Course.Unmarshal(&course)
+
+    data.StudyGroups = append(data.StudyGroups, digestItem{
+      Name:     studyGroup.Name,
+      Detail:   course.Code,
+      Location: studyGroup.Location.String,
+      Link:     clientURL + "/study_groups/" + strconv.Itoa(studyGroup.ID),
+    })
   }
 
-  err := email.Send(
-    os.Getenv("SMTP_HOST") + os.Getenv("SMTP_PORT"),
-    smtp.PlainAuth(
-      "",
-      os.Getenv("SMTP_EMAIL"),
-      os.Getenv("SMTP_PASSWORD"),
-      os.Getenv("SMTP_HOST"),
-    ),
+  subject := "Your weekly Study Groups digest"
+  if frequency == models.DigestDaily { subject = "Your daily Study Groups digest" }
+
+  return notify(recipient, models.NotificationDigest, subject, digestTpl, &data)
+}
+
+func newMembershipEvent(recipient, user models.User, studyGroup models.StudyGroup) membershipEvent {
+  return membershipEvent{
+    Name:           recipient.FirstName,
+    UserName:       user.FirstName,
+    StudyGroupName: studyGroup.Name,
+    Link:           clientURL + "/study_groups/" + strconv.Itoa(studyGroup.ID),
+  }
+}
+
+// notify sends an email of notificationType unless the recipient turned
+// those off, with a link in the footer to do so.
+func notify(recipient models.User, notificationType, subject string, tpl *template.Template, data unsubscribable) error {
+  var settings models.NotificationSettings
+
+  if err := settings.Get(server.DB, recipient.ID); err != nil {
+    return errMsg
+  }
+
+  if !settings.SendsEmail(notificationType) { return nil }
+
+  return sendUnsubscribable(recipient, notificationType, subject, tpl, data)
+}
+
+// sendUnsubscribable sends an email that can be unsubscribed from in two
+// ways: a link in the footer to the app's unsubscribe page, which asks
+// before unsubscribing, and a List-Unsubscribe header that mail clients
+// post to when users unsubscribe from them.
+func sendUnsubscribable(recipient models.User, notificationType, subject string, tpl *template.Template, data unsubscribable) error {
+  token, err := server.GenerateUnsubscribeToken(strconv.Itoa(recipient.ID), notificationType)
+  if err != nil { return errMsg }
+
+  data.setUnsubscribeLink(clientURL + "/unsubscribe?token=" + token)
+
+  return queue(recipient.Email, subject, tpl, data,
+    null.StringFrom(server.APIURL + "/api/v1/unsubscribe?token=" + token),
   )
+}
+
+// send renders the email and queues it in the outbox, from where the
+// outbox worker delivers it.
+func send(recipientEmail, subject string, tpl *template.Template, data interface{}) error {
+  return queue(recipientEmail, subject, tpl, data, null.String{})
+}
+
+func queue(recipientEmail, subject string, tpl *template.Template, data interface{}, listUnsubscribe null.String) error {
+  var buf bytes.Buffer
+
+  if err := tpl.Execute(&buf, data); err != nil {
+    return errMsg
+  }
+
+  outboxEmail := models.OutboxEmail{
+    Recipient:       recipientEmail,
+    Subject:         subject,
+    HTML:            buf.String(),
+    ListUnsubscribe: listUnsubscribe,
+  }
 
-  if err != nil {
+  if err := outboxEmail.Create(); err != nil {
     return errMsg
   }
 
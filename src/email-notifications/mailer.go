@@ -0,0 +1,99 @@
+package emails
+
+import (
+  "fmt"
+  "io/ioutil"
+  "net/smtp"
+  "os"
+  "path/filepath"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/jordan-wright/email"
+)
+
+// Mailer delivers a single email. The outbox worker hands every email to
+// the Mailer picked by NewMailer.
+type Mailer interface {
+  Send(e *email.Email) error
+}
+
+// NewMailer returns the Mailer selected by the MAILER env var: "smtp"
+// (default), "file" to write emails into MAILER_DIR, or "memory".
+func NewMailer() Mailer {
+  switch os.Getenv("MAILER") {
+  case "file":
+    return &FileMailer{Dir: os.Getenv("MAILER_DIR")}
+  case "memory":
+    return &MemoryMailer{}
+  default:
+    return &SMTPMailer{
+      Host:     os.Getenv("SMTP_HOST"),
+      Port:     os.Getenv("SMTP_PORT"),
+      Username: os.Getenv("SMTP_EMAIL"),
+      Password: os.Getenv("SMTP_PASSWORD"),
+    }
+  }
+}
+
+type SMTPMailer struct {
+  Host     string
+  Port     string
+  Username string
+  Password string
+}
+
+func (m *SMTPMailer) Send(e *email.Email) error {
+  return e.Send(
+    m.Host + m.Port,
+    smtp.PlainAuth("", m.Username, m.Password, m.Host),
+  )
+}
+
+// FileMailer writes each email as an .eml file, for running locally
+// without an SMTP server.
+type FileMailer struct {
+  Dir string
+}
+
+func (m *FileMailer) Send(e *email.Email) error {
+  b, err := e.Bytes()
+  if err != nil { return err }
+
+  name := fmt.Sprintf("%d-%s.eml",
+    time.Now().UnixNano(),
+    strings.Replace(strings.Join(e.To, ","), "@", "_at_", -1),
+  )
+
+  return ioutil.WriteFile(filepath.Join(m.Dir, name), b, 0644)
+}
+
+// MemoryMailer keeps emails instead of sending them so tests can check
+// what would have been delivered.
+type MemoryMailer struct {
+  mu   sync.Mutex
+  sent []*email.Email
+}
+
+func (m *MemoryMailer) Send(e *email.Email) error {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+
+  m.sent = append(m.sent, e)
+  return nil
+}
+
+func (m *MemoryMailer) Sent() []*email.Email {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+
+  return append([]*email.Email{}, m.sent...)
+}
+
+func (m *MemoryMailer) Reset() {
+  m.mu.Lock()
+  defer m.mu.Unlock()
+
+  m.sent = nil
+}
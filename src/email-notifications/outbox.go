@@ -0,0 +1,101 @@
+package emails
+
+import (
+  "log"
+  "math"
+  "time"
+
+  "github.com/jordan-wright/email"
+  "github.com/prosperoa/study-groups/src/models"
+  "github.com/prosperoa/study-groups/src/server"
+)
+
+const (
+  outboxBatchSize = 20
+
+  outboxBaseBackoff = time.Second * 30
+  outboxMaxBackoff  = time.Hour * 6
+
+  // how long a worker has to send a claimed batch before other workers
+  // may claim its emails again
+  outboxClaimLease = time.Minute * 10
+)
+
+// StartOutboxWorker drains the outbox every interval until stop is called.
+func StartOutboxWorker(mailer Mailer, interval time.Duration) (stop func()) {
+  done := make(chan struct{})
+  ticker := time.NewTicker(interval)
+
+  go func() {
+    for {
+      select {
+      case <-ticker.C:
+        if err := DrainOutbox(mailer); err != nil {
+          log.Println(err.Error())
+        }
+      case <-done:
+        ticker.Stop()
+        return
+      }
+    }
+  }()
+
+  return func() { close(done) }
+}
+
+// DrainOutbox delivers every email that is due, one batch at a time.
+func DrainOutbox(mailer Mailer) error {
+  for {
+    n, err := drainOutboxBatch(mailer)
+    if err != nil || n < outboxBatchSize {
+      return err
+    }
+  }
+}
+
+// drainOutboxBatch claims a batch of due emails and sends them one by one.
+// Each result is recorded on its own, so a failure to record one doesn't
+// undo what was recorded for emails already delivered.
+func drainOutboxBatch(mailer Mailer) (int, error) {
+  outboxEmails, err := models.ClaimDueOutboxEmails(server.DB, outboxBatchSize, outboxClaimLease)
+  if err != nil { return 0, err }
+
+  for _, oe := range outboxEmails {
+    e := email.NewEmail()
+    e.To = []string{oe.Recipient}
+    e.From = sender
+    e.Subject = oe.Subject
+    e.HTML = []byte(oe.HTML)
+
+    if oe.ListUnsubscribe.Valid {
+      e.Headers.Set("List-Unsubscribe", "<" + oe.ListUnsubscribe.String + ">")
+      e.Headers.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+    }
+
+    sendErr := mailer.Send(e)
+
+    if sendErr == nil {
+      err = oe.MarkSent(server.DB)
+    } else {
+      log.Println(sendErr.Error())
+      err = oe.MarkAttemptFailed(server.DB, sendErr, backoff(oe.Attempts))
+    }
+
+    // the claim runs out and the email is tried again, which is the best
+    // that can be done when the database can't be written to
+    if err != nil { log.Println(err.Error()) }
+  }
+
+  return len(outboxEmails), nil
+}
+
+// backoff doubles the wait before each retry, up to outboxMaxBackoff.
+func backoff(attempts int) time.Duration {
+  d := outboxBaseBackoff * time.Duration(math.Pow(2, float64(attempts)))
+
+  if d > outboxMaxBackoff || d <= 0 {
+    return outboxMaxBackoff
+  }
+
+  return d
+}
@@ -0,0 +1,251 @@
+package emails
+
+import (
+  "errors"
+  "strings"
+  "testing"
+  "time"
+
+  "github.com/jordan-wright/email"
+  "github.com/prosperoa/study-groups/src/models"
+  "github.com/prosperoa/study-groups/src/server"
+  "github.com/prosperoa/study-groups/src/testdb"
+)
+
+// failingMailer fails every send, counting them.
+type failingMailer struct {
+  sends int
+}
+
+func (m *failingMailer) Send(e *email.Email) error {
+  m.sends++
+  return errors.New("smtp: connection refused")
+}
+
+func getOutboxEmail(t *testing.T, id int) models.OutboxEmail {
+  t.Helper()
+
+  var oe models.OutboxEmail
+  if err := server.DB.Get(&oe, "SELECT * FROM email_outbox WHERE id = $1", id); err != nil {
+    t.Fatal(err)
+  }
+
+  return oe
+}
+
+func queueEmail(t *testing.T, recipient, subject, html string) models.OutboxEmail {
+  t.Helper()
+
+  oe := models.OutboxEmail{Recipient: recipient, Subject: subject, HTML: html}
+  if err := oe.Create(); err != nil { t.Fatal(err) }
+
+  return oe
+}
+
+func TestDrainOutboxSendsQueuedEmails(t *testing.T) {
+  testdb.Open(t, "email_outbox")
+
+  if err := PasswordResetNotification("Ada", "ada@example.com", "reset-token"); err != nil {
+    t.Fatal(err)
+  }
+
+  if err := EmailVerificationNotification("Alan", "alan@example.com", "verify-token"); err != nil {
+    t.Fatal(err)
+  }
+
+  mailer := &MemoryMailer{}
+  if err := DrainOutbox(mailer); err != nil { t.Fatal(err) }
+
+  sent := mailer.Sent()
+  if len(sent) != 2 { t.Fatalf("sent %d emails, want 2", len(sent)) }
+
+  tests := []struct {
+    to      string
+    subject string
+    link    string
+  }{
+    {"ada@example.com", "Reset your Study Groups password", "/reset_password?token=reset-token"},
+    {"alan@example.com", "Verify your Study Groups email", "/verify_email?token=verify-token"},
+  }
+
+  for i, tt := range tests {
+    e := sent[i]
+
+    if len(e.To) != 1 || e.To[0] != tt.to {
+      t.Errorf("email %d sent to %v, want %s", i, e.To, tt.to)
+    }
+
+    if e.From != sender { t.Errorf("email %d sent from %q", i, e.From) }
+
+    if e.Subject != tt.subject {
+      t.Errorf("email %d subject = %q, want %q", i, e.Subject, tt.subject)
+    }
+
+    if !strings.Contains(string(e.HTML), tt.link) {
+      t.Errorf("email %d body is missing %q:\n%s", i, tt.link, e.HTML)
+    }
+  }
+
+  // delivered emails are marked and never sent again
+  mailer.Reset()
+  if err := DrainOutbox(mailer); err != nil { t.Fatal(err) }
+
+  if n := len(mailer.Sent()); n != 0 { t.Errorf("resent %d emails", n) }
+
+  var unsent int
+  server.DB.Get(&unsent, "SELECT count(*) FROM email_outbox WHERE sent_on IS NULL")
+
+  if unsent != 0 { t.Errorf("%d emails not marked sent", unsent) }
+}
+
+func TestDrainOutboxRetriesFailedEmails(t *testing.T) {
+  testdb.Open(t, "email_outbox")
+
+  oe := queueEmail(t, "ada@example.com", "Hello", "<p>hello</p>")
+
+  failing := &failingMailer{}
+  start := time.Now()
+
+  if err := DrainOutbox(failing); err != nil { t.Fatal(err) }
+
+  if failing.sends != 1 { t.Fatalf("tried %d times, want 1", failing.sends) }
+
+  oe = getOutboxEmail(t, oe.ID)
+
+  if oe.Attempts != 1 || oe.SentOn.Valid || oe.FailedOn.Valid {
+    t.Errorf("after a failed send: %+v", oe)
+  }
+
+  if !oe.LastError.Valid || !strings.Contains(oe.LastError.String, "connection refused") {
+    t.Errorf("last error = %v", oe.LastError)
+  }
+
+  // the retry waits out the first backoff
+  wait := oe.NextAttemptOn.Sub(start)
+  if wait < outboxBaseBackoff - time.Second || wait > outboxBaseBackoff + time.Minute {
+    t.Errorf("retried after %s, want about %s", wait, outboxBaseBackoff)
+  }
+
+  if err := DrainOutbox(failing); err != nil { t.Fatal(err) }
+
+  if failing.sends != 1 { t.Errorf("retried before the backoff was over") }
+
+  // once it's due again a working mailer delivers it
+  server.DB.Exec("UPDATE email_outbox SET next_attempt_on = $1", time.Now().Add(-time.Second))
+
+  mailer := &MemoryMailer{}
+  if err := DrainOutbox(mailer); err != nil { t.Fatal(err) }
+
+  if n := len(mailer.Sent()); n != 1 { t.Fatalf("sent %d emails, want 1", n) }
+
+  oe = getOutboxEmail(t, oe.ID)
+  if !oe.SentOn.Valid || oe.Attempts != 2 {
+    t.Errorf("after the retry: %+v", oe)
+  }
+}
+
+func TestDrainOutboxGivesUpAfterMaxAttempts(t *testing.T) {
+  testdb.Open(t, "email_outbox")
+
+  oe := queueEmail(t, "ada@example.com", "Hello", "<p>hello</p>")
+  failing := &failingMailer{}
+
+  for i := 0; i < models.OutboxMaxAttempts + 2; i++ {
+    server.DB.Exec("UPDATE email_outbox SET next_attempt_on = $1", time.Now().Add(-time.Second))
+
+    if err := DrainOutbox(failing); err != nil { t.Fatal(err) }
+  }
+
+  if failing.sends != models.OutboxMaxAttempts {
+    t.Errorf("tried %d times, want %d", failing.sends, models.OutboxMaxAttempts)
+  }
+
+  oe = getOutboxEmail(t, oe.ID)
+  if !oe.FailedOn.Valid || oe.SentOn.Valid {
+    t.Errorf("after the last attempt: %+v", oe)
+  }
+}
+
+func TestDrainOutboxSkipsClaimedEmails(t *testing.T) {
+  testdb.Open(t, "email_outbox")
+
+  queueEmail(t, "ada@example.com", "Hello", "<p>hello</p>")
+
+  claimed, err := models.ClaimDueOutboxEmails(server.DB, outboxBatchSize, outboxClaimLease)
+  if err != nil { t.Fatal(err) }
+
+  if len(claimed) != 1 { t.Fatalf("claimed %d emails, want 1", len(claimed)) }
+
+  // another worker finds nothing to send while the claim lasts
+  mailer := &MemoryMailer{}
+  if err := DrainOutbox(mailer); err != nil { t.Fatal(err) }
+
+  if n := len(mailer.Sent()); n != 0 { t.Errorf("sent %d claimed emails", n) }
+}
+
+func TestBackoff(t *testing.T) {
+  tests := []struct {
+    attempts int
+    want     time.Duration
+  }{
+    {0, time.Second * 30},
+    {1, time.Minute},
+    {2, time.Minute * 2},
+    {5, time.Minute * 16},
+    {10, outboxMaxBackoff},
+    {100, outboxMaxBackoff},
+  }
+
+  for _, tt := range tests {
+    if got := backoff(tt.attempts); got != tt.want {
+      t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+    }
+  }
+}
+
+func TestUnsubscribableEmailsCarryListUnsubscribe(t *testing.T) {
+  testdb.Open(t, "email_outbox")
+
+  user := models.User{ID: 42, FirstName: "Ada", Email: "ada@example.com"}
+
+  if err := NewUserNotification(user); err != nil { t.Fatal(err) }
+
+  if err := PasswordResetNotification("Ada", "ada@example.com", "reset-token"); err != nil {
+    t.Fatal(err)
+  }
+
+  mailer := &MemoryMailer{}
+  if err := DrainOutbox(mailer); err != nil { t.Fatal(err) }
+
+  sent := mailer.Sent()
+  if len(sent) != 2 { t.Fatalf("sent %d emails, want 2", len(sent)) }
+
+  welcome, reset := sent[0], sent[1]
+
+  // mail clients post to the API, users clicking the footer land on the
+  // app's confirmation page
+  listUnsubscribe := welcome.Headers.Get("List-Unsubscribe")
+  if !strings.HasPrefix(listUnsubscribe, "<" + server.APIURL + "/api/v1/unsubscribe?token=") {
+    t.Errorf("List-Unsubscribe = %q", listUnsubscribe)
+  }
+
+  if post := welcome.Headers.Get("List-Unsubscribe-Post"); post != "List-Unsubscribe=One-Click" {
+    t.Errorf("List-Unsubscribe-Post = %q", post)
+  }
+
+  if !strings.Contains(string(welcome.HTML), clientURL + "/unsubscribe?token=") {
+    t.Errorf("welcome email has no unsubscribe link in its footer")
+  }
+
+  token := strings.TrimSuffix(strings.SplitN(listUnsubscribe, "token=", 2)[1], ">")
+
+  userID, notificationType, err := server.ParseUnsubscribeToken(token)
+  if err != nil || userID != "42" || notificationType != models.NotificationAll {
+    t.Errorf("unsubscribe token is for %q, %q: %v", userID, notificationType, err)
+  }
+
+  // emails needed to keep the account safe can't be unsubscribed from
+  if reset.Headers.Get("List-Unsubscribe") != "" {
+    t.Errorf("password reset email has a List-Unsubscribe header")
+  }
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"log"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -33,15 +32,16 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	authToken, err := server.GenerateAuthToken(strconv.Itoa(user.ID))
+	tokens, status, err := controllers.CreateSession(user.ID)
 	if err != nil {
-		server.Respond(c, nil, err.Error(), http.StatusInternalServerError)
+		server.Respond(c, nil, err.Error(), status)
 		return
 	}
 
 	data := map[string]interface{}{
-		"auth_token": authToken,
-		"user":       user,
+		"auth_token":    tokens.AuthToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
 	}
 
 	server.Respond(c, data, "", status)
@@ -80,20 +80,140 @@ func Signup(c *gin.Context) {
 		return
 	}
 
-	authToken, err := server.GenerateAuthToken(strconv.Itoa(user.ID))
+	tokens, status, err := controllers.CreateSession(user.ID)
 	if err != nil {
-		server.Respond(c, nil, err.Error(), http.StatusInternalServerError)
+		server.Respond(c, nil, err.Error(), status)
 		return
 	}
 
-	if err = emails.NewUserNotification(user.FirstName, user.Email); err != nil {
+	if err = emails.NewUserNotification(user); err != nil {
+		log.Println(err.Error())
+	}
+
+	if _, err = controllers.SendEmailVerification(user.ID); err != nil {
 		log.Println(err.Error())
 	}
 
 	data := map[string]interface{}{
-		"auth_token": authToken,
-		"user":       user,
+		"auth_token":    tokens.AuthToken,
+		"refresh_token": tokens.RefreshToken,
+		"user":          user,
 	}
 
 	server.Respond(c, data, "", status)
 }
+
+func Refresh(c *gin.Context) {
+	var params models.SessionRefresh
+
+	if err := c.ShouldBindWith(&params, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing refresh token", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(params); err != nil {
+		server.Respond(c, nil, "invalid refresh token", http.StatusBadRequest)
+		return
+	}
+
+	tokens, status, err := controllers.RefreshSession(params.RefreshToken)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, tokens, "", status)
+}
+
+func Logout(c *gin.Context) {
+	status, err := controllers.Logout(c.GetString("session_id"))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, nil, "logged out", status)
+}
+
+func ForgotPassword(c *gin.Context) {
+	var params models.ForgotPassword
+
+	if err := c.ShouldBindWith(&params, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing email", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(params); err != nil {
+		server.Respond(c, nil, "invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	status, err := controllers.ForgotPassword(params.Email)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, nil, "if an account exists for this email, a reset link has been sent", status)
+}
+
+func ResetPassword(c *gin.Context) {
+	var params models.ResetPassword
+
+	if err := c.ShouldBindWith(&params, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(params); err != nil {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	err := server.Validate.VarWithValue(params.New, params.Confirm, "eqfield")
+	if err != nil {
+		server.Respond(c, nil, "passwords must match", http.StatusBadRequest)
+		return
+	}
+
+	status, err := controllers.ResetPassword(params.Token, params.New)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, nil, "password successfully reset", status)
+}
+
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+
+	if token == "" {
+		server.Respond(c, nil, "missing verification token", http.StatusBadRequest)
+		return
+	}
+
+	status, err := controllers.VerifyEmail(token)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, nil, "email verified", status)
+}
+
+func ResendEmailVerification(c *gin.Context) {
+	status, err := controllers.SendEmailVerification(c.GetInt("user_id"))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, nil, "verification email sent", status)
+}
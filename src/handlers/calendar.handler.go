@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prosperoa/study-groups/src/controllers"
+	"github.com/prosperoa/study-groups/src/ical"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/utils"
+)
+
+// GetStudyGroupCalendar downloads the meetings of one study group as an
+// .ics file to import. It sits behind login like the rest of the study
+// group, so calendar apps can't subscribe to it; they subscribe to the
+// user's feed from GetCalendarURL instead, which has every study group the
+// user is in.
+func GetStudyGroupCalendar(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+		return
+	}
+
+	calendar, status, err := controllers.GetStudyGroupCalendar(studyGroupID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="study-group-` + studyGroupID + `.ics"`)
+	writeCalendar(c, calendar)
+}
+
+// GetUserCalendar serves the calendar feed behind a user's secret token.
+// It's public since calendar apps can't log in; the token is the only
+// credential.
+func GetUserCalendar(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	calendar, status, err := controllers.GetUserCalendar(token)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	writeCalendar(c, calendar)
+}
+
+// GetCalendarURL hands out the calendar feed URL the first time it's asked
+// for. Only a hash of its token is kept, so after that the URL can only be
+// replaced through ResetCalendarURL.
+func GetCalendarURL(c *gin.Context) {
+	respondCalendarURL(c, false)
+}
+
+// ResetCalendarURL hands out a new calendar feed URL, for when the old one
+// was shared by mistake.
+func ResetCalendarURL(c *gin.Context) {
+	respondCalendarURL(c, true)
+}
+
+func respondCalendarURL(c *gin.Context, reset bool) {
+	token, status, err := controllers.GetCalendarToken(c.GetInt("user_id"), reset)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	if token == "" {
+		server.Respond(c, map[string]interface{}{"calendar_url": nil},
+			"calendar url was already given out, reset it to get a new one", status,
+		)
+		return
+	}
+
+	data := map[string]interface{}{
+		"calendar_url": server.APIURL + "/api/v1/calendars/" + token + ".ics",
+	}
+
+	server.Respond(c, data, "", status)
+}
+
+func writeCalendar(c *gin.Context, calendar ical.Calendar) {
+	var buf bytes.Buffer
+
+	if err := calendar.Encode(&buf); err != nil {
+		server.Respond(c, nil, "unable to write calendar", http.StatusInternalServerError)
+		return
+	}
+
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
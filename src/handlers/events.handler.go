@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prosperoa/study-groups/src/notifications"
+	"github.com/prosperoa/study-groups/src/pubsub"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+// heartbeatInterval keeps proxies, Heroku's router included, from closing
+// streams that have been quiet for a while.
+const heartbeatInterval = time.Second * 25
+
+// StreamStudyGroupEvents streams what happens in the study group to one of
+// its members as Server-Sent Events. The stream ends when the auth token
+// used to open it would have expired, so clients reconnect with a fresh
+// one, and as soon as the member leaves or is removed.
+func StreamStudyGroupEvents(c *gin.Context) {
+	membership := getMembership(c)
+
+	sub, err := pubsub.Default.Subscribe(pubsub.StudyGroupTopic(membership.StudyGroupID))
+	if err != nil {
+		server.Respond(c, nil, "unable to stream study group events", http.StatusInternalServerError)
+		return
+	}
+
+	defer sub.Close()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	expired := time.After(server.AuthTokenTTL)
+	clientGone := c.Writer.CloseNotify()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok { return false }
+
+			c.SSEvent(event.Type, event)
+
+			return !notifications.EndsMembership(event, membership.UserID)
+		case <-heartbeat.C:
+			// comment lines are ignored by clients
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		case <-expired:
+			return false
+		case <-clientGone:
+			return false
+		}
+	})
+}
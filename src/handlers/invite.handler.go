@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prosperoa/study-groups/src/controllers"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/notifications"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/utils"
+)
+
+func CreateInvite(c *gin.Context) {
+	var newInvite models.NewInvite
+	studyGroupID := c.Param("id")
+
+	if err := c.ShouldBindWith(&newInvite, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(newInvite); err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	invite, status, err := controllers.CreateInvite(studyGroupID, c.GetInt("user_id"), newInvite)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, invite, "invite created", status)
+}
+
+func GetInvites(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+		return
+	}
+
+	invites, status, err := controllers.GetInvites(studyGroupID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, invites, "", status)
+}
+
+func RevokeInvite(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	inviteID, err := strconv.Atoi(c.Param("invite_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	invite, status, err := controllers.RevokeInvite(studyGroupID, inviteID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, invite, "invite revoked", status)
+}
+
+func GetInvite(c *gin.Context) {
+	studyGroup, status, err := controllers.GetInvite(c.Param("code"))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, studyGroup, "", status)
+}
+
+func JoinWithInvite(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	studyGroup, membership, status, err := controllers.JoinWithInvite(c.Param("code"), userID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	if membership.Status == models.MembershipStatusActive {
+		notifications.MemberJoined(studyGroup, userID)
+		server.Respond(c, studyGroup, "user added to study group", status)
+		return
+	}
+
+	notifications.JoinRequested(studyGroup, userID)
+
+	server.Respond(c, studyGroup, "user added to study group waitlist", status)
+}
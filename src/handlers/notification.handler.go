@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prosperoa/study-groups/src/controllers"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+// GetNotifications returns a page of the user's in-app notifications.
+// Passing unread=true leaves out the ones already read.
+func GetNotifications(c *gin.Context) {
+	unreadOnly := c.Query("unread") == "true"
+
+	page, ok := bindPage(c)
+	if !ok { return }
+
+	notifications, info, status, err := controllers.GetNotifications(
+		c.GetInt("user_id"), unreadOnly, page,
+	)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.RespondPage(c, notifications, info, "", status)
+}
+
+func GetUnreadNotificationCount(c *gin.Context) {
+	count, status, err := controllers.GetUnreadNotificationCount(c.GetInt("user_id"))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, map[string]int{"unread": count}, "", status)
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	notificationID, err := strconv.Atoi(c.Param("id"))
+
+	if err != nil {
+		server.Respond(c, nil, "invalid notification id", http.StatusBadRequest)
+		return
+	}
+
+	notification, status, err := controllers.MarkNotificationRead(c.GetInt("user_id"), notificationID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, notification, "", status)
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	count, status, err := controllers.MarkAllNotificationsRead(c.GetInt("user_id"))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, map[string]int64{"marked_read": count}, "notifications marked as read", status)
+}
+
+func GetNotificationSettings(c *gin.Context) {
+	settings, status, err := controllers.GetNotificationSettings(c.GetInt("user_id"))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, settings, "", status)
+}
+
+func UpdateNotificationSettings(c *gin.Context) {
+	var preferences models.NotificationPreferences
+
+	if err := c.ShouldBindWith(&preferences, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(preferences); err != nil {
+		server.Respond(c, nil, "invalid reminder hours", http.StatusBadRequest)
+		return
+	}
+
+	if preferences.DigestFrequency != "" && !models.IsValidDigestFrequency(preferences.DigestFrequency) {
+		server.Respond(c, nil, "invalid digest frequency", http.StatusBadRequest)
+		return
+	}
+
+	for notificationType, delivery := range preferences.Deliveries {
+		if !models.IsNotificationType(notificationType) || !models.IsValidDelivery(delivery) {
+			server.Respond(c, nil, "invalid notification delivery", http.StatusBadRequest)
+			return
+		}
+	}
+
+	settings, status, err := controllers.UpdateNotificationSettings(c.GetInt("user_id"), preferences)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, settings, "", status)
+}
+
+// GetUnsubscribe tells what an unsubscribe link would stop, for the client
+// to confirm before posting it back to Unsubscribe.
+func GetUnsubscribe(c *gin.Context) {
+	token := c.Query("token")
+
+	if token == "" {
+		server.Respond(c, nil, "missing unsubscribe token", http.StatusBadRequest)
+		return
+	}
+
+	_, notificationType, status, err := controllers.CheckUnsubscribeToken(token)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, map[string]string{"type": notificationType}, "", status)
+}
+
+// Unsubscribe is where the link in the footer of notification emails leads
+// to. The signed token stands in for logging in. It's taken from the query,
+// as in the List-Unsubscribe header mail clients post to (RFC 8058), or
+// from the form.
+func Unsubscribe(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" { token = c.PostForm("token") }
+
+	if token == "" {
+		server.Respond(c, nil, "missing unsubscribe token", http.StatusBadRequest)
+		return
+	}
+
+	notificationType, status, err := controllers.Unsubscribe(token)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, map[string]string{"type": notificationType}, "unsubscribed", status)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prosperoa/study-groups/src/controllers"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/notifications"
+	"github.com/prosperoa/study-groups/src/recurrence"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/utils"
+	"gopkg.in/guregu/null.v3"
+)
+
+// maxOccurrencesWindow caps how many days of meetings can be asked for at
+// once.
+const maxOccurrencesWindow = 366
+
+func GetStudyGroupSchedule(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+		return
+	}
+
+	schedule, status, err := controllers.GetStudyGroupSchedule(studyGroupID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, schedule, "", status)
+}
+
+// SaveStudyGroupSchedule takes the first meeting as wall clock time in the
+// schedule's time zone, e.g. "2024-09-03T18:00:00" with "America/New_York",
+// an optional RRULE and the dates meetings are skipped on.
+func SaveStudyGroupSchedule(c *gin.Context) {
+	var params models.Schedule
+	studyGroupID := c.Param("id")
+
+	if err := c.ShouldBindWith(&params, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(params); err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	if params.Timezone == "" { params.Timezone = "UTC" }
+
+	loc, err := time.LoadLocation(params.Timezone)
+	if err != nil {
+		server.Respond(c, nil, "invalid timezone", http.StatusBadRequest)
+		return
+	}
+
+	startsOn, err := time.ParseInLocation("2006-01-02T15:04:05", params.StartsOn, loc)
+	if err != nil {
+		server.Respond(c, nil, "invalid starts_on", http.StatusBadRequest)
+		return
+	}
+
+	schedule := models.StudyGroupSchedule{
+		StartsOn:        startsOn,
+		DurationMinutes: params.DurationMinutes,
+		Timezone:        params.Timezone,
+		ExDates:         []string{},
+	}
+	schedule.StudyGroupID, _ = strconv.Atoi(studyGroupID)
+
+	if params.RRule != "" {
+		rule, err := recurrence.ParseInLocation(params.RRule, loc)
+		if err != nil {
+			server.Respond(c, nil, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// stored normalized so it reads the same everywhere it's shown
+		schedule.RRule = null.StringFrom(rule.String())
+	}
+
+	for _, exDate := range params.ExDates {
+		if _, err := time.Parse(models.ExDateFormat, exDate); err != nil {
+			server.Respond(c, nil, "invalid exdates", http.StatusBadRequest)
+			return
+		}
+
+		schedule.ExDates = append(schedule.ExDates, exDate)
+	}
+
+	studyGroup, schedule, status, err := controllers.SaveStudyGroupSchedule(schedule)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.StudyGroupUpdated(studyGroup)
+
+	server.Respond(c, schedule, "", status)
+}
+
+func DeleteStudyGroupSchedule(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+		return
+	}
+
+	studyGroup, status, err := controllers.DeleteStudyGroupSchedule(studyGroupID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.StudyGroupUpdated(studyGroup)
+
+	server.Respond(c, nil, "study group schedule deleted", status)
+}
+
+// GetStudyGroupOccurrences lists the meetings between the from and to dates,
+// both YYYY-MM-DD and inclusive. It defaults to the next 30 days.
+func GetStudyGroupOccurrences(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	today := time.Now().Format(models.ExDateFormat)
+
+	from, fromErr := time.Parse(models.ExDateFormat, c.DefaultQuery("from", today))
+	to, toErr := time.Parse(models.ExDateFormat, c.DefaultQuery(
+		"to", from.AddDate(0, 0, 30).Format(models.ExDateFormat),
+	))
+
+	if !utils.IsInt(studyGroupID) || fromErr != nil || toErr != nil || to.Before(from) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	if to.Sub(from) > time.Hour * 24 * maxOccurrencesWindow {
+		server.Respond(c, nil, "date range is too long", http.StatusBadRequest)
+		return
+	}
+
+	occurrences, status, err := controllers.GetStudyGroupOccurrences(studyGroupID, from, to)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, occurrences, "", status)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prosperoa/study-groups/src/controllers"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/notifications"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/utils"
+	"gopkg.in/guregu/null.v3"
+)
+
+func GetStudyGroupSessions(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+		return
+	}
+
+	sessions, status, err := controllers.GetStudyGroupSessions(studyGroupID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, sessions, "", status)
+}
+
+func CreateStudyGroupSession(c *gin.Context) {
+	studyGroupID, _ := strconv.Atoi(c.Param("id"))
+
+	session, ok := bindSession(c)
+	if !ok { return }
+
+	session.StudyGroupID = studyGroupID
+
+	session, status, err := controllers.CreateStudyGroupSession(session)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, session, "session created", status)
+}
+
+func CancelStudyGroupSession(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	sessionID, err := strconv.Atoi(c.Param("session_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	studyGroup, session, status, err := controllers.CancelStudyGroupSession(studyGroupID, sessionID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.SessionChanged(studyGroup, session)
+
+	server.Respond(c, session, "session cancelled", status)
+}
+
+func RescheduleStudyGroupSession(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	sessionID, err := strconv.Atoi(c.Param("session_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	params, ok := bindSession(c)
+	if !ok { return }
+
+	studyGroup, session, status, err := controllers.RescheduleStudyGroupSession(studyGroupID, sessionID, params)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.SessionChanged(studyGroup, session)
+
+	server.Respond(c, session, "session rescheduled", status)
+}
+
+// NewCheckInCode creates the code an owner or moderator shows at a session
+// for attendees to check in with.
+func NewCheckInCode(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	sessionID, err := strconv.Atoi(c.Param("session_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	checkInCode, status, err := controllers.NewCheckInCode(studyGroupID, sessionID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, checkInCode, "", status)
+}
+
+func CheckIn(c *gin.Context) {
+	var checkIn models.CheckIn
+	studyGroupID := c.Param("id")
+	sessionID, err := strconv.Atoi(c.Param("session_id"))
+
+	if err := c.ShouldBindWith(&checkIn, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing check-in code", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil || !utils.IsInt(studyGroupID) || server.Validate.Struct(checkIn) != nil {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	code := strings.ToUpper(checkIn.Code)
+
+	status, err := controllers.CheckIn(studyGroupID, sessionID, c.GetInt("user_id"), code)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, nil, "checked in", status)
+}
+
+func GetSessionAttendees(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	sessionID, err := strconv.Atoi(c.Param("session_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	attendees, status, err := controllers.GetSessionAttendees(studyGroupID, sessionID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, attendees, "", status)
+}
+
+func GetAttendance(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+		return
+	}
+
+	summaries, status, err := controllers.GetAttendance(studyGroupID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, summaries, "", status)
+}
+
+func GetMemberAttendance(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	userID, err := strconv.Atoi(c.Param("user_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	attendance, status, err := controllers.GetMemberAttendance(studyGroupID, userID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, attendance, "", status)
+}
+
+// bindSession reads the times and location of a session from the body,
+// responding with a 400 if they're missing or invalid.
+func bindSession(c *gin.Context) (models.StudyGroupSession, bool) {
+	var params models.Session
+
+	if err := c.ShouldBindWith(&params, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return models.StudyGroupSession{}, false
+	}
+
+	if err := server.Validate.Struct(params); err != nil || !params.EndsOn.After(params.StartsOn) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return models.StudyGroupSession{}, false
+	}
+
+	session := models.StudyGroupSession{
+		StartsOn: params.StartsOn,
+		EndsOn:   params.EndsOn,
+		Location: null.NewString(params.Location, params.Location != ""),
+	}
+
+	return session, true
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	"github.com/prosperoa/study-groups/src/controllers"
 	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/notifications"
 	"github.com/prosperoa/study-groups/src/server"
 	"github.com/prosperoa/study-groups/src/utils"
 )
@@ -31,19 +32,13 @@ func GetStudyGroup(c *gin.Context) {
 }
 
 func GetStudyGroups(c *gin.Context) {
-	uID, _            := strconv.Atoi(c.Query("user_id"))
-	userID            := models.UserID{Value: uID}
-
-	pageIndex, _      := strconv.Atoi(c.DefaultQuery("page_index", "0"))
-	pageSize, _       := strconv.Atoi(c.DefaultQuery("page_size", "30"))
 	availableSpots, _ := strconv.Atoi(c.DefaultQuery("available_spots", "1"))
 
 	filter := models.StudyGroupsFilter{
-		BaseFilter: models.BaseFilter{
-			PageIndex: pageIndex,
-			PageSize:  pageSize,
-		},
+		PageFilter:     pageFilter(c),
 		AvailableSpots: availableSpots,
+		Q:              c.Query("q"),
+		Sort:           c.Query("sort"),
 		StudyGroupName: c.Query("study_group_name"),
 		Location:       c.Query("location"),
 		MeetingDate:    c.Query("meeting_date"),
@@ -53,17 +48,12 @@ func GetStudyGroups(c *gin.Context) {
 		Term:           c.Query("term"),
 	}
 
-	if err := server.Validate.Struct(userID); err != nil {
-		server.Respond(c, nil, "invalid user id", http.StatusBadRequest)
-		return
-	}
-
 	if err := server.Validate.Struct(filter); err != nil {
 		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
 		return
 	}
 
-	studyGroups, status, err := controllers.GetStudyGroups(filter, userID.Value)
+	studyGroups, page, status, err := controllers.GetStudyGroups(filter, c.GetInt("user_id"))
 
 	if err != nil {
 		server.Respond(c, nil, err.Error(), status)
@@ -73,7 +63,7 @@ func GetStudyGroups(c *gin.Context) {
 	var message string
 	if len(studyGroups) == 0 { message = "no study groups found" }
 
-	server.Respond(c, studyGroups, message, status)
+	server.RespondPage(c, studyGroups, page, message, status)
 }
 
 func GetStudyGroupMembers(c *gin.Context) {
@@ -102,11 +92,28 @@ func CreateStudyGroup(c *gin.Context) {
 		return
 	}
 
-	if err := server.Validate.Struct(studyGroup); err != nil {
+	studyGroup.UserID = c.GetInt("user_id")
+
+	if studyGroup.AdmissionPolicy == "" {
+		studyGroup.AdmissionPolicy = models.AdmissionPolicyManual
+	}
+
+	if studyGroup.Visibility == "" {
+		studyGroup.Visibility = models.VisibilityPublic
+	}
+
+	if err := server.Validate.Struct(studyGroup); err != nil ||
+		!models.IsValidAdmissionPolicy(studyGroup.AdmissionPolicy) ||
+		!models.IsValidVisibility(studyGroup.Visibility) {
 		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
 		return
 	}
 
+	if studyGroup.Timezone != "" && !models.IsValidTimezone(studyGroup.Timezone) {
+		server.Respond(c, nil, "invalid timezone", http.StatusBadRequest)
+		return
+	}
+
 	studyGroup, status, err := controllers.CreateStudyGroup(studyGroup)
 
 	if err != nil {
@@ -119,26 +126,29 @@ func CreateStudyGroup(c *gin.Context) {
 }
 
 func JoinStudyGroup(c *gin.Context) {
-	var userID models.UserID
 	studyGroupID := c.Param("id")
+	userID := strconv.Itoa(c.GetInt("user_id"))
 
-	if err := c.ShouldBindWith(&userID, binding.JSON); err != nil {
-		server.Respond(c, nil, "missing user id", http.StatusBadRequest)
-		return
-	}
-
-	if err := server.Validate.Struct(userID); err != nil || !utils.IsInt(studyGroupID) {
-		server.Respond(c, nil, "invalid user id", http.StatusBadRequest)
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
 		return
 	}
 
-	studyGroup, status, err := controllers.JoinStudyGroup(studyGroupID, userID.String())
+	studyGroup, membership, status, err := controllers.JoinStudyGroup(studyGroupID, userID)
 
 	if err != nil {
 		server.Respond(c, nil, err.Error(), status)
 		return
 	}
 
+	if membership.Status == models.MembershipStatusActive {
+		notifications.MemberJoined(studyGroup, c.GetInt("user_id"))
+		server.Respond(c, studyGroup, "user added to study group", status)
+		return
+	}
+
+	notifications.JoinRequested(studyGroup, c.GetInt("user_id"))
+
 	server.Respond(c, studyGroup, "user added to study group waitlist", status)
 }
 
@@ -163,6 +173,8 @@ func MoveUserFromWaitlistToMembers(c *gin.Context) {
 		return
 	}
 
+	notifications.RequestAccepted(studyGroup, userID.Value)
+
 	server.Respond(c, studyGroup, "", status)
 }
 
@@ -180,17 +192,177 @@ func UpdateStudyGroup(c *gin.Context) {
 		return
 	}
 
-	updatedStudyGroup, status, err := controllers.UpdateStudyGroup(studyGroup)
+	// an empty admission policy or visibility keeps the current one
+	if studyGroup.AdmissionPolicy != "" && !models.IsValidAdmissionPolicy(studyGroup.AdmissionPolicy) {
+		server.Respond(c, nil, "invalid admission policy", http.StatusBadRequest)
+		return
+	}
+
+	if studyGroup.Visibility != "" && !models.IsValidVisibility(studyGroup.Visibility) {
+		server.Respond(c, nil, "invalid visibility", http.StatusBadRequest)
+		return
+	}
+
+	// an empty time zone keeps the current one too
+	if studyGroup.Timezone != "" && !models.IsValidTimezone(studyGroup.Timezone) {
+		server.Respond(c, nil, "invalid timezone", http.StatusBadRequest)
+		return
+	}
+
+	// the route decides which study group is updated, not the body
+	studyGroup.ID, _ = strconv.Atoi(studyGroupID)
+
+	updatedStudyGroup, promoted, status, err := controllers.UpdateStudyGroup(studyGroup)
 
 	if err != nil {
 		server.Respond(c, nil, err.Error(), status)
 		return
 	}
 
+	notifications.StudyGroupUpdated(updatedStudyGroup)
+
+	for _, userID := range promoted {
+		notifications.RequestAccepted(updatedStudyGroup, userID)
+	}
+
 	server.Respond(c, updatedStudyGroup, "", status)
 }
 
 func DeleteStudyGroup(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	studyGroup, members, status, err := controllers.DeleteStudyGroup(studyGroupID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.StudyGroupDeleted(studyGroup, members)
+
+	server.Respond(c, nil, "study group successfully deleted", status)
+}
+
+func LeaveStudyGroup(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	userID := strconv.Itoa(c.GetInt("user_id"))
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	studyGroup, promoted, status, err := controllers.LeaveStudyGroup(studyGroupID, userID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.MemberLeft(studyGroup, c.GetInt("user_id"))
+
+	for _, promotedUserID := range promoted {
+		notifications.RequestAccepted(studyGroup, promotedUserID)
+	}
+
+	server.Respond(c, nil, "user removed from study group", status)
+}
+
+func RejectWaitlistedUser(c *gin.Context) {
+	var action models.MembershipAction
+	studyGroupID := c.Param("id")
+
+	if err := c.ShouldBindWith(&action, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing user id", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(action); err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	studyGroup, status, err := controllers.RejectWaitlistedUser(studyGroupID, action.UserID, action.Ban)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.RequestRejected(studyGroup, action.UserID, action.Message)
+
+	server.Respond(c, nil, "user removed from study group waitlist", status)
+}
+
+func RemoveMember(c *gin.Context) {
+	var action models.MembershipAction
+	studyGroupID := c.Param("id")
+
+	if err := c.ShouldBindWith(&action, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing user id", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(action); err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	studyGroup, promoted, status, err := controllers.RemoveMember(studyGroupID, action.UserID, action.Ban)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.MemberRemoved(studyGroup, action.UserID, action.Message)
+
+	for _, promotedUserID := range promoted {
+		notifications.RequestAccepted(studyGroup, promotedUserID)
+	}
+
+	server.Respond(c, nil, "user removed from study group", status)
+}
+
+func SetMemberRole(c *gin.Context) {
+	var memberRole models.MemberRole
+	studyGroupID := c.Param("id")
+
+	if err := c.ShouldBindWith(&memberRole, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(memberRole); err != nil || !utils.IsInt(studyGroupID) ||
+		!models.IsValidMembershipRole(memberRole.Role) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	studyGroup, promoted, status, err := controllers.SetMemberRole(
+		studyGroupID, memberRole.UserID, memberRole.Role,
+	)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.RoleChanged(studyGroup, memberRole.UserID, memberRole.Role)
+
+	for _, promotedUserID := range promoted {
+		notifications.RequestAccepted(studyGroup, promotedUserID)
+	}
+
+	server.Respond(c, nil, "member role changed", status)
+}
+
+func TransferOwnership(c *gin.Context) {
 	var userID models.UserID
 	studyGroupID := c.Param("id")
 
@@ -204,17 +376,25 @@ func DeleteStudyGroup(c *gin.Context) {
 		return
 	}
 
-	status, err := controllers.DeleteStudyGroup(studyGroupID, userID.String())
+	studyGroup, promoted, status, err := controllers.TransferOwnership(
+		studyGroupID, c.GetInt("user_id"), userID.Value,
+	)
 
 	if err != nil {
 		server.Respond(c, nil, err.Error(), status)
 		return
 	}
 
-	server.Respond(c, nil, "study group successfully deleted", status)
+	notifications.RoleChanged(studyGroup, userID.Value, models.MembershipRoleOwner)
+
+	for _, promotedUserID := range promoted {
+		notifications.RequestAccepted(studyGroup, promotedUserID)
+	}
+
+	server.Respond(c, studyGroup, "study group ownership transferred", status)
 }
 
-func LeaveStudyGroup(c *gin.Context) {
+func UnbanUser(c *gin.Context) {
 	var userID models.UserID
 	studyGroupID := c.Param("id")
 
@@ -228,12 +408,12 @@ func LeaveStudyGroup(c *gin.Context) {
 		return
 	}
 
-	status, err := controllers.LeaveStudyGroup(studyGroupID, userID.String())
+	status, err := controllers.UnbanUser(studyGroupID, userID.Value)
 
 	if err != nil {
 		server.Respond(c, nil, err.Error(), status)
 		return
 	}
 
-	server.Respond(c, nil, "user removed from study group", status)
+	server.Respond(c, nil, "user unbanned from study group", status)
 }
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prosperoa/study-groups/src/controllers"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/notifications"
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/utils"
+)
+
+func GetThreads(c *gin.Context) {
+	studyGroupID := c.Param("id")
+
+	page, ok := bindPage(c)
+	if !ok { return }
+
+	if !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+		return
+	}
+
+	threads, info, status, err := controllers.GetThreads(studyGroupID, page)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.RespondPage(c, threads, info, "", status)
+}
+
+func CreateThread(c *gin.Context) {
+	var newThread models.NewThread
+	studyGroupID := c.Param("id")
+
+	if err := c.ShouldBindWith(&newThread, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return
+	}
+
+	if err := server.Validate.Struct(newThread); err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	thread, message, status, err := controllers.CreateThread(
+		studyGroupID, c.GetInt("user_id"), newThread.Title, newThread.Body,
+	)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.ThreadCreated(thread, message)
+
+	data := map[string]interface{}{
+		"thread":  thread,
+		"message": message,
+	}
+
+	server.Respond(c, data, "thread created", status)
+}
+
+func GetThread(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	thread, status, err := controllers.GetThread(studyGroupID, threadID)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, thread, "", status)
+}
+
+// LockThread locks or unlocks a thread. Nobody can post to a locked thread.
+func LockThread(c *gin.Context) {
+	var lock models.ThreadLock
+	studyGroupID := c.Param("id")
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+
+	if err := c.ShouldBindWith(&lock, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing params", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	thread, status, err := controllers.LockThread(studyGroupID, threadID, lock.Locked)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, thread, "", status)
+}
+
+func DeleteThread(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	status, err := controllers.DeleteThread(studyGroupID, threadID, getMembership(c))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.Respond(c, nil, "thread deleted", status)
+}
+
+func GetMessages(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+
+	page, ok := bindPage(c)
+	if !ok { return }
+
+	if err != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	messages, info, status, err := controllers.GetMessages(studyGroupID, threadID, page)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	server.RespondPage(c, messages, info, "", status)
+}
+
+func PostMessage(c *gin.Context) {
+	var messageBody models.MessageBody
+	studyGroupID := c.Param("id")
+	threadID, err := strconv.Atoi(c.Param("thread_id"))
+
+	if err := c.ShouldBindWith(&messageBody, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing message body", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil || !utils.IsInt(studyGroupID) || server.Validate.Struct(messageBody) != nil {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	message, status, err := controllers.PostMessage(
+		studyGroupID, threadID, c.GetInt("user_id"), messageBody.Body,
+	)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.MessagePosted(getMembership(c).StudyGroupID, message)
+
+	server.Respond(c, message, "", status)
+}
+
+func EditMessage(c *gin.Context) {
+	var messageBody models.MessageBody
+	studyGroupID := c.Param("id")
+	threadID, threadErr := strconv.Atoi(c.Param("thread_id"))
+	messageID, messageErr := strconv.Atoi(c.Param("message_id"))
+
+	if err := c.ShouldBindWith(&messageBody, binding.JSON); err != nil {
+		server.Respond(c, nil, "missing message body", http.StatusBadRequest)
+		return
+	}
+
+	if threadErr != nil || messageErr != nil || !utils.IsInt(studyGroupID) ||
+		server.Validate.Struct(messageBody) != nil {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	message, status, err := controllers.EditMessage(
+		studyGroupID, threadID, messageID, c.GetInt("user_id"), messageBody.Body,
+	)
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.MessageEdited(getMembership(c).StudyGroupID, message)
+
+	server.Respond(c, message, "", status)
+}
+
+func DeleteMessage(c *gin.Context) {
+	studyGroupID := c.Param("id")
+	threadID, threadErr := strconv.Atoi(c.Param("thread_id"))
+	messageID, messageErr := strconv.Atoi(c.Param("message_id"))
+
+	if threadErr != nil || messageErr != nil || !utils.IsInt(studyGroupID) {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return
+	}
+
+	status, err := controllers.DeleteMessage(studyGroupID, threadID, messageID, getMembership(c))
+
+	if err != nil {
+		server.Respond(c, nil, err.Error(), status)
+		return
+	}
+
+	notifications.MessageDeleted(getMembership(c).StudyGroupID, threadID, messageID)
+
+	server.Respond(c, nil, "message deleted", status)
+}
+
+// bindPage reads the params of a page of a list, responding with a 400 if
+// they're out of range.
+func bindPage(c *gin.Context) (models.PageFilter, bool) {
+	page := pageFilter(c)
+
+	if err := server.Validate.Struct(page); err != nil {
+		server.Respond(c, nil, "invalid params", http.StatusBadRequest)
+		return page, false
+	}
+
+	return page, true
+}
+
+// pageFilter reads the params every list takes. The first page is at
+// page_index, and the ones after it start at the cursor of the page before.
+func pageFilter(c *gin.Context) models.PageFilter {
+	pageIndex, _ := strconv.Atoi(c.DefaultQuery("page_index", "0"))
+	pageSize, _  := strconv.Atoi(c.DefaultQuery("page_size", "30"))
+
+	return models.PageFilter{
+		BaseFilter: models.BaseFilter{
+			PageIndex: pageIndex,
+			PageSize:  pageSize,
+		},
+		Cursor: c.Query("cursor"),
+		Total:  c.Query("total") == "true",
+	}
+}
+
+// getMembership returns the membership StudyGroupRoleAuth loaded for the
+// request.
+func getMembership(c *gin.Context) models.StudyGroupMembership {
+	membership, _ := c.MustGet("membership").(models.StudyGroupMembership)
+	return membership
+}
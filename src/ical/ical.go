@@ -0,0 +1,121 @@
+// Package ical writes iCalendar (RFC 5545) files so study group meetings
+// can be subscribed to from calendar apps.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	prodID = "-//StudyGroups//StudyGroups API//EN"
+
+	utcFormat      = "20060102T150405Z"
+	floatingFormat = "20060102T150405"
+
+	// lines longer than this many octets are folded
+	maxLineLength = 75
+)
+
+// now is when calendars are stamped as written, replaced in tests.
+var now = time.Now
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Event is a single meeting. Start and End are written in UTC unless
+// Floating is set, in which case their wall clock time is written without
+// a time zone and calendar apps show it as is.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Floating    bool
+	Summary     string
+	Description string
+	Location    string
+}
+
+// Encode writes the calendar to w.
+func (c Calendar) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	stamp := formatTime(now(), false)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:" + prodID)
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+
+	if c.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	for _, event := range c.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:" + escape(event.UID))
+		writeLine(bw, "DTSTAMP:" + stamp)
+		writeLine(bw, "DTSTART:" + formatTime(event.Start, event.Floating))
+		writeLine(bw, "DTEND:" + formatTime(event.End, event.Floating))
+		writeLine(bw, "SUMMARY:" + escape(event.Summary))
+
+		if event.Description != "" {
+			writeLine(bw, "DESCRIPTION:" + escape(event.Description))
+		}
+
+		if event.Location != "" {
+			writeLine(bw, "LOCATION:" + escape(event.Location))
+		}
+
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+func formatTime(t time.Time, floating bool) string {
+	if floating { return t.Format(floatingFormat) }
+
+	return t.UTC().Format(utcFormat)
+}
+
+func escape(text string) string {
+	return textEscaper.Replace(text)
+}
+
+// writeLine ends the line with CRLF, folding it so no line is longer than
+// 75 octets. Folds never split a UTF-8 character.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) { cut-- }
+
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+
+		// continuation lines start with a space, which counts towards the limit
+		limit = maxLineLength - 1
+	}
+
+	w.WriteString(line + "\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b & 0xC0 != 0x80
+}
@@ -0,0 +1,173 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEncodeGolden(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil { t.Fatal(err) }
+
+	calendar := Calendar{
+		Name: "Linear Algebra; Section 2, Fall",
+		Events: []Event{
+			{
+				UID:         "study-group-7-20240506T170000Z@studygroups",
+				Start:       time.Date(2024, 5, 6, 13, 0, 0, 0, newYork),
+				End:         time.Date(2024, 5, 6, 14, 30, 0, 0, newYork),
+				Summary:     "Révision d'algèbre linéaire — matrices, déterminants et espaces vectoriels 🧮📐",
+				Description: "Bring:\n- notes; calculator\n- C:\\path\\to\\slides, printed\r\nSee you there",
+				Location:    "Library, Room 2",
+			},
+			{
+				UID:      "study-group-8-20240507@studygroups",
+				Start:    time.Date(2024, 5, 7, 18, 0, 0, 0, time.UTC),
+				End:      time.Date(2024, 5, 7, 19, 0, 0, 0, time.UTC),
+				Floating: true,
+				Summary:  "Calculus",
+			},
+		},
+	}
+
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//StudyGroups//StudyGroups API//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		`X-WR-CALNAME:Linear Algebra\; Section 2\, Fall`,
+		"BEGIN:VEVENT",
+		"UID:study-group-7-20240506T170000Z@studygroups",
+		"DTSTAMP:20240501T120000Z",
+		"DTSTART:20240506T170000Z",
+		"DTEND:20240506T183000Z",
+		`SUMMARY:Révision d'algèbre linéaire — matrices\, déterminants et espa`,
+		" ces vectoriels 🧮📐",
+		`DESCRIPTION:Bring:\n- notes\; calculator\n- C:\\path\\to\\slides\, printed\`,
+		" nSee you there",
+		`LOCATION:Library\, Room 2`,
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:study-group-8-20240507@studygroups",
+		"DTSTAMP:20240501T120000Z",
+		"DTSTART:20240507T180000",
+		"DTEND:20240507T190000",
+		"SUMMARY:Calculus",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	var buf bytes.Buffer
+	if err := calendar.Encode(&buf); err != nil { t.Fatal(err) }
+
+	if got := buf.String(); got != want {
+		t.Errorf("Encode() =\n%s\nwant\n%s", got, want)
+	}
+
+	checkLines(t, buf.String())
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{"a;b,c", `a\;b\,c`},
+		{`back\slash`, `back\\slash`},
+		{`\;`, `\\\;`},
+		{"one\ntwo", `one\ntwo`},
+		{"one\r\ntwo", `one\ntwo`},
+		{"colons: stay", "colons: stay"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.text); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWriteLineFolds(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Calculus"},
+		{"exactly 75 octets", "SUMMARY:" + strings.Repeat("a", 67)},
+		{"76 octets", "SUMMARY:" + strings.Repeat("a", 68)},
+		{"long ASCII", "DESCRIPTION:" + strings.Repeat("0123456789", 30)},
+		// the 75th octet falls inside an é, which has to move to the next line
+		{"two byte runes", "SUMMARY:" + strings.Repeat("é", 100)},
+		{"three byte runes", "SUMMARY:" + strings.Repeat("—", 100)},
+		{"four byte runes", "SUMMARY:" + strings.Repeat("🧮", 100)},
+		{"mixed runes", "SUMMARY:" + strings.Repeat("aé—🧮", 40)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+
+			writeLine(w, tt.line)
+			w.Flush()
+
+			out := buf.String()
+			checkLines(t, out)
+
+			// unfolding gives back the line
+			unfolded := strings.Replace(strings.TrimSuffix(out, "\r\n"), "\r\n ", "", -1)
+			if unfolded != tt.line {
+				t.Errorf("unfolded to %q, want %q", unfolded, tt.line)
+			}
+
+			if len(tt.line) <= maxLineLength && strings.Count(out, "\r\n") != 1 {
+				t.Errorf("folded a line of %d octets", len(tt.line))
+			}
+		})
+	}
+
+	// folds are as late as the rune boundaries allow
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+
+	writeLine(w, "SUMMARY:" + strings.Repeat("é", 40))
+	w.Flush()
+
+	want := "SUMMARY:" + strings.Repeat("é", 33) + "\r\n " + strings.Repeat("é", 7) + "\r\n"
+	if buf.String() != want {
+		t.Errorf("writeLine folded to %q, want %q", buf.String(), want)
+	}
+}
+
+// checkLines fails unless every line of out ends with CRLF, is at most 75
+// octets long and is valid UTF-8, so no fold split a rune.
+func checkLines(t *testing.T, out string) {
+	t.Helper()
+
+	if !strings.HasSuffix(out, "\r\n") { t.Errorf("output doesn't end with CRLF") }
+
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a rune: %q", line)
+		}
+
+		if strings.ContainsAny(line, "\r\n") {
+			t.Errorf("line has a bare line break: %q", line)
+		}
+	}
+}
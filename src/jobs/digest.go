@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"github.com/prosperoa/study-groups/src/email-notifications"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+const digestMeetingsLimit = 20
+
+// SendDigests emails the users whose digest is due their upcoming meetings
+// and the study groups created for their courses since their last digest.
+// Users with nothing new get no email.
+func SendDigests() error {
+	now := time.Now()
+
+	recipients, err := models.GetDigestRecipients(server.DB, now)
+	if err != nil { return err }
+
+	for _, recipient := range recipients {
+		// one user's failure shouldn't hold up the rest
+		if err := sendDigest(recipient, now); err != nil {
+			log.Println(err.Error())
+		}
+	}
+
+	return nil
+}
+
+func sendDigest(recipient models.DigestRecipient, now time.Time) error {
+	until := now.Add(models.DigestPeriod(recipient.DigestFrequency))
+
+	meetings, err := models.GetUserMeetings(server.DB, recipient.ID, now, until, digestMeetingsLimit)
+	if err != nil { return err }
+
+	studyGroups, err := models.GetDigestStudyGroups(server.DB, recipient.ID, recipient.Since(now))
+	if err != nil { return err }
+
+	claimed, err := models.ClaimDigest(server.DB, recipient, now)
+	if err != nil || !claimed { return err }
+
+	if len(meetings) == 0 && len(studyGroups) == 0 { return nil }
+
+	return emails.DigestNotification(recipient.User, recipient.DigestFrequency, meetings, studyGroups)
+}
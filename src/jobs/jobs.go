@@ -0,0 +1,44 @@
+// Package jobs runs the API's background work, either every so often
+// inside the server process or once from the command line:
+//
+//	src -job digests
+package jobs
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/prosperoa/study-groups/src/models"
+)
+
+var ErrUnknownJob = errors.New("unknown job")
+
+var jobs = map[string]func() error{
+	"digests":     SendDigests,
+	"occurrences": models.RefreshStudyGroupOccurrences,
+	"reminders":   SendMeetingReminders,
+}
+
+// Run runs the job called name once.
+func Run(name string) error {
+	job, ok := jobs[name]
+	if !ok { return ErrUnknownJob }
+
+	return job()
+}
+
+// Every runs the job called name right away and then every interval,
+// logging its failures. It never returns.
+func Every(name string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := Run(name); err != nil {
+			log.Println(name + ": " + err.Error())
+		}
+
+		<-ticker.C
+	}
+}
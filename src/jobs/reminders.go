@@ -0,0 +1,28 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/notifications"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+// SendMeetingReminders reminds members of the meetings coming up within
+// their reminder_hours. Each reminder is claimed before it's sent, so it
+// goes out once even if the server restarts or several run the job.
+func SendMeetingReminders() error {
+	now := time.Now()
+
+	reminders, err := models.GetDueMeetingReminders(server.DB, now)
+	if err != nil { return err }
+
+	for _, reminder := range reminders {
+		claimed, err := reminder.Claim(server.DB)
+		if err != nil { return err }
+
+		if claimed { notifications.MeetingReminder(reminder) }
+	}
+
+	return models.DeleteSentReminders(server.DB, now.Add(-time.Hour * 24))
+}
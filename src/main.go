@@ -1,50 +1,145 @@
 package main
 
 import (
+  "flag"
   "log"
   "net/http"
+  "time"
 
   "github.com/gin-gonic/gin"
   "github.com/prosperoa/study-groups/src/controllers"
+  "github.com/prosperoa/study-groups/src/email-notifications"
   "github.com/prosperoa/study-groups/src/handlers"
+  "github.com/prosperoa/study-groups/src/jobs"
   "github.com/prosperoa/study-groups/src/middlewares"
+  "github.com/prosperoa/study-groups/src/models"
   "github.com/prosperoa/study-groups/src/server"
 )
 
 func main() {
+  job := flag.String("job", "", "run a background job once and exit, e.g. digests")
+  flag.Parse()
+
   if err := server.InitServer(); err != nil {
     log.Fatal(err)
   }
 
+  // emails queued by a one-off job are delivered by the server's outbox
+  // worker
+  if *job != "" {
+    if err := jobs.Run(*job); err != nil {
+      log.Fatal(err)
+    }
+
+    return
+  }
+
+  emails.StartOutboxWorker(emails.NewMailer(), time.Second * 10)
+  go jobs.Every("occurrences", time.Hour * 24)
+  go jobs.Every("digests", time.Hour)
+  go jobs.Every("reminders", time.Minute * 10)
+
   router := gin.Default()
   router.NoRoute(noRouteFound)
 
   public := router.Group("/api/v1")
   public.GET("/", index)
-  public.POST("/login",  handlers.Login)
-  public.POST("/signup", handlers.Signup)
+  public.POST("/login",        handlers.Login)
+  public.POST("/signup",       handlers.Signup)
+  public.POST("/auth/refresh", handlers.Refresh)
+
+  public.POST("/password/forgot", handlers.ForgotPassword)
+  public.POST("/password/reset",  handlers.ResetPassword)
+  public.GET( "/verify_email",    handlers.VerifyEmail)
+  public.GET( "/unsubscribe",     handlers.GetUnsubscribe)
+  public.POST("/unsubscribe",     handlers.Unsubscribe)
+
+  public.GET("/calendars/:token", handlers.GetUserCalendar)
 
   private := router.Group("/api/v1")
 	private.Use(middlewares.BasicAuth())
 
-  private.GET(   "/users",                  controllers.GetUsers)
-  private.GET(   "/users/:id",              controllers.GetUser)
-  private.PATCH( "/users/:id/account",      controllers.UpdateAccount)
-  private.POST(  "/users/:id/avatar",       controllers.UploadAvatar)
-  private.PUT(   "/users/:id/courses",      controllers.UpdateCourses)
-  private.POST(  "/users/:id/delete",       controllers.DeleteUser)
-  private.PATCH( "/users/:id/password",     controllers.ChangePassword)
+  ownsUser := middlewares.ResourceOwnerAuth()
+  ownsStudyGroup := middlewares.StudyGroupRoleAuth(models.MembershipRoleOwner)
+  moderatesStudyGroup := middlewares.StudyGroupRoleAuth(
+    models.MembershipRoleOwner,
+    models.MembershipRoleModerator,
+  )
+  attendsStudyGroup := middlewares.StudyGroupRoleAuth(
+    models.MembershipRoleOwner,
+    models.MembershipRoleModerator,
+    models.MembershipRoleMember,
+  )
+  verifiedEmail := middlewares.VerifiedEmail()
+  seesStudyGroup := middlewares.StudyGroupVisible()
+
+  private.POST(  "/auth/logout",            handlers.Logout)
+  private.POST(  "/verify_email/resend",    handlers.ResendEmailVerification)
+
+  private.GET(   "/users",                           controllers.GetUsers)
+  private.GET(   "/users/:id",                       controllers.GetUser)
+  private.PATCH( "/users/:id/account",               ownsUser, controllers.UpdateAccount)
+  private.POST(  "/users/:id/avatar",                ownsUser, controllers.UploadAvatar)
+  private.PUT(   "/users/:id/courses",               ownsUser, controllers.UpdateCourses)
+  private.POST(  "/users/:id/delete",                ownsUser, controllers.DeleteUser)
+  private.PATCH( "/users/:id/password",              ownsUser, controllers.ChangePassword)
+  private.GET(   "/users/:id/calendar",              ownsUser, handlers.GetCalendarURL)
+  private.POST(  "/users/:id/calendar/reset",        ownsUser, handlers.ResetCalendarURL)
+  private.GET(   "/users/:id/notification_settings", ownsUser, handlers.GetNotificationSettings)
+  private.PATCH( "/users/:id/notification_settings", ownsUser, handlers.UpdateNotificationSettings)
   // private.GET(   "/users/:id/study_groups", handlers.GetUserStudyGroups)
 
+  private.GET(   "/notifications",              handlers.GetNotifications)
+  private.GET(   "/notifications/unread_count", handlers.GetUnreadNotificationCount)
+  private.PATCH( "/notifications/:id/read",     handlers.MarkNotificationRead)
+  private.POST(  "/notifications/read_all",     handlers.MarkAllNotificationsRead)
+
+  private.GET(   "/invites/:code",      handlers.GetInvite)
+  private.POST(  "/invites/:code/join", verifiedEmail, handlers.JoinWithInvite)
+
   private.GET(   "/study_groups",                         handlers.GetStudyGroups)
-  private.POST(  "/study_groups",                         handlers.CreateStudyGroup)
-  private.GET(   "/study_groups/:id",                     handlers.GetStudyGroup)
-  private.PATCH( "/study_groups/:id",                     handlers.UpdateStudyGroup)
-  private.POST(  "/study_groups/:id",                     handlers.DeleteStudyGroup)
-  private.POST(  "/study_groups/:id/join",                handlers.JoinStudyGroup)
+  private.POST(  "/study_groups",                         verifiedEmail, handlers.CreateStudyGroup)
+  private.GET(   "/study_groups/:id",                     seesStudyGroup, handlers.GetStudyGroup)
+  private.PATCH( "/study_groups/:id",                     moderatesStudyGroup, handlers.UpdateStudyGroup)
+  private.POST(  "/study_groups/:id",                     ownsStudyGroup, handlers.DeleteStudyGroup)
+  private.POST(  "/study_groups/:id/join",                verifiedEmail, handlers.JoinStudyGroup)
   private.PATCH( "/study_groups/:id/leave",               handlers.LeaveStudyGroup)
-  private.GET(   "/study_groups/:id/members",             handlers.GetStudyGroupMembers)
-  private.PATCH( "/study_groups/:id/waitlist_to_members", handlers.MoveUserFromWaitlistToMembers)
+  private.GET(   "/study_groups/:id/members",             seesStudyGroup, handlers.GetStudyGroupMembers)
+  private.PATCH( "/study_groups/:id/waitlist_to_members", moderatesStudyGroup, handlers.MoveUserFromWaitlistToMembers)
+  private.PATCH( "/study_groups/:id/reject_waitlisted",   moderatesStudyGroup, handlers.RejectWaitlistedUser)
+  private.PATCH( "/study_groups/:id/remove_member",       ownsStudyGroup, handlers.RemoveMember)
+  private.PATCH( "/study_groups/:id/unban",               ownsStudyGroup, handlers.UnbanUser)
+  private.PATCH( "/study_groups/:id/role",                ownsStudyGroup, handlers.SetMemberRole)
+  private.PATCH( "/study_groups/:id/transfer_ownership",  ownsStudyGroup, handlers.TransferOwnership)
+  private.GET(   "/study_groups/:id/schedule",            seesStudyGroup, handlers.GetStudyGroupSchedule)
+  private.PUT(   "/study_groups/:id/schedule",            moderatesStudyGroup, handlers.SaveStudyGroupSchedule)
+  private.DELETE("/study_groups/:id/schedule",            moderatesStudyGroup, handlers.DeleteStudyGroupSchedule)
+  private.GET(   "/study_groups/:id/occurrences",         seesStudyGroup, handlers.GetStudyGroupOccurrences)
+  private.GET(   "/study_groups/:id/calendar.ics",        seesStudyGroup, handlers.GetStudyGroupCalendar)
+  private.GET(   "/study_groups/:id/events",              attendsStudyGroup, handlers.StreamStudyGroupEvents)
+  private.GET(   "/study_groups/:id/invites",             ownsStudyGroup, handlers.GetInvites)
+  private.POST(  "/study_groups/:id/invites",             ownsStudyGroup, handlers.CreateInvite)
+  private.DELETE("/study_groups/:id/invites/:invite_id",  ownsStudyGroup, handlers.RevokeInvite)
+
+  private.GET(   "/study_groups/:id/sessions",                          attendsStudyGroup, handlers.GetStudyGroupSessions)
+  private.POST(  "/study_groups/:id/sessions",                          moderatesStudyGroup, handlers.CreateStudyGroupSession)
+  private.PATCH( "/study_groups/:id/sessions/:session_id/cancel",       moderatesStudyGroup, handlers.CancelStudyGroupSession)
+  private.PATCH( "/study_groups/:id/sessions/:session_id/reschedule",   moderatesStudyGroup, handlers.RescheduleStudyGroupSession)
+  private.POST(  "/study_groups/:id/sessions/:session_id/checkin_code", moderatesStudyGroup, handlers.NewCheckInCode)
+  private.POST(  "/study_groups/:id/sessions/:session_id/checkin",      handlers.CheckIn)
+  private.GET(   "/study_groups/:id/sessions/:session_id/attendance",   moderatesStudyGroup, handlers.GetSessionAttendees)
+  private.GET(   "/study_groups/:id/attendance",                        moderatesStudyGroup, handlers.GetAttendance)
+  private.GET(   "/study_groups/:id/attendance/:user_id",               moderatesStudyGroup, handlers.GetMemberAttendance)
+
+  private.GET(   "/study_groups/:id/threads",                                 attendsStudyGroup, handlers.GetThreads)
+  private.POST(  "/study_groups/:id/threads",                                 attendsStudyGroup, handlers.CreateThread)
+  private.GET(   "/study_groups/:id/threads/:thread_id",                      attendsStudyGroup, handlers.GetThread)
+  private.DELETE("/study_groups/:id/threads/:thread_id",                      attendsStudyGroup, handlers.DeleteThread)
+  private.PATCH( "/study_groups/:id/threads/:thread_id/lock",                 moderatesStudyGroup, handlers.LockThread)
+  private.GET(   "/study_groups/:id/threads/:thread_id/messages",             attendsStudyGroup, handlers.GetMessages)
+  private.POST(  "/study_groups/:id/threads/:thread_id/messages",             attendsStudyGroup, handlers.PostMessage)
+  private.PATCH( "/study_groups/:id/threads/:thread_id/messages/:message_id", attendsStudyGroup, handlers.EditMessage)
+  private.DELETE("/study_groups/:id/threads/:thread_id/messages/:message_id", attendsStudyGroup, handlers.DeleteMessage)
 
   log.Fatal(router.Run(":8080"))
 }
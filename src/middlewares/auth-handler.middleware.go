@@ -1,13 +1,15 @@
 package middlewares
 
 import (
+  "database/sql"
 	"errors"
 	"net/http"
-	"strings"
+  "strconv"
   "time"
 
   "github.com/dgrijalva/jwt-go"
   "github.com/gin-gonic/gin"
+  "github.com/prosperoa/study-groups/src/models"
   "github.com/prosperoa/study-groups/src/server"
   "github.com/prosperoa/study-groups/src/utils"
 )
@@ -22,82 +24,169 @@ func BasicAuth() gin.HandlerFunc {
       return
     }
 
-    if err = verifyBasicAuth(authToken); err != nil {
+    userID, sessionID, err := verifyBasicAuth(authToken)
+    if err != nil {
       server.Respond(c, nil, err.Error(), http.StatusUnauthorized)
       c.Abort()
       return
     }
 
+    c.Set("user_id", userID)
+    c.Set("session_id", sessionID)
     c.Next()
   }
 }
 
+// ResourceOwnerAuth only lets the authenticated user through to their own
+// /users/:id resources. It must run after BasicAuth.
 func ResourceOwnerAuth() gin.HandlerFunc {
   return func(c *gin.Context) {
-		userID := c.Param("id")
+    if c.Param("id") != strconv.Itoa(c.GetInt("user_id")) {
+      server.Respond(c, nil, "resource access unauthorized", http.StatusForbidden)
+      c.Abort()
+      return
+    }
 
-		if userID == "" ||
-			!strings.Contains(c.Request.URL.String(), "users") ||
-			c.Request.Method == "GET" {
-				c.Next()
-				return
-		}
+    c.Next()
+  }
+}
 
-    authToken, err := utils.GetAuthTokenFromHeader(c.GetHeader("Authorization"))
+// StudyGroupRoleAuth only lets active members of the /study_groups/:id
+// group holding one of roles through. It must run after BasicAuth.
+func StudyGroupRoleAuth(roles ...string) gin.HandlerFunc {
+  return func(c *gin.Context) {
+    studyGroupID, _ := strconv.Atoi(c.Param("id"))
 
-    if err != nil {
-      server.Respond(c, nil, err.Error(), http.StatusBadRequest)
+    if studyGroupID == 0 {
+      server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
       c.Abort()
       return
     }
 
-    if err = verifyResourceOwnerAuth(authToken, userID); err != nil {
-      server.Respond(c, nil, err.Error(), http.StatusUnauthorized)
+    membership := models.StudyGroupMembership{
+      UserID:       c.GetInt("user_id"),
+      StudyGroupID: studyGroupID,
+    }
+
+    err := membership.Get(server.DB)
+
+    switch {
+    case err == sql.ErrNoRows,
+      err == nil && membership.Status != models.MembershipStatusActive,
+      err == nil && !utils.Contains(roles, membership.Role):
+      server.Respond(c, nil, "resource access unauthorized", http.StatusForbidden)
+      c.Abort()
+      return
+    case err != nil:
+      server.Respond(c, nil, "unable to authorize request", http.StatusInternalServerError)
       c.Abort()
       return
     }
 
+    c.Set("membership", membership)
     c.Next()
   }
 }
 
-func verifyBasicAuth(t string) error {
-  errMsg := errors.New("invalid auth token")
+// StudyGroupVisible keeps private /study_groups/:id groups, their details,
+// members and schedule, from users who aren't members or waitlisted; they
+// get a 403 from every route it guards. It must run after BasicAuth.
+func StudyGroupVisible() gin.HandlerFunc {
+  return func(c *gin.Context) {
+    studyGroupID, err := strconv.Atoi(c.Param("id"))
 
-  authToken, err := jwt.Parse(t, func(token *jwt.Token) (interface{}, error) {
-    if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errMsg
+    if err != nil {
+      server.Respond(c, nil, "invalid study group id", http.StatusBadRequest)
+      c.Abort()
+      return
     }
 
-    if int64(token.Claims.(jwt.MapClaims)["exp"].(float64)) < time.Now().Unix() {
-			return nil, errMsg
+    var visible bool
+
+    err = server.DB.Get(&visible,
+     `SELECT sg.visibility <> $1 OR EXISTS(
+        SELECT 1 FROM study_group_memberships m
+        WHERE m.study_group_id = sg.id AND m.user_id = $2 AND m.status <> $3
+      )
+      FROM study_groups sg WHERE sg.id = $4`,
+      models.VisibilityPrivate,
+      c.GetInt("user_id"),
+      models.MembershipStatusBanned,
+      studyGroupID,
+    )
+
+    switch {
+    case err == sql.ErrNoRows:
+      // the handler responds that the study group doesn't exist
+    case err != nil:
+      server.Respond(c, nil, "unable to authorize request", http.StatusInternalServerError)
+      c.Abort()
+      return
+    case !visible:
+      server.Respond(c, nil, "resource access unauthorized", http.StatusForbidden)
+      c.Abort()
+      return
     }
 
-    return server.JWTSigningKey, nil
-	})
+    c.Next()
+  }
+}
+
+// VerifiedEmail only lets users who confirmed their email address through.
+// It must run after BasicAuth.
+func VerifiedEmail() gin.HandlerFunc {
+  return func(c *gin.Context) {
+    user := models.User{ID: c.GetInt("user_id")}
 
-  if err != nil || !authToken.Valid {	return err }
+    if err := user.Get(); err != nil {
+      server.Respond(c, nil, "unable to authorize request", http.StatusInternalServerError)
+      c.Abort()
+      return
+    }
 
-	return nil
+    if !user.IsEmailVerified() {
+      server.Respond(c, nil, "email address not verified", http.StatusForbidden)
+      c.Abort()
+      return
+    }
+
+    c.Next()
+  }
 }
 
-func verifyResourceOwnerAuth(t, userID string) error {
-  errMsg := errors.New("resource access unauthorized")
+// verifyBasicAuth checks the auth token and that the session it was issued
+// for hasn't been revoked, returning the user and session IDs.
+func verifyBasicAuth(t string) (int, string, error) {
+  errMsg := errors.New("invalid auth token")
 
   authToken, err := jwt.Parse(t, func(token *jwt.Token) (interface{}, error) {
     if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-      return nil, errMsg
-		}
-
-		claims := token.Claims.(jwt.MapClaims)
-    if claims["user_id"] != userID {
-      return nil, errMsg
+			return nil, errMsg
     }
 
+    claims, ok := token.Claims.(jwt.MapClaims)
+    if !ok { return nil, errMsg }
+
+    // tokens for email links have a purpose and never authenticate
+    if _, ok := claims["purpose"]; ok { return nil, errMsg }
+
+    exp, ok := claims["exp"].(float64)
+    if !ok || int64(exp) < time.Now().Unix() { return nil, errMsg }
+
     return server.JWTSigningKey, nil
-  })
+	})
+
+  if err != nil || !authToken.Valid {	return 0, "", errMsg }
+
+  claims := authToken.Claims.(jwt.MapClaims)
+  sessionID, _ := claims["sid"].(string)
+  userIDClaim, _ := claims["user_id"].(string)
+
+  userID, err := strconv.Atoi(userIDClaim)
+  if err != nil || userID == 0 { return 0, "", errMsg }
 
-  if err != nil || !authToken.Valid { return errMsg }
+  active, err := models.IsSessionActive(sessionID)
+  if err != nil || !active { return 0, "", errMsg }
 
-	return nil
+	return userID, sessionID, nil
 }
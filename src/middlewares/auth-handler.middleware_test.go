@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "testing"
+  "time"
+
+  "github.com/dgrijalva/jwt-go"
+  "github.com/gin-gonic/gin"
+  "github.com/prosperoa/study-groups/src/controllers"
+  "github.com/prosperoa/study-groups/src/models"
+  "github.com/prosperoa/study-groups/src/server"
+  "github.com/prosperoa/study-groups/src/testdb"
+)
+
+func signAuthToken(t *testing.T, claims jwt.MapClaims) string {
+  t.Helper()
+
+  token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+  s, err := token.SignedString(server.JWTSigningKey)
+  if err != nil { t.Fatal(err) }
+
+  return s
+}
+
+// None of these tokens get as far as looking up the session, so no
+// database is needed.
+func TestVerifyBasicAuthRejectsTokens(t *testing.T) {
+  unsubscribeToken, err := server.GenerateUnsubscribeToken("1", "digest")
+  if err != nil { t.Fatal(err) }
+
+  verificationToken, err := server.GenerateEmailVerificationToken("1", "ada@example.com")
+  if err != nil { t.Fatal(err) }
+
+  tests := []struct {
+    name  string
+    token string
+  }{
+    {"unsubscribe token", unsubscribeToken},
+    {"verification token", verificationToken},
+    {"without exp", signAuthToken(t, jwt.MapClaims{"user_id": "1", "sid": "s"})},
+    {"with a string exp", signAuthToken(t, jwt.MapClaims{"user_id": "1", "sid": "s", "exp": "never"})},
+    {"with a purpose", signAuthToken(t, jwt.MapClaims{
+      "purpose": "unsubscribe",
+      "user_id": "1",
+      "exp":     time.Now().Add(time.Hour).Unix(),
+    })},
+    {"expired", signAuthToken(t, jwt.MapClaims{
+      "user_id": "1",
+      "sid":     "s",
+      "exp":     time.Now().Add(-time.Minute).Unix(),
+    })},
+    {"garbage", "not.a.token"},
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      if _, _, err := verifyBasicAuth(tt.token); err == nil {
+        t.Error("token was accepted")
+      }
+    })
+  }
+}
+
+func TestEmailTokensAreNotInterchangeable(t *testing.T) {
+  authToken, err := server.GenerateAuthToken("1", "session")
+  if err != nil { t.Fatal(err) }
+
+  unsubscribeToken, err := server.GenerateUnsubscribeToken("1", "digest")
+  if err != nil { t.Fatal(err) }
+
+  if _, _, err := server.ParseUnsubscribeToken(authToken); err == nil {
+    t.Error("auth token accepted as an unsubscribe token")
+  }
+
+  if _, _, err := server.ParseEmailVerificationToken(unsubscribeToken); err == nil {
+    t.Error("unsubscribe token accepted as a verification token")
+  }
+
+  userID, notificationType, err := server.ParseUnsubscribeToken(unsubscribeToken)
+  if err != nil || userID != "1" || notificationType != "digest" {
+    t.Errorf("ParseUnsubscribeToken = %q, %q, %v", userID, notificationType, err)
+  }
+}
+
+// Bad ids are turned away before the database is queried, so none is needed.
+func TestStudyGroupVisibleRejectsInvalidIDs(t *testing.T) {
+  gin.SetMode(gin.TestMode)
+
+  for _, id := range []string{"abc", "1;DROP TABLE study_groups", "1e3", "99999999999999999999"} {
+    router := gin.New()
+    router.GET("/study_groups/:id", StudyGroupVisible(), func(c *gin.Context) {
+      t.Errorf("id %q reached the handler", id)
+    })
+
+    w := httptest.NewRecorder()
+    req := httptest.NewRequest(http.MethodGet, "/study_groups/" + url.PathEscape(id), nil)
+    router.ServeHTTP(w, req)
+
+    if w.Code != http.StatusBadRequest {
+      t.Errorf("id %q: status %d, want %d", id, w.Code, http.StatusBadRequest)
+    }
+  }
+}
+
+// Non-members get the same 403 from every route that shows a private
+// study group, while its members see all of them.
+func TestStudyGroupVisibleHidesPrivateStudyGroups(t *testing.T) {
+  gin.SetMode(gin.TestMode)
+  testdb.Open(t, "users")
+
+  var userIDs []int
+
+  for _, email := range []string{"owner@example.com", "member@example.com", "outsider@example.com", "banned@example.com"} {
+    var id int
+
+    err := server.DB.Get(&id,
+     `INSERT INTO users (first_name, email, password, created_on, updated_on)
+      VALUES ('User', $1, 'password', now(), now())
+      RETURNING id`,
+      email,
+    )
+    if err != nil { t.Fatal(err) }
+
+    userIDs = append(userIDs, id)
+  }
+
+  owner, member, outsider, banned := userIDs[0], userIDs[1], userIDs[2], userIDs[3]
+
+  studyGroup, _, err := controllers.CreateStudyGroup(models.StudyGroup{
+    UserID:          owner,
+    Name:            "Abstract Algebra",
+    AdmissionPolicy: models.AdmissionPolicyManual,
+    Visibility:      models.VisibilityPrivate,
+  })
+  if err != nil { t.Fatal(err) }
+
+  for userID, status := range map[int]string{member: models.MembershipStatusActive, banned: models.MembershipStatusBanned} {
+    _, err := server.DB.Exec(
+     `INSERT INTO study_group_memberships (study_group_id, user_id, role, status, joined_on)
+      VALUES ($1, $2, $3, $4, now())`,
+      studyGroup.ID,
+      userID,
+      models.MembershipRoleMember,
+      status,
+    )
+    if err != nil { t.Fatal(err) }
+  }
+
+  paths := []string{"", "/members", "/schedule", "/occurrences", "/calendar.ics"}
+
+  tests := []struct {
+    name   string
+    userID int
+    status int
+  }{
+    {"owner", owner, http.StatusOK},
+    {"member", member, http.StatusOK},
+    {"outsider", outsider, http.StatusForbidden},
+    {"banned user", banned, http.StatusForbidden},
+  }
+
+  for _, tt := range tests {
+    for _, path := range paths {
+      router := gin.New()
+      router.GET("/study_groups/:id" + path,
+        func(c *gin.Context) { c.Set("user_id", tt.userID) },
+        StudyGroupVisible(),
+        func(c *gin.Context) { c.Status(http.StatusOK) },
+      )
+
+      w := httptest.NewRecorder()
+      req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/study_groups/%d%s", studyGroup.ID, path), nil)
+      router.ServeHTTP(w, req)
+
+      if w.Code != tt.status {
+        t.Errorf("%s: GET %s status %d, want %d", tt.name, path, w.Code, tt.status)
+      }
+    }
+  }
+}
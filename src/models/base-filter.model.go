@@ -3,4 +3,12 @@ package models
 type BaseFilter struct {
 	PageIndex int    `json:"page_index" validate:"min=0"`
 	PageSize  int    `json:"page_size"  validate:"min=10,max=30"`
+}
+
+// PageFilter pages through a list. Pages after the first start at the
+// cursor of the one before, and the total is only counted when asked for.
+type PageFilter struct {
+	BaseFilter
+	Cursor string `json:"cursor"`
+	Total  bool   `json:"total"`
 }
\ No newline at end of file
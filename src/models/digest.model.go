@@ -0,0 +1,109 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	// digestSlack lets a digest go out a little early so one sent by an
+	// hourly job doesn't slip by an hour every time.
+	digestSlack = time.Hour
+
+	digestStudyGroupsLimit = 10
+)
+
+// DigestRecipient is a user due for a digest email.
+type DigestRecipient struct {
+	User
+	DigestFrequency  string    `db:"digest_frequency"`
+	LastDigestSentOn null.Time `db:"last_digest_sent_on"`
+}
+
+// DigestPeriod is how far apart digests of frequency are sent. It's also
+// how far ahead they look for meetings.
+func DigestPeriod(frequency string) time.Duration {
+	if frequency == DigestDaily { return time.Hour * 24 }
+
+	return time.Hour * 24 * 7
+}
+
+// Since is when the recipient's digest picks up from.
+func (r DigestRecipient) Since(now time.Time) time.Time {
+	if r.LastDigestSentOn.Valid { return r.LastDigestSentOn.Time }
+
+	return now.Add(-DigestPeriod(r.DigestFrequency))
+}
+
+// GetDigestRecipients returns the users with a verified email whose daily
+// or weekly digest is due.
+func GetDigestRecipients(db sqlx.Queryer, now time.Time) ([]DigestRecipient, error) {
+	recipients := []DigestRecipient{}
+
+	err := sqlx.Select(db, &recipients,
+	 `SELECT u.*, coalesce(s.digest_frequency, $1) AS digest_frequency, s.last_digest_sent_on
+		FROM users u
+		LEFT JOIN notification_settings s ON s.user_id = u.id
+		WHERE u.email_verified_on IS NOT NULL
+		AND (
+			coalesce(s.digest_frequency, $1) = $2 AND (s.last_digest_sent_on IS NULL OR s.last_digest_sent_on <= $3)
+			OR coalesce(s.digest_frequency, $1) = $1 AND (s.last_digest_sent_on IS NULL OR s.last_digest_sent_on <= $4)
+		)
+		ORDER BY u.id`,
+		DigestWeekly,
+		DigestDaily,
+		now.Add(digestSlack - DigestPeriod(DigestDaily)),
+		now.Add(digestSlack - DigestPeriod(DigestWeekly)),
+	)
+
+	return recipients, err
+}
+
+// GetDigestStudyGroups returns the study groups created since the user's
+// last digest for the courses they take, newest first. Courses are matched
+// by code, and only public groups are suggested.
+func GetDigestStudyGroups(db sqlx.Queryer, userID int, since time.Time) ([]StudyGroup, error) {
+	studyGroups := []StudyGroup{}
+
+	err := sqlx.Select(db, &studyGroups,
+	 `SELECT sg.* FROM study_groups sg
+		JOIN users u ON u.id = $1
+		WHERE sg.created_on > $2 AND sg.visibility = $4
+		AND lower(sg.course::json ->> 'code') IN (
+			SELECT lower(c ->> 'code') FROM json_array_elements(coalesce(u.courses::json, '[]')) c
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM study_group_memberships m WHERE m.study_group_id = sg.id AND m.user_id = u.id
+		)
+		ORDER BY sg.created_on DESC
+		LIMIT $3`,
+		userID,
+		since,
+		digestStudyGroupsLimit,
+		VisibilityPublic,
+	)
+
+	return studyGroups, err
+}
+
+// ClaimDigest records that the recipient's digest is going out at sentOn.
+// It returns false if another process claimed it first, so servers running
+// the digest job at the same time don't send it twice.
+func ClaimDigest(db sqlx.Execer, recipient DigestRecipient, sentOn time.Time) (bool, error) {
+	result, err := db.Exec(
+	 `INSERT INTO notification_settings (user_id, last_digest_sent_on, updated_on)
+		VALUES ($1, $2, $2)
+		ON CONFLICT (user_id) DO UPDATE SET last_digest_sent_on = EXCLUDED.last_digest_sent_on
+		WHERE notification_settings.last_digest_sent_on IS NOT DISTINCT FROM $3`,
+		recipient.ID,
+		sentOn,
+		recipient.LastDigestSentOn,
+	)
+	if err != nil { return false, err }
+
+	n, err := result.RowsAffected()
+
+	return n == 1, err
+}
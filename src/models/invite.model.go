@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	// DefaultInviteTTL is how long an invite lasts when its creator doesn't
+	// say.
+	DefaultInviteTTL = time.Hour * 24 * 7
+
+	inviteCodeLength = 10
+)
+
+var (
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteExpired  = errors.New("invite has expired or been used up")
+)
+
+// Invite lets users join a study group directly. It can be used MaxUses
+// times, or any number of times if that's null, until it expires or is
+// revoked.
+type Invite struct {
+	ID           int       `db:"id"             json:"id"`
+	StudyGroupID int       `db:"study_group_id" json:"study_group_id"`
+	CreatedBy    null.Int  `db:"created_by"     json:"created_by"`
+	Code         string    `db:"code"           json:"code"`
+	MaxUses      null.Int  `db:"max_uses"       json:"max_uses"`
+	Uses         int       `db:"uses"           json:"uses"`
+	ExpiresOn    time.Time `db:"expires_on"     json:"expires_on"`
+	RevokedOn    null.Time `db:"revoked_on"     json:"revoked_on"`
+	CreatedOn    time.Time `db:"created_on"     json:"created_on"`
+
+	// Link is where the invite can be shared from, filled in by controllers.
+	Link string `db:"-" json:"link"`
+}
+
+// IsInviteError reports whether err is one of the invite errors above
+// rather than a database failure.
+func IsInviteError(err error) bool {
+	return err == ErrInviteNotFound || err == ErrInviteExpired
+}
+
+func (i *Invite) Create(db sqlx.Queryer) error {
+	code, err := randomCode(inviteCodeLength)
+	if err != nil { return err }
+
+	return sqlx.Get(db, i,
+	 `INSERT INTO study_group_invites (study_group_id, created_by, code, max_uses, expires_on, created_on)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *`,
+		i.StudyGroupID,
+		i.CreatedBy,
+		code,
+		i.MaxUses,
+		i.ExpiresOn,
+		time.Now(),
+	)
+}
+
+// GetByCode loads the invite with code, revoked or not. Codes are matched
+// whatever their case, since they're often typed in.
+func (i *Invite) GetByCode(db sqlx.Queryer, code string) error {
+	err := sqlx.Get(db, i,
+		"SELECT * FROM study_group_invites WHERE code = $1",
+		strings.ToUpper(code),
+	)
+	if err == sql.ErrNoRows { return ErrInviteNotFound }
+
+	return err
+}
+
+// Use counts a use of the invite, locking it until tx ends so it can't be
+// used more than MaxUses times.
+func (i *Invite) Use(tx *sqlx.Tx) error {
+	err := tx.Get(i, "SELECT * FROM study_group_invites WHERE id = $1 FOR UPDATE", i.ID)
+	if err == sql.ErrNoRows { return ErrInviteNotFound }
+	if err != nil { return err }
+
+	if !i.Usable() { return ErrInviteExpired }
+
+	return tx.Get(i,
+		"UPDATE study_group_invites SET uses = uses + 1 WHERE id = $1 RETURNING *",
+		i.ID,
+	)
+}
+
+func (i Invite) Usable() bool {
+	return !i.RevokedOn.Valid &&
+		i.ExpiresOn.After(time.Now()) &&
+		(!i.MaxUses.Valid || int64(i.Uses) < i.MaxUses.Int64)
+}
+
+// Revoke stops the study group's invite from being used. Revoking it again
+// keeps the time it was first revoked.
+func (i *Invite) Revoke(db sqlx.Queryer) error {
+	err := sqlx.Get(db, i,
+	 `UPDATE study_group_invites SET revoked_on = coalesce(revoked_on, $1)
+		WHERE id = $2 AND study_group_id = $3
+		RETURNING *`,
+		time.Now(),
+		i.ID,
+		i.StudyGroupID,
+	)
+	if err == sql.ErrNoRows { return ErrInviteNotFound }
+
+	return err
+}
+
+// GetStudyGroupInvites returns the study group's invites, newest first.
+func GetStudyGroupInvites(db sqlx.Queryer, studyGroupID int) ([]Invite, error) {
+	invites := []Invite{}
+
+	err := sqlx.Select(db, &invites,
+		"SELECT * FROM study_group_invites WHERE study_group_id = $1 ORDER BY id DESC",
+		studyGroupID,
+	)
+
+	return invites, err
+}
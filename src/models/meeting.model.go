@@ -0,0 +1,109 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	DefaultReminderHours = 24
+	MaxReminderHours     = 24 * 7
+)
+
+// Meeting is an upcoming meeting of a study group, read from the meetings
+// view: a session, an occurrence of its schedule or its meeting date.
+type Meeting struct {
+	StudyGroupID   int         `db:"study_group_id"   json:"study_group_id"`
+	StudyGroupName string      `db:"study_group_name" json:"study_group_name"`
+	StartsOn       time.Time   `db:"starts_on"        json:"starts_on"`
+	Location       null.String `db:"location"         json:"location"`
+}
+
+// MeetingReminder is a meeting a member is due to be reminded of.
+type MeetingReminder struct {
+	UserID int `db:"user_id"`
+	Meeting
+}
+
+// GetUserMeetings returns the meetings of the user's study groups between
+// from and to, soonest first.
+func GetUserMeetings(db sqlx.Queryer, userID int, from, to time.Time, limit int) ([]Meeting, error) {
+	meetings := []Meeting{}
+
+	err := sqlx.Select(db, &meetings,
+	 `SELECT m.study_group_id, sg.name AS study_group_name, m.starts_on, m.location
+		FROM meetings m
+		JOIN study_groups sg ON sg.id = m.study_group_id
+		JOIN study_group_memberships gm ON gm.study_group_id = m.study_group_id
+		WHERE gm.user_id = $1 AND gm.status = $2 AND m.starts_on >= $3 AND m.starts_on < $4
+		ORDER BY m.starts_on
+		LIMIT $5`,
+		userID,
+		MembershipStatusActive,
+		from.UTC(),
+		to.UTC(),
+		limit,
+	)
+
+	return meetings, err
+}
+
+// GetDueMeetingReminders returns the meetings starting within each active
+// member's reminder_hours that they weren't reminded of yet.
+func GetDueMeetingReminders(db sqlx.Queryer, now time.Time) ([]MeetingReminder, error) {
+	reminders := []MeetingReminder{}
+	now = now.UTC()
+
+	err := sqlx.Select(db, &reminders,
+	 `SELECT gm.user_id, m.study_group_id, sg.name AS study_group_name, m.starts_on, m.location
+		FROM meetings m
+		JOIN study_groups sg ON sg.id = m.study_group_id
+		JOIN study_group_memberships gm ON gm.study_group_id = m.study_group_id
+		LEFT JOIN notification_settings s ON s.user_id = gm.user_id
+		WHERE gm.status = $1 AND m.starts_on > $2 AND m.starts_on <= $3
+		AND m.starts_on <= $2::timestamp + make_interval(hours => coalesce(s.reminder_hours, $4))
+		AND NOT EXISTS (
+			SELECT 1 FROM sent_reminders r
+			WHERE r.user_id = gm.user_id AND r.study_group_id = m.study_group_id AND r.starts_on = m.starts_on
+		)
+		ORDER BY m.starts_on`,
+		MembershipStatusActive,
+		now,
+		now.Add(time.Hour * MaxReminderHours),
+		DefaultReminderHours,
+	)
+
+	return reminders, err
+}
+
+// Claim records that the reminder is being sent. It returns false if it
+// already was, by this process before a restart or by another one.
+func (r MeetingReminder) Claim(db sqlx.Execer) (bool, error) {
+	result, err := db.Exec(
+	 `INSERT INTO sent_reminders (user_id, study_group_id, starts_on, sent_on)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, study_group_id, starts_on) DO NOTHING`,
+		r.UserID,
+		r.StudyGroupID,
+		r.StartsOn,
+		time.Now(),
+	)
+	if err != nil { return false, err }
+
+	n, err := result.RowsAffected()
+
+	return n == 1, err
+}
+
+// DeleteSentReminders forgets the reminders of meetings that started
+// before the given time, since those can't come up again.
+func DeleteSentReminders(db sqlx.Execer, before time.Time) error {
+	_, err := db.Exec(
+		"DELETE FROM sent_reminders WHERE starts_on < $1",
+		before.UTC(),
+	)
+
+	return err
+}
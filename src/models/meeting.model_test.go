@@ -0,0 +1,197 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prosperoa/study-groups/src/server"
+	"github.com/prosperoa/study-groups/src/testdb"
+	"gopkg.in/guregu/null.v3"
+)
+
+// createMember adds a user who is the only active member of a new study
+// group meeting at meetingDate in timezone.
+func createMember(t *testing.T, meetingDate null.String, timezone string) (User, StudyGroup) {
+	t.Helper()
+
+	var user User
+	var studyGroup StudyGroup
+
+	err := server.DB.Get(&user,
+	 `INSERT INTO users (first_name, email, password, created_on, updated_on)
+		VALUES ('Ada', 'ada@example.com', 'x', now(), now())
+		RETURNING *`,
+	)
+	if err != nil { t.Fatal(err) }
+
+	err = server.DB.Get(&studyGroup,
+	 `INSERT INTO study_groups (user_id, name, meeting_date, timezone, created_on, updated_on)
+		VALUES ($1, 'Eigenvalue Crew', $2, $3, now(), now())
+		RETURNING *`,
+		user.ID,
+		meetingDate,
+		timezone,
+	)
+	if err != nil { t.Fatal(err) }
+
+	membership := StudyGroupMembership{
+		UserID:       user.ID,
+		StudyGroupID: studyGroup.ID,
+		Role:         MembershipRoleOwner,
+		Status:       MembershipStatusActive,
+	}
+	if err := membership.Create(server.DB); err != nil { t.Fatal(err) }
+
+	return user, studyGroup
+}
+
+// Meeting dates are wall clock time in their study group's time zone, so
+// reminders go out relative to that time, not to the same clock time in
+// UTC.
+func TestMeetingDatesAreInTheStudyGroupsTimezone(t *testing.T) {
+	testdb.Open(t, "users", "sent_reminders")
+
+	user, _ := createMember(t, null.StringFrom("2030-01-15 18:00:00"), "America/New_York")
+	startsOn := time.Date(2030, 1, 15, 23, 0, 0, 0, time.UTC)
+
+	meetings, err := GetUserMeetings(server.DB, user.ID, startsOn.Add(-time.Hour), startsOn.Add(time.Hour), 10)
+	if err != nil { t.Fatal(err) }
+
+	if len(meetings) != 1 || !meetings[0].StartsOn.Equal(startsOn) {
+		t.Fatalf("meetings = %+v, want one at %s", meetings, startsOn)
+	}
+
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{startsOn.Add(-time.Hour * 25), 0},
+		{startsOn.Add(-time.Hour * 23), 1},
+		// 18:00 UTC is when it would have been reminded of as UTC
+		{time.Date(2030, 1, 15, 18, 30, 0, 0, time.UTC), 1},
+		{startsOn, 0},
+	}
+
+	for _, tt := range tests {
+		reminders, err := GetDueMeetingReminders(server.DB, tt.now)
+		if err != nil { t.Fatal(err) }
+
+		if len(reminders) != tt.want {
+			t.Errorf("at %s: %d reminders, want %d", tt.now, len(reminders), tt.want)
+		}
+	}
+}
+
+// A session standing in for an occurrence of the schedule replaces it for
+// good, so moving or cancelling the session doesn't bring it back.
+func TestSessionsReplaceTheirOccurrence(t *testing.T) {
+	testdb.Open(t, "users", "sent_reminders")
+
+	user, studyGroup := createMember(t, null.String{}, DefaultTimezone)
+
+	occurrence := time.Date(2030, 1, 15, 23, 0, 0, 0, time.UTC)
+	next := occurrence.AddDate(0, 0, 7)
+
+	_, err := server.DB.Exec(
+	 `INSERT INTO study_group_occurrences (study_group_id, starts_on, local_date)
+		VALUES ($1, $2, $2::date), ($1, $3, $3::date)`,
+		studyGroup.ID,
+		occurrence,
+		next,
+	)
+	if err != nil { t.Fatal(err) }
+
+	meetingTimes := func() []time.Time {
+		t.Helper()
+
+		meetings, err := GetUserMeetings(server.DB, user.ID, occurrence.AddDate(0, 0, -1), next.AddDate(0, 0, 1), 10)
+		if err != nil { t.Fatal(err) }
+
+		var times []time.Time
+		for _, m := range meetings { times = append(times, m.StartsOn) }
+
+		return times
+	}
+
+	checkMeetings := func(step string, want ...time.Time) {
+		t.Helper()
+
+		got := meetingTimes()
+		if len(got) != len(want) {
+			t.Fatalf("%s: meetings at %v, want %v", step, got, want)
+		}
+
+		for i := range want {
+			if !got[i].Equal(want[i]) { t.Errorf("%s: meetings at %v, want %v", step, got, want) }
+		}
+	}
+
+	session := StudyGroupSession{StudyGroupID: studyGroup.ID, StartsOn: occurrence, EndsOn: occurrence.Add(time.Hour)}
+	if err := session.Create(server.DB); err != nil { t.Fatal(err) }
+
+	if !session.OccurrenceStartsOn.Valid || !session.OccurrenceStartsOn.Time.Equal(occurrence) {
+		t.Fatalf("session stands in for %v, want %s", session.OccurrenceStartsOn, occurrence)
+	}
+
+	checkMeetings("same time", occurrence, next)
+
+	moved := occurrence.Add(time.Hour * 2)
+
+	tx := server.DB.MustBegin()
+	if err := session.Reschedule(tx, moved, moved.Add(time.Hour), session.Location); err != nil { t.Fatal(err) }
+	if err := tx.Commit(); err != nil { t.Fatal(err) }
+
+	checkMeetings("rescheduled", moved, next)
+
+	tx = server.DB.MustBegin()
+	if err := session.Cancel(tx); err != nil { t.Fatal(err) }
+	if err := tx.Commit(); err != nil { t.Fatal(err) }
+
+	checkMeetings("cancelled", next)
+
+	// sessions at other times stand in for nothing
+	extra := StudyGroupSession{StudyGroupID: studyGroup.ID, StartsOn: next.Add(time.Hour), EndsOn: next.Add(time.Hour * 2)}
+	if err := extra.Create(server.DB); err != nil { t.Fatal(err) }
+
+	if extra.OccurrenceStartsOn.Valid { t.Errorf("extra session stands in for %s", extra.OccurrenceStartsOn.Time) }
+
+	checkMeetings("extra session", next, next.Add(time.Hour))
+}
+
+func TestMeetingTime(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil { t.Fatal(err) }
+
+	studyGroup := StudyGroup{Timezone: "America/New_York"}
+	studyGroup.MeetingDate.SetValid("2030-01-15T18:00:00Z")
+
+	got, err := studyGroup.MeetingTime()
+	if err != nil { t.Fatal(err) }
+
+	if want := time.Date(2030, 1, 15, 18, 0, 0, 0, newYork); !got.Equal(want) {
+		t.Errorf("MeetingTime() = %s, want %s", got, want)
+	}
+
+	studyGroup.Timezone = "Mars/Olympus_Mons"
+	if _, err := studyGroup.MeetingTime(); err == nil {
+		t.Errorf("MeetingTime() in an unknown time zone didn't fail")
+	}
+}
+
+func TestIsValidTimezone(t *testing.T) {
+	tests := map[string]bool{
+		"UTC":              true,
+		"America/New_York": true,
+		"Asia/Tokyo":       true,
+		"":                 false,
+		"Local":            false,
+		"EST5EDT,M3.2.0":   false,
+		"../../etc/passwd": false,
+	}
+
+	for tz, want := range tests {
+		if got := IsValidTimezone(tz); got != want {
+			t.Errorf("IsValidTimezone(%q) = %t, want %t", tz, got, want)
+		}
+	}
+}
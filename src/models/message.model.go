@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+// MessageColumns blanks the body of deleted messages. They stay in their
+// thread as placeholders so replies still read in order.
+const MessageColumns = `
+	id, thread_id, user_id,
+	CASE WHEN deleted_on IS NULL THEN body ELSE '' END AS body,
+	edited_on, deleted_on, deleted_by, created_on`
+
+type Message struct {
+	ID        int       `db:"id"         json:"id"`
+	ThreadID  int       `db:"thread_id"  json:"thread_id"`
+	UserID    null.Int  `db:"user_id"    json:"user_id"`
+	Body      string    `db:"body"       json:"body"`
+	EditedOn  null.Time `db:"edited_on"  json:"edited_on"`
+	DeletedOn null.Time `db:"deleted_on" json:"deleted_on"`
+	DeletedBy null.Int  `db:"deleted_by" json:"-"`
+	CreatedOn time.Time `db:"created_on" json:"created_on"`
+}
+
+func (m *Message) Create(db sqlx.Queryer) error {
+	return sqlx.Get(db, m,
+	 `INSERT INTO messages (thread_id, user_id, body, created_on)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + MessageColumns,
+		m.ThreadID,
+		m.UserID,
+		m.Body,
+		time.Now(),
+	)
+}
+
+// GetForUpdate loads a message of the thread that wasn't deleted and locks
+// it until tx ends.
+func (m *Message) GetForUpdate(tx *sqlx.Tx) error {
+	err := tx.Get(m,
+		"SELECT " + MessageColumns + " FROM messages WHERE id = $1 AND thread_id = $2 AND deleted_on IS NULL FOR UPDATE",
+		m.ID,
+		m.ThreadID,
+	)
+	if err == sql.ErrNoRows { return ErrMessageNotFound }
+
+	return err
+}
+
+// Edit changes the body of the message. Only its author can edit it.
+func (m *Message) Edit(db sqlx.Queryer, userID int, body string) error {
+	if m.UserID.Int64 != int64(userID) { return ErrNotAuthor }
+
+	return sqlx.Get(db, m,
+		"UPDATE messages SET body = $1, edited_on = $2 WHERE id = $3 RETURNING " + MessageColumns,
+		body,
+		time.Now(),
+		m.ID,
+	)
+}
+
+// Delete hides the message, keeping who deleted it. The author can delete
+// their own messages and moderators anyone's.
+func (m *Message) Delete(db sqlx.Queryer, membership StudyGroupMembership) error {
+	if m.UserID.Int64 != int64(membership.UserID) && !membership.CanModerate() {
+		return ErrNotAuthor
+	}
+
+	return sqlx.Get(db, m,
+		"UPDATE messages SET deleted_on = $1, deleted_by = $2 WHERE id = $3 RETURNING " + MessageColumns,
+		time.Now(),
+		membership.UserID,
+		m.ID,
+	)
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Notification types users can choose how they're told about. Event types
+// streamed to members share these names.
+const (
+	NotificationJoinRequested     = "join_requested"
+	NotificationRequestAccepted   = "request_accepted"
+	NotificationRequestRejected   = "request_rejected"
+	NotificationMemberLeft        = "member_left"
+	NotificationMemberRemoved     = "member_removed"
+	NotificationRoleChanged       = "role_changed"
+	NotificationStudyGroupUpdated = "study_group_updated"
+	NotificationStudyGroupDeleted = "study_group_deleted"
+	NotificationSessionChanged    = "session_changed"
+	NotificationMeetingReminder   = "meeting_reminder"
+
+	// NotificationDigest is only used to unsubscribe from digest emails,
+	// whose frequency is set through DigestFrequency.
+	NotificationDigest = "digest"
+
+	// NotificationAll is only used to unsubscribe from every email at once,
+	// from emails such as the welcome email that aren't notifications.
+	NotificationAll = "all"
+)
+
+// How a user is told about a type of notification.
+const (
+	DeliveryAll   = "all"
+	DeliveryEmail = "email"
+	DeliveryInApp = "in_app"
+	DeliveryOff   = "off"
+)
+
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var ErrInvalidNotificationType = errors.New("invalid notification type")
+
+var NotificationTypes = []string{
+	NotificationJoinRequested,
+	NotificationRequestAccepted,
+	NotificationRequestRejected,
+	NotificationMemberLeft,
+	NotificationMemberRemoved,
+	NotificationRoleChanged,
+	NotificationStudyGroupUpdated,
+	NotificationStudyGroupDeleted,
+	NotificationSessionChanged,
+	NotificationMeetingReminder,
+}
+
+// NotificationDeliveries maps notification types to how they're delivered.
+// Types left out are delivered both ways.
+type NotificationDeliveries map[string]string
+
+type NotificationSettings struct {
+	ID               int                    `db:"id"                  json:"-"`
+	UserID           int                    `db:"user_id"             json:"-"`
+	DigestFrequency  string                 `db:"digest_frequency"    json:"digest_frequency"`
+	Deliveries       NotificationDeliveries `db:"deliveries"          json:"deliveries"`
+	LastDigestSentOn null.Time              `db:"last_digest_sent_on" json:"-"`
+	ReminderHours    int                    `db:"reminder_hours"      json:"reminder_hours"`
+	UpdatedOn        time.Time              `db:"updated_on"          json:"-"`
+}
+
+// IsUnsubscribeType reports whether an unsubscribe link can be for
+// notificationType.
+func IsUnsubscribeType(notificationType string) bool {
+	switch notificationType {
+	case NotificationAll, NotificationDigest:
+		return true
+	}
+
+	return IsNotificationType(notificationType)
+}
+
+func IsNotificationType(notificationType string) bool {
+	for _, t := range NotificationTypes {
+		if t == notificationType { return true }
+	}
+
+	return false
+}
+
+func IsValidDelivery(delivery string) bool {
+	switch delivery {
+	case DeliveryAll, DeliveryEmail, DeliveryInApp, DeliveryOff:
+		return true
+	}
+
+	return false
+}
+
+func IsValidDigestFrequency(frequency string) bool {
+	switch frequency {
+	case DigestOff, DigestDaily, DigestWeekly:
+		return true
+	}
+
+	return false
+}
+
+func (d NotificationDeliveries) Value() (driver.Value, error) {
+	if d == nil { return []byte("{}"), nil }
+
+	return json.Marshal(d)
+}
+
+func (d *NotificationDeliveries) Scan(src interface{}) error {
+	var data []byte
+
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*d = NotificationDeliveries{}
+		return nil
+	default:
+		return errors.New("unsupported type for notification deliveries")
+	}
+
+	return json.Unmarshal(data, d)
+}
+
+// Get loads the user's settings, falling back to the defaults if they never
+// changed them. Every notification type is filled in.
+func (s *NotificationSettings) Get(db sqlx.Queryer, userID int) error {
+	err := sqlx.Get(db, s,
+		"SELECT * FROM notification_settings WHERE user_id = $1",
+		userID,
+	)
+
+	if err == sql.ErrNoRows {
+		*s = NotificationSettings{
+			UserID:          userID,
+			DigestFrequency: DigestWeekly,
+			ReminderHours:   DefaultReminderHours,
+		}
+		err = nil
+	}
+
+	if s.Deliveries == nil { s.Deliveries = NotificationDeliveries{} }
+
+	for _, t := range NotificationTypes {
+		if _, ok := s.Deliveries[t]; !ok { s.Deliveries[t] = DeliveryAll }
+	}
+
+	return err
+}
+
+// Save creates or replaces the user's settings.
+func (s *NotificationSettings) Save(db sqlx.Queryer) error {
+	return sqlx.Get(db, s,
+	 `INSERT INTO notification_settings (user_id, digest_frequency, deliveries, reminder_hours, updated_on)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			digest_frequency = EXCLUDED.digest_frequency,
+			deliveries       = EXCLUDED.deliveries,
+			reminder_hours   = EXCLUDED.reminder_hours,
+			updated_on       = EXCLUDED.updated_on
+		RETURNING *`,
+		s.UserID,
+		s.DigestFrequency,
+		s.Deliveries,
+		s.ReminderHours,
+		time.Now(),
+	)
+}
+
+// Unsubscribe stops emails of notificationType, leaving in-app
+// notifications as they were.
+func (s *NotificationSettings) Unsubscribe(notificationType string) error {
+	switch {
+	case notificationType == NotificationAll:
+		for _, t := range NotificationTypes { s.Unsubscribe(t) }
+
+		s.DigestFrequency = DigestOff
+	case notificationType == NotificationDigest:
+		s.DigestFrequency = DigestOff
+	case !IsNotificationType(notificationType):
+		return ErrInvalidNotificationType
+	case s.Delivery(notificationType) == DeliveryAll:
+		s.Deliveries[notificationType] = DeliveryInApp
+	case s.Delivery(notificationType) == DeliveryEmail:
+		s.Deliveries[notificationType] = DeliveryOff
+	}
+
+	return nil
+}
+
+func (s NotificationSettings) Delivery(notificationType string) string {
+	if delivery, ok := s.Deliveries[notificationType]; ok { return delivery }
+
+	return DeliveryAll
+}
+
+func (s NotificationSettings) SendsEmail(notificationType string) bool {
+	delivery := s.Delivery(notificationType)
+	return delivery == DeliveryAll || delivery == DeliveryEmail
+}
+
+func (s NotificationSettings) SendsInApp(notificationType string) bool {
+	delivery := s.Delivery(notificationType)
+	return delivery == DeliveryAll || delivery == DeliveryInApp
+}
@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestUnsubscribe(t *testing.T) {
+	settings := NotificationSettings{
+		DigestFrequency: DigestWeekly,
+		Deliveries: NotificationDeliveries{
+			NotificationJoinRequested: DeliveryEmail,
+			NotificationMemberLeft:    DeliveryInApp,
+			NotificationRoleChanged:   DeliveryOff,
+		},
+	}
+
+	if err := settings.Unsubscribe(NotificationSessionChanged); err != nil { t.Fatal(err) }
+
+	if got := settings.Delivery(NotificationSessionChanged); got != DeliveryInApp {
+		t.Errorf("session changed delivery = %s, want %s", got, DeliveryInApp)
+	}
+
+	if err := settings.Unsubscribe("nope"); err != ErrInvalidNotificationType {
+		t.Errorf("unknown type: got %v, want ErrInvalidNotificationType", err)
+	}
+
+	if err := settings.Unsubscribe(NotificationAll); err != nil { t.Fatal(err) }
+
+	for _, notificationType := range NotificationTypes {
+		if settings.SendsEmail(notificationType) {
+			t.Errorf("%s still sends email", notificationType)
+		}
+	}
+
+	// in-app notifications are left as they were
+	want := map[string]string{
+		NotificationJoinRequested:   DeliveryOff,
+		NotificationMemberLeft:      DeliveryInApp,
+		NotificationRoleChanged:     DeliveryOff,
+		NotificationMeetingReminder: DeliveryInApp,
+	}
+
+	for notificationType, delivery := range want {
+		if got := settings.Delivery(notificationType); got != delivery {
+			t.Errorf("%s delivery = %s, want %s", notificationType, got, delivery)
+		}
+	}
+
+	if settings.DigestFrequency != DigestOff {
+		t.Errorf("digest frequency = %s, want %s", settings.DigestFrequency, DigestOff)
+	}
+}
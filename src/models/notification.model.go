@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Notification is an entry in a user's in-app inbox. StudyGroupID is null
+// once the study group it's about was deleted.
+type Notification struct {
+	ID           int       `db:"id"             json:"id"`
+	UserID       int       `db:"user_id"        json:"-"`
+	Type         string    `db:"type"           json:"type"`
+	StudyGroupID null.Int  `db:"study_group_id" json:"study_group_id"`
+	Text         string    `db:"text"           json:"text"`
+	ReadOn       null.Time `db:"read_on"        json:"read_on"`
+	CreatedOn    time.Time `db:"created_on"     json:"created_on"`
+}
+
+func (n *Notification) Create(db sqlx.Queryer) error {
+	return sqlx.Get(db, n,
+	 `INSERT INTO notifications (user_id, type, study_group_id, text, created_on)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *`,
+		n.UserID,
+		n.Type,
+		n.StudyGroupID,
+		n.Text,
+		time.Now(),
+	)
+}
+
+// MarkRead marks one of the user's notifications as read. Reading it again
+// keeps the time it was first read.
+func (n *Notification) MarkRead(db sqlx.Queryer) error {
+	err := sqlx.Get(db, n,
+	 `UPDATE notifications SET read_on = coalesce(read_on, $1)
+		WHERE id = $2 AND user_id = $3
+		RETURNING *`,
+		time.Now(),
+		n.ID,
+		n.UserID,
+	)
+	if err == sql.ErrNoRows { return ErrNotificationNotFound }
+
+	return err
+}
+
+// GetUnreadNotificationCount is backed by a partial index on unread
+// notifications so apps can poll it for their badge.
+func GetUnreadNotificationCount(db sqlx.Queryer, userID int) (int, error) {
+	var count int
+
+	err := sqlx.Get(db, &count,
+		"SELECT count(*) FROM notifications WHERE user_id = $1 AND read_on IS NULL",
+		userID,
+	)
+
+	return count, err
+}
+
+// MarkAllNotificationsRead returns how many notifications were unread.
+func MarkAllNotificationsRead(db sqlx.Execer, userID int) (int64, error) {
+	result, err := db.Exec(
+		"UPDATE notifications SET read_on = $1 WHERE user_id = $2 AND read_on IS NULL",
+		time.Now(),
+		userID,
+	)
+	if err != nil { return 0, err }
+
+	return result.RowsAffected()
+}
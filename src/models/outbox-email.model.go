@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+// OutboxEmail is a rendered email waiting to be delivered by the outbox
+// worker. Failed deliveries are retried until MaxAttempts is reached.
+// ListUnsubscribe is the URL mail clients post to for one-click
+// unsubscribes (RFC 8058).
+type OutboxEmail struct {
+	ID              int         `db:"id"`
+	Recipient       string      `db:"recipient"`
+	Subject         string      `db:"subject"`
+	HTML            string      `db:"html"`
+	ListUnsubscribe null.String `db:"list_unsubscribe"`
+	Attempts        int         `db:"attempts"`
+	NextAttemptOn   time.Time   `db:"next_attempt_on"`
+	SentOn          null.Time   `db:"sent_on"`
+	FailedOn        null.Time   `db:"failed_on"`
+	LastError       null.String `db:"last_error"`
+	CreatedOn       time.Time   `db:"created_on"`
+}
+
+const OutboxMaxAttempts = 8
+
+func (oe *OutboxEmail) Create() error {
+	return server.DB.Get(oe,
+	 `INSERT INTO email_outbox (recipient, subject, html, list_unsubscribe, next_attempt_on, created_on)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *`,
+		oe.Recipient,
+		oe.Subject,
+		oe.HTML,
+		oe.ListUnsubscribe,
+		time.Now(),
+		time.Now(),
+	)
+}
+
+// ClaimDueOutboxEmails claims up to limit emails that are due for delivery
+// by pushing their next attempt lease into the future, so other workers
+// leave them alone while they're sent outside of any transaction. Emails a
+// worker claimed but never marked, because it died mid-batch, come due
+// again once the lease is over.
+func ClaimDueOutboxEmails(db sqlx.Queryer, limit int, lease time.Duration) ([]OutboxEmail, error) {
+	var outboxEmails []OutboxEmail
+
+	err := sqlx.Select(db, &outboxEmails,
+	 `UPDATE email_outbox SET next_attempt_on = $1
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE sent_on IS NULL AND failed_on IS NULL AND next_attempt_on <= $2
+			ORDER BY next_attempt_on, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		time.Now().Add(lease),
+		time.Now(),
+		limit,
+	)
+
+	return outboxEmails, err
+}
+
+func (oe *OutboxEmail) MarkSent(db sqlx.Execer) error {
+	_, err := db.Exec(
+		"UPDATE email_outbox SET sent_on = $1, attempts = attempts + 1 WHERE id = $2",
+		time.Now(),
+		oe.ID,
+	)
+
+	return err
+}
+
+// MarkAttemptFailed schedules the next delivery attempt after backoff, or
+// gives up on the email once it has used all of its attempts.
+func (oe *OutboxEmail) MarkAttemptFailed(db sqlx.Execer, sendErr error, backoff time.Duration) error {
+	var failedOn null.Time
+
+	if oe.Attempts + 1 >= OutboxMaxAttempts {
+		failedOn = null.TimeFrom(time.Now())
+	}
+
+	_, err := db.Exec(
+	 `UPDATE email_outbox
+		SET attempts = attempts + 1, next_attempt_on = $1, failed_on = $2, last_error = $3
+		WHERE id = $4`,
+		time.Now().Add(backoff),
+		failedOn,
+		sendErr.Error(),
+		oe.ID,
+	)
+
+	return err
+}
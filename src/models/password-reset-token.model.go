@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+const PasswordResetTokenTTL = time.Hour
+
+// PasswordResetToken is the single-use secret emailed to a user who forgot
+// their password. Only its hash is stored.
+type PasswordResetToken struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	TokenHash string    `db:"token_hash"`
+	ExpiresOn time.Time `db:"expires_on"`
+	UsedOn    null.Time `db:"used_on"`
+	CreatedOn time.Time `db:"created_on"`
+}
+
+// Create stores the token and invalidates any the user requested before,
+// so only the latest emailed link works.
+func (prt *PasswordResetToken) Create(tx *sqlx.Tx, token string) error {
+	_, err := tx.Exec(
+		"UPDATE password_reset_tokens SET used_on = $1 WHERE user_id = $2 AND used_on IS NULL",
+		time.Now(),
+		prt.UserID,
+	)
+	if err != nil { return err }
+
+	return tx.Get(prt,
+	 `INSERT INTO password_reset_tokens (user_id, token_hash, expires_on, created_on)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *`,
+		prt.UserID,
+		server.HashToken(token),
+		time.Now().Add(PasswordResetTokenTTL),
+		time.Now(),
+	)
+}
+
+func (prt *PasswordResetToken) GetForUpdate(tx *sqlx.Tx, token string) error {
+	return tx.Get(prt,
+		"SELECT * FROM password_reset_tokens WHERE token_hash = $1 FOR UPDATE",
+		server.HashToken(token),
+	)
+}
+
+func (prt *PasswordResetToken) IsUsable() bool {
+	return !prt.UsedOn.Valid && prt.ExpiresOn.After(time.Now())
+}
+
+func (prt *PasswordResetToken) MarkUsed(db sqlx.Execer) error {
+	_, err := db.Exec(
+		"UPDATE password_reset_tokens SET used_on = $1 WHERE id = $2",
+		time.Now(),
+		prt.ID,
+	)
+
+	return err
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+type AuthTokens struct {
+	AuthToken    string `json:"auth_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken belongs to a login session. Every refresh revokes the token
+// used and issues a new one under the same session ID, so a revoked token
+// showing up again means it was stolen and the whole session is ended.
+type RefreshToken struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	SessionID string    `db:"session_id"`
+	TokenHash string    `db:"token_hash"`
+	ExpiresOn time.Time `db:"expires_on"`
+	RevokedOn null.Time `db:"revoked_on"`
+	CreatedOn time.Time `db:"created_on"`
+}
+
+func (rt *RefreshToken) Create(db sqlx.Queryer, token string) error {
+	return sqlx.Get(db, rt,
+	 `INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_on, created_on)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *`,
+		rt.UserID,
+		rt.SessionID,
+		server.HashToken(token),
+		time.Now().Add(server.RefreshTokenTTL),
+		time.Now(),
+	)
+}
+
+// GetForUpdate loads the refresh token and locks its row until tx ends so
+// the same token can't be rotated twice concurrently.
+func (rt *RefreshToken) GetForUpdate(tx *sqlx.Tx, token string) error {
+	return tx.Get(rt,
+		"SELECT * FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE",
+		server.HashToken(token),
+	)
+}
+
+func (rt *RefreshToken) IsExpired() bool {
+	return rt.ExpiresOn.Before(time.Now())
+}
+
+func (rt *RefreshToken) Revoke(db sqlx.Execer) error {
+	_, err := db.Exec(
+		"UPDATE refresh_tokens SET revoked_on = $1 WHERE id = $2 AND revoked_on IS NULL",
+		time.Now(),
+		rt.ID,
+	)
+
+	return err
+}
+
+func RevokeSession(db sqlx.Execer, sessionID string) error {
+	_, err := db.Exec(
+		"UPDATE refresh_tokens SET revoked_on = $1 WHERE session_id = $2 AND revoked_on IS NULL",
+		time.Now(),
+		sessionID,
+	)
+
+	return err
+}
+
+func RevokeUserSessions(db sqlx.Execer, userID int) error {
+	_, err := db.Exec(
+		"UPDATE refresh_tokens SET revoked_on = $1 WHERE user_id = $2 AND revoked_on IS NULL",
+		time.Now(),
+		userID,
+	)
+
+	return err
+}
+
+// IsSessionActive reports whether the session still holds a refresh token
+// that is neither revoked nor expired.
+func IsSessionActive(sessionID string) (bool, error) {
+	var active bool
+
+	if sessionID == "" { return false, nil }
+
+	err := server.DB.Get(&active,
+	 `SELECT exists(
+			SELECT 1 FROM refresh_tokens
+			WHERE session_id = $1 AND revoked_on IS NULL AND expires_on > $2
+		)`,
+		sessionID,
+		time.Now(),
+	)
+
+	return active, err
+}
@@ -1,11 +1,56 @@
 package models
 
-import "strconv"
+import (
+	"strconv"
+	"time"
+)
 
 type UserID struct {
 	Value int `json:"user_id" validate:"required,gt=0"`
 }
 
+type MembershipAction struct {
+	UserID  int    `json:"user_id" validate:"required,gt=0"`
+	Message string `json:"message" validate:"max=280"`
+	Ban     bool   `json:"ban"`
+}
+
+type MemberRole struct {
+	UserID int    `json:"user_id" validate:"required,gt=0"`
+	Role   string `json:"role"    validate:"required"`
+}
+
+type Schedule struct {
+	StartsOn        string   `json:"starts_on"        validate:"required"`
+	DurationMinutes int      `json:"duration_minutes" validate:"required,min=1,max=1440"`
+	Timezone        string   `json:"timezone"`
+	RRule           string   `json:"rrule"            validate:"max=255"`
+	ExDates         []string `json:"exdates"          validate:"max=366"`
+}
+
+type Session struct {
+	StartsOn time.Time `json:"starts_on" validate:"required"`
+	EndsOn   time.Time `json:"ends_on"   validate:"required"`
+	Location string    `json:"location"  validate:"max=140"`
+}
+
+type CheckIn struct {
+	Code string `json:"code" validate:"required,len=6"`
+}
+
+type NewThread struct {
+	Title string `json:"title" validate:"required,max=140"`
+	Body  string `json:"body"  validate:"required,max=2000"`
+}
+
+type MessageBody struct {
+	Body string `json:"body" validate:"required,max=2000"`
+}
+
+type ThreadLock struct {
+	Locked bool `json:"locked"`
+}
+
 type LoginCredentials struct {
 	Email    string `json:"email"    validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6,max=50"`
@@ -18,6 +63,10 @@ type SignUpCredentials struct {
 	ConfirmPassword string `json:"confirm_password" validate:"required,min=6,max=50"`
 }
 
+type SessionRefresh struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 type Account struct {
 	FirstName string `json:"first_name" validate:"required,min=1,max=20"`
 	LastName  string `json:"last_name"  validate:"max=20"`
@@ -38,6 +87,16 @@ type ChangePassword struct {
 	Current string `json:"current_password" validate:"required"`
 }
 
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPassword struct {
+	Token   string `json:"token"            validate:"required"`
+	New     string `json:"new_password"     validate:"required,min=6,max=50,excludesall= "`
+	Confirm string `json:"confirm_password" validate:"required,min=6,max=50,excludesall= "`
+}
+
 type NewStudyGroup struct {
 	UserID         int  `json:"user_id"       validate:"required,gt=0"`
 	Name         string `json:"name"          validate:"required,max=40`
@@ -48,8 +107,25 @@ type NewStudyGroup struct {
 	Course       string `json:"course"`
 }
 
+// NewInvite leaves MaxUses at 0 for an invite that can be used any number
+// of times, and ExpiresInHours at 0 for one lasting DefaultInviteTTL.
+type NewInvite struct {
+	MaxUses        int `json:"max_uses"         validate:"min=0,max=1000"`
+	ExpiresInHours int `json:"expires_in_hours" validate:"min=0,max=720"`
+}
+
+// NotificationPreferences changes the notification settings given, leaving
+// the others as they are.
+type NotificationPreferences struct {
+	DigestFrequency string            `json:"digest_frequency"`
+	Deliveries      map[string]string `json:"deliveries"`
+	ReminderHours   int               `json:"reminder_hours" validate:"min=0,max=168"`
+}
+
 type StudyGroupsFilter struct {
-	BaseFilter
+	PageFilter
+	Q              string `json:"q" validate:"max=100"`
+	Sort           string `json:"sort"`
 	StudyGroupName string `json:"study_group_name"`
 	Location       string `json:"location"`
 	MeetingDate    string `json:"meeting_date"`
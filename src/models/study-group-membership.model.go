@@ -0,0 +1,243 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	MembershipRoleOwner     = "owner"
+	MembershipRoleModerator = "moderator"
+	MembershipRoleMember    = "member"
+
+	MembershipStatusActive     = "active"
+	MembershipStatusWaitlisted = "waitlisted"
+	MembershipStatusBanned     = "banned"
+)
+
+var (
+	ErrMembersLimitReached = errors.New("study group members limit reached")
+	ErrAlreadyMember       = errors.New("user is already in study group")
+	ErrAlreadyWaitlisted   = errors.New("user is already waitlisted")
+	ErrNotWaitlisted       = errors.New("user is not waitlisted")
+	ErrNotMember           = errors.New("user is not waitlisted or a member of study group")
+	ErrOwnerOfStudyGroup   = errors.New("user is owner of study group")
+	ErrNotActiveMember     = errors.New("user is not a member of study group")
+	ErrNotBanned           = errors.New("user is not banned from study group")
+	ErrBanned              = errors.New("user is banned from study group")
+	ErrNotOwner            = errors.New("user is not an owner of study group")
+	ErrLastOwner           = errors.New("user is the only owner of study group")
+	ErrNoSuccessor         = errors.New("study group has no members to take over ownership")
+	ErrInviteOnly          = errors.New("study group can only be joined with an invite")
+	ErrStudyGroupFull      = errors.New("study group is full")
+)
+
+type StudyGroupMembership struct {
+	ID           int    `db:"id"             json:"id"`
+	UserID       int    `db:"user_id"        json:"user_id"`
+	StudyGroupID int    `db:"study_group_id" json:"study_group_id"`
+	Role         string `db:"role"           json:"role"`
+	Status       string `db:"status"         json:"status"`
+	JoinedOn     string `db:"joined_on"      json:"joined_on"`
+}
+
+type StudyGroupMemberships []StudyGroupMembership
+
+// StudyGroupMember is a user listed with their role in a study group.
+type StudyGroupMember struct {
+	User
+	Role string `db:"role" json:"role"`
+}
+
+func IsValidMembershipRole(role string) bool {
+	switch role {
+	case MembershipRoleOwner, MembershipRoleModerator, MembershipRoleMember:
+		return true
+	}
+
+	return false
+}
+
+// IsMembershipError reports whether err is one of the membership rule
+// violations above rather than a database failure.
+func IsMembershipError(err error) bool {
+	switch err {
+	case ErrMembersLimitReached, ErrAlreadyMember, ErrAlreadyWaitlisted,
+		ErrNotWaitlisted, ErrNotMember, ErrOwnerOfStudyGroup, ErrNotActiveMember,
+		ErrNotBanned, ErrBanned, ErrNotOwner, ErrLastOwner, ErrNoSuccessor,
+		ErrInviteOnly, ErrStudyGroupFull:
+		return true
+	}
+
+	return false
+}
+
+// CanModerate reports whether the member looks after the study group, as
+// its owner or a moderator.
+func (m StudyGroupMembership) CanModerate() bool {
+	return m.Status == MembershipStatusActive &&
+		(m.Role == MembershipRoleOwner || m.Role == MembershipRoleModerator)
+}
+
+func (m *StudyGroupMembership) Get(db sqlx.Queryer) error {
+	if m.UserID == 0 || m.StudyGroupID == 0 {
+		return errors.New("invalid user id or study group id")
+	}
+
+	return sqlx.Get(db, m,
+		"SELECT * FROM study_group_memberships WHERE user_id = $1 AND study_group_id = $2",
+		m.UserID,
+		m.StudyGroupID,
+	)
+}
+
+func (m *StudyGroupMembership) Create(db sqlx.Queryer) error {
+	return sqlx.Get(db, m,
+	 `INSERT INTO study_group_memberships (user_id, study_group_id, role, status, joined_on)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *`,
+		m.UserID,
+		m.StudyGroupID,
+		m.Role,
+		m.Status,
+		time.Now(),
+	)
+}
+
+func (m *StudyGroupMembership) SetStatus(db sqlx.Execer, status string) error {
+	_, err := db.Exec(
+		"UPDATE study_group_memberships SET status = $1, joined_on = $2 WHERE id = $3",
+		status,
+		time.Now(),
+		m.ID,
+	)
+	if err != nil { return err }
+
+	m.Status = status
+	return nil
+}
+
+func (m *StudyGroupMembership) SetRole(db sqlx.Execer, role string) error {
+	_, err := db.Exec(
+		"UPDATE study_group_memberships SET role = $1 WHERE id = $2",
+		role,
+		m.ID,
+	)
+	if err != nil { return err }
+
+	m.Role = role
+	return nil
+}
+
+func (m *StudyGroupMembership) Delete(db sqlx.Execer) error {
+	_, err := db.Exec("DELETE FROM study_group_memberships WHERE id = $1", m.ID)
+	return err
+}
+
+// GetStudyGroupUsers returns the users of a study group with the given
+// membership status, in the order they joined. Owners are left out so the
+// members list only holds the people who joined the group.
+func GetStudyGroupUsers(db sqlx.Queryer, studyGroupID int, status string) (Users, error) {
+	users := Users{}
+
+	err := sqlx.Select(db, &users,
+	 `SELECT u.*
+		FROM users u
+		JOIN study_group_memberships m ON m.user_id = u.id
+		WHERE m.study_group_id = $1 AND m.status = $2 AND m.role <> $3
+		ORDER BY m.joined_on`,
+		studyGroupID,
+		status,
+		MembershipRoleOwner,
+	)
+
+	return users, err
+}
+
+// GetStudyGroupMembers is GetStudyGroupUsers with each user's role, so
+// moderators can be told apart from the other members.
+func GetStudyGroupMembers(db sqlx.Queryer, studyGroupID int, status string) ([]StudyGroupMember, error) {
+	members := []StudyGroupMember{}
+
+	err := sqlx.Select(db, &members,
+	 `SELECT u.*, m.role
+		FROM users u
+		JOIN study_group_memberships m ON m.user_id = u.id
+		WHERE m.study_group_id = $1 AND m.status = $2 AND m.role <> $3
+		ORDER BY m.joined_on`,
+		studyGroupID,
+		status,
+		MembershipRoleOwner,
+	)
+
+	return members, err
+}
+
+func CountStudyGroupMemberships(db sqlx.Queryer, studyGroupID int, status string) (int, error) {
+	var count int
+
+	err := sqlx.Get(db, &count,
+	 `SELECT count(*)
+		FROM study_group_memberships
+		WHERE study_group_id = $1 AND status = $2 AND role <> $3`,
+		studyGroupID,
+		status,
+		MembershipRoleOwner,
+	)
+
+	return count, err
+}
+
+func GetStudyGroupOwners(db sqlx.Queryer, studyGroupID int) (Users, error) {
+	owners := Users{}
+
+	err := sqlx.Select(db, &owners,
+	 `SELECT u.*
+		FROM users u
+		JOIN study_group_memberships m ON m.user_id = u.id
+		WHERE m.study_group_id = $1 AND m.role = $2`,
+		studyGroupID,
+		MembershipRoleOwner,
+	)
+
+	return owners, err
+}
+
+// GetStudyGroupManagers returns the owners and moderators of a study group,
+// the users who look after its waitlist.
+func GetStudyGroupManagers(db sqlx.Queryer, studyGroupID int) (Users, error) {
+	managers := Users{}
+
+	err := sqlx.Select(db, &managers,
+	 `SELECT u.*
+		FROM users u
+		JOIN study_group_memberships m ON m.user_id = u.id
+		WHERE m.study_group_id = $1 AND m.status = $2 AND m.role IN ($3, $4)`,
+		studyGroupID,
+		MembershipStatusActive,
+		MembershipRoleOwner,
+		MembershipRoleModerator,
+	)
+
+	return managers, err
+}
+
+// GetUserStudyGroups returns the study groups the user is an active member
+// or owner of.
+func GetUserStudyGroups(db sqlx.Queryer, userID int) ([]StudyGroup, error) {
+	studyGroups := []StudyGroup{}
+
+	err := sqlx.Select(db, &studyGroups,
+	 `SELECT sg.*
+		FROM study_groups sg
+		JOIN study_group_memberships m ON m.study_group_id = sg.id
+		WHERE m.user_id = $1 AND m.status = $2
+		ORDER BY sg.id`,
+		userID,
+		MembershipStatusActive,
+	)
+
+	return studyGroups, err
+}
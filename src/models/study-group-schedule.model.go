@@ -0,0 +1,242 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/prosperoa/study-groups/src/recurrence"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	// OccurrenceHorizon is how far ahead occurrences are expanded into the
+	// study_group_occurrences table used by the study group search.
+	OccurrenceHorizon = time.Hour * 24 * 365
+
+	ExDateFormat = "2006-01-02"
+)
+
+// StudyGroupSchedule is when a study group meets. StartsOn is the first
+// meeting, stored as wall clock time in Timezone, and RRule repeats it;
+// meetings on the ExDates are skipped.
+type StudyGroupSchedule struct {
+	ID                int            `db:"id"                 json:"-"`
+	StudyGroupID      int            `db:"study_group_id"     json:"study_group_id"`
+	StartsOn          time.Time      `db:"starts_on"          json:"starts_on"`
+	DurationMinutes   int            `db:"duration_minutes"   json:"duration_minutes"`
+	Timezone          string         `db:"timezone"           json:"timezone"`
+	RRule             null.String    `db:"rrule"              json:"rrule"`
+	ExDates           pq.StringArray `db:"exdates"            json:"exdates"`
+	MaterializedUntil time.Time      `db:"materialized_until" json:"-"`
+	CreatedOn         time.Time      `db:"created_on"         json:"-"`
+	UpdatedOn         time.Time      `db:"updated_on"         json:"-"`
+}
+
+type Occurrence struct {
+	StartsOn time.Time `json:"starts_on"`
+	EndsOn   time.Time `json:"ends_on"`
+}
+
+func (s *StudyGroupSchedule) Get(db sqlx.Queryer, studyGroupID int) error {
+	err := sqlx.Get(db, s,
+		"SELECT * FROM study_group_schedules WHERE study_group_id = $1",
+		studyGroupID,
+	)
+	if err != nil { return err }
+
+	return s.localize()
+}
+
+// Save creates or replaces the schedule of the study group and expands its
+// upcoming occurrences.
+func (s *StudyGroupSchedule) Save(tx *sqlx.Tx) error {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil { return err }
+
+	err = tx.Get(s,
+	 `INSERT INTO study_group_schedules
+			(study_group_id, starts_on, duration_minutes, timezone, rrule, exdates, materialized_until, created_on, updated_on)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $7, $7)
+		ON CONFLICT (study_group_id) DO UPDATE SET
+			starts_on        = EXCLUDED.starts_on,
+			duration_minutes = EXCLUDED.duration_minutes,
+			timezone         = EXCLUDED.timezone,
+			rrule            = EXCLUDED.rrule,
+			exdates          = EXCLUDED.exdates,
+			updated_on       = EXCLUDED.updated_on
+		RETURNING *`,
+		s.StudyGroupID,
+		wallClock(s.StartsOn.In(loc)),
+		s.DurationMinutes,
+		s.Timezone,
+		s.RRule,
+		s.ExDates,
+		time.Now(),
+	)
+	if err != nil { return err }
+
+	if err = s.localize(); err != nil { return err }
+
+	return s.materialize(tx)
+}
+
+func DeleteStudyGroupSchedule(tx *sqlx.Tx, studyGroupID int) error {
+	_, err := tx.Exec(
+		"DELETE FROM study_group_occurrences WHERE study_group_id = $1",
+		studyGroupID,
+	)
+	if err != nil { return err }
+
+	result, err := tx.Exec(
+		"DELETE FROM study_group_schedules WHERE study_group_id = $1",
+		studyGroupID,
+	)
+	if err != nil { return err }
+
+	n, err := result.RowsAffected()
+	if err == nil && n == 0 { err = sql.ErrNoRows }
+
+	return err
+}
+
+// Recurrence turns the schedule into a recurrence.Schedule in its time zone.
+func (s *StudyGroupSchedule) Recurrence() (recurrence.Schedule, error) {
+	var schedule recurrence.Schedule
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil { return schedule, err }
+
+	schedule.Start = s.StartsOn.In(loc)
+
+	if s.RRule.Valid {
+		rule, err := recurrence.ParseInLocation(s.RRule.String, loc)
+		if err != nil { return schedule, err }
+
+		schedule.Rule = &rule
+	}
+
+	for _, date := range s.ExDates {
+		exDate, err := time.ParseInLocation(ExDateFormat, date, loc)
+		if err != nil { return schedule, err }
+
+		schedule.ExDates = append(schedule.ExDates, exDate)
+	}
+
+	return schedule, nil
+}
+
+// Occurrences returns the meetings starting at or after from and before to.
+func (s *StudyGroupSchedule) Occurrences(from, to time.Time) ([]Occurrence, error) {
+	occurrences := []Occurrence{}
+
+	schedule, err := s.Recurrence()
+	if err != nil { return occurrences, err }
+
+	duration := time.Minute * time.Duration(s.DurationMinutes)
+
+	for _, t := range schedule.Between(from, to) {
+		occurrences = append(occurrences, Occurrence{
+			StartsOn: t,
+			EndsOn:   t.Add(duration),
+		})
+	}
+
+	return occurrences, nil
+}
+
+// RefreshStudyGroupOccurrences expands the occurrences of schedules whose
+// horizon falls short of OccurrenceHorizon by more than a day. It's meant to
+// run daily so searches keep seeing a year of meetings.
+func RefreshStudyGroupOccurrences() error {
+	var studyGroupIDs []int
+
+	err := server.DB.Select(&studyGroupIDs,
+		"SELECT study_group_id FROM study_group_schedules WHERE materialized_until < $1",
+		time.Now().Add(OccurrenceHorizon - time.Hour * 24),
+	)
+	if err != nil { return err }
+
+	for _, id := range studyGroupIDs {
+		err := server.Transact(func(tx *sqlx.Tx) error {
+			var schedule StudyGroupSchedule
+
+			err := tx.Get(&schedule,
+				"SELECT * FROM study_group_schedules WHERE study_group_id = $1 FOR UPDATE",
+				id,
+			)
+			if err != nil { return err }
+
+			if err = schedule.localize(); err != nil { return err }
+
+			return schedule.materialize(tx)
+		})
+
+		// one broken schedule shouldn't hold up the rest
+		if err != nil { log.Println(err.Error()) }
+	}
+
+	return nil
+}
+
+// materialize replaces the stored occurrences of the schedule with the
+// ones from today up to the horizon.
+func (s *StudyGroupSchedule) materialize(tx *sqlx.Tx) error {
+	schedule, err := s.Recurrence()
+	if err != nil { return err }
+
+	now := time.Now().In(schedule.Start.Location())
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	until := time.Now().Add(OccurrenceHorizon)
+
+	_, err = tx.Exec(
+		"DELETE FROM study_group_occurrences WHERE study_group_id = $1",
+		s.StudyGroupID,
+	)
+	if err != nil { return err }
+
+	for _, t := range schedule.Between(from, until) {
+		_, err = tx.Exec(
+			"INSERT INTO study_group_occurrences (study_group_id, starts_on, local_date) VALUES ($1, $2, $3)",
+			s.StudyGroupID,
+			wallClock(t.UTC()),
+			t.Format(ExDateFormat),
+		)
+		if err != nil { return err }
+	}
+
+	_, err = tx.Exec(
+		"UPDATE study_group_schedules SET materialized_until = $1 WHERE id = $2",
+		until,
+		s.ID,
+	)
+	if err == nil { s.MaterializedUntil = until }
+
+	return err
+}
+
+// localize reads StartsOn, which comes back from the database as wall clock
+// time labeled UTC, in the schedule's time zone.
+func (s *StudyGroupSchedule) localize() error {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil { return err }
+
+	t := s.StartsOn
+	s.StartsOn = time.Date(
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc,
+	)
+
+	return nil
+}
+
+// wallClock drops the time zone of t so timestamp columns store its wall
+// clock time as is.
+func wallClock(t time.Time) time.Time {
+	return time.Date(
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC,
+	)
+}
@@ -0,0 +1,308 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	SessionStatusScheduled = "scheduled"
+	SessionStatusCancelled = "cancelled"
+
+	// CheckInCodeTTL is how long the code shown at a session can be used to
+	// check in.
+	CheckInCodeTTL = time.Minute * 10
+
+	checkInCodeLength = 6
+
+	// letters and digits that can't be mistaken for one another when read
+	// off a screen
+	codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionCancelled   = errors.New("session was cancelled")
+	ErrInvalidCheckInCode = errors.New("invalid or expired check-in code")
+)
+
+// StudyGroupSession is a single meeting of a study group. Times are stored
+// in UTC. A session created at the time of one of the occurrences of the
+// study group's schedule stands in for it, and OccurrenceStartsOn keeps
+// which one so the occurrence stays replaced when the session is moved or
+// cancelled.
+type StudyGroupSession struct {
+	ID                   int         `db:"id"                      json:"id"`
+	StudyGroupID         int         `db:"study_group_id"          json:"study_group_id"`
+	StartsOn             time.Time   `db:"starts_on"               json:"starts_on"`
+	EndsOn               time.Time   `db:"ends_on"                 json:"ends_on"`
+	OccurrenceStartsOn   null.Time   `db:"occurrence_starts_on"    json:"occurrence_starts_on"`
+	Location             null.String `db:"location"                json:"location"`
+	Status               string      `db:"status"                  json:"status"`
+	CheckInCodeHash      null.String `db:"checkin_code_hash"       json:"-"`
+	CheckInCodeExpiresOn null.Time   `db:"checkin_code_expires_on" json:"-"`
+	CreatedOn            time.Time   `db:"created_on"              json:"-"`
+	UpdatedOn            time.Time   `db:"updated_on"              json:"-"`
+}
+
+// MemberAttendance is a session along with when the member checked in to
+// it, if they did.
+type MemberAttendance struct {
+	StudyGroupSession
+	CheckedInOn null.Time `db:"checked_in_on" json:"checked_in_on"`
+}
+
+// AttendanceSummary is how many of the study group's past sessions a
+// member or waitlisted user came to.
+type AttendanceSummary struct {
+	UserID         int         `db:"user_id"          json:"user_id"`
+	FirstName      string      `db:"first_name"       json:"first_name"`
+	LastName       null.String `db:"last_name"        json:"last_name"`
+	Role           string      `db:"role"             json:"role"`
+	Status         string      `db:"status"           json:"status"`
+	Attended       int         `db:"attended"         json:"attended"`
+	Sessions       int         `db:"sessions"         json:"sessions"`
+	LastAttendedOn null.Time   `db:"last_attended_on" json:"last_attended_on"`
+}
+
+func (s *StudyGroupSession) Create(db sqlx.Queryer) error {
+	return sqlx.Get(db, s,
+	 `INSERT INTO study_group_sessions (study_group_id, starts_on, ends_on, occurrence_starts_on, location, status, created_on, updated_on)
+		VALUES ($1, $2, $3, (
+			SELECT starts_on FROM study_group_occurrences
+			WHERE study_group_id = $1 AND starts_on = $2
+			LIMIT 1
+		), $4, $5, $6, $6)
+		RETURNING *`,
+		s.StudyGroupID,
+		s.StartsOn.UTC(),
+		s.EndsOn.UTC(),
+		s.Location,
+		SessionStatusScheduled,
+		time.Now(),
+	)
+}
+
+// GetForUpdate loads the session of the study group and locks it until tx
+// ends.
+func (s *StudyGroupSession) GetForUpdate(tx *sqlx.Tx, studyGroupID, id int) error {
+	err := tx.Get(s,
+		"SELECT * FROM study_group_sessions WHERE id = $1 AND study_group_id = $2 FOR UPDATE",
+		id,
+		studyGroupID,
+	)
+	if err == sql.ErrNoRows { return ErrSessionNotFound }
+
+	return err
+}
+
+func (s *StudyGroupSession) Cancel(tx *sqlx.Tx) error {
+	if s.Status == SessionStatusCancelled { return ErrSessionCancelled }
+
+	return tx.Get(s,
+	 `UPDATE study_group_sessions
+		SET status = $1, checkin_code_hash = NULL, checkin_code_expires_on = NULL, updated_on = $2
+		WHERE id = $3
+		RETURNING *`,
+		SessionStatusCancelled,
+		time.Now(),
+		s.ID,
+	)
+}
+
+func (s *StudyGroupSession) Reschedule(tx *sqlx.Tx, startsOn, endsOn time.Time, location null.String) error {
+	if s.Status == SessionStatusCancelled { return ErrSessionCancelled }
+
+	return tx.Get(s,
+	 `UPDATE study_group_sessions
+		SET starts_on = $1, ends_on = $2, location = $3, updated_on = $4
+		WHERE id = $5
+		RETURNING *`,
+		startsOn.UTC(),
+		endsOn.UTC(),
+		location,
+		time.Now(),
+		s.ID,
+	)
+}
+
+// NewCheckInCode replaces the session's check-in code with a new one that
+// expires after CheckInCodeTTL. Only a hash of the code is stored.
+func (s *StudyGroupSession) NewCheckInCode(tx *sqlx.Tx) (string, time.Time, error) {
+	expiresOn := time.Now().Add(CheckInCodeTTL)
+
+	if s.Status == SessionStatusCancelled {
+		return "", expiresOn, ErrSessionCancelled
+	}
+
+	code, err := randomCode(checkInCodeLength)
+	if err != nil { return "", expiresOn, err }
+
+	_, err = tx.Exec(
+		"UPDATE study_group_sessions SET checkin_code_hash = $1, checkin_code_expires_on = $2 WHERE id = $3",
+		server.HashToken(code),
+		expiresOn,
+		s.ID,
+	)
+
+	return code, expiresOn, err
+}
+
+// CheckIn records that the user came to the session. Waitlisted users can
+// check in too, so owners can see who shows up before letting them in.
+// Checking in twice is not an error.
+func (s *StudyGroupSession) CheckIn(tx *sqlx.Tx, userID int, code string) error {
+	var validCode bool
+
+	if s.Status == SessionStatusCancelled { return ErrSessionCancelled }
+
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: s.StudyGroupID}
+	err := membership.Get(tx)
+
+	switch {
+	case err == sql.ErrNoRows, err == nil && membership.Status == MembershipStatusBanned:
+		return ErrNotMember
+	case err != nil:
+		return err
+	}
+
+	err = tx.Get(&validCode,
+	 `SELECT exists(
+			SELECT 1 FROM study_group_sessions
+			WHERE id = $1 AND checkin_code_hash = $2 AND checkin_code_expires_on > $3
+		)`,
+		s.ID,
+		server.HashToken(code),
+		time.Now(),
+	)
+
+	switch {
+	case err != nil:
+		return err
+	case !validCode:
+		return ErrInvalidCheckInCode
+	}
+
+	_, err = tx.Exec(
+	 `INSERT INTO session_attendance (session_id, user_id, checked_in_on)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (session_id, user_id) DO NOTHING`,
+		s.ID,
+		userID,
+		time.Now(),
+	)
+
+	return err
+}
+
+// IsSessionError reports whether err is one of the session rule violations
+// above rather than a database failure.
+func IsSessionError(err error) bool {
+	switch err {
+	case ErrSessionNotFound, ErrSessionCancelled, ErrInvalidCheckInCode:
+		return true
+	}
+
+	return false
+}
+
+func GetStudyGroupSessions(db sqlx.Queryer, studyGroupID int) ([]StudyGroupSession, error) {
+	sessions := []StudyGroupSession{}
+
+	err := sqlx.Select(db, &sessions,
+		"SELECT * FROM study_group_sessions WHERE study_group_id = $1 ORDER BY starts_on",
+		studyGroupID,
+	)
+
+	return sessions, err
+}
+
+func GetSessionAttendees(db sqlx.Queryer, studyGroupID, sessionID int) (Users, error) {
+	attendees := Users{}
+
+	err := sqlx.Select(db, &attendees,
+	 `SELECT u.*
+		FROM users u
+		JOIN session_attendance a ON a.user_id = u.id
+		JOIN study_group_sessions s ON s.id = a.session_id
+		WHERE a.session_id = $1 AND s.study_group_id = $2
+		ORDER BY a.checked_in_on`,
+		sessionID,
+		studyGroupID,
+	)
+
+	return attendees, err
+}
+
+// GetMemberAttendance returns every session of the study group and whether
+// the user checked in to it.
+func GetMemberAttendance(db sqlx.Queryer, studyGroupID, userID int) ([]MemberAttendance, error) {
+	attendance := []MemberAttendance{}
+
+	err := sqlx.Select(db, &attendance,
+	 `SELECT s.*, a.checked_in_on
+		FROM study_group_sessions s
+		LEFT JOIN session_attendance a ON a.session_id = s.id AND a.user_id = $2
+		WHERE s.study_group_id = $1
+		ORDER BY s.starts_on`,
+		studyGroupID,
+		userID,
+	)
+
+	return attendance, err
+}
+
+// GetAttendanceSummaries counts the sessions each member and waitlisted
+// user of the study group came to, out of the sessions that have started
+// and weren't cancelled. Waitlisted users come first, most regular first.
+func GetAttendanceSummaries(db sqlx.Queryer, studyGroupID int) ([]AttendanceSummary, error) {
+	summaries := []AttendanceSummary{}
+
+	err := sqlx.Select(db, &summaries,
+	 `WITH past_sessions AS (
+			SELECT id, starts_on FROM study_group_sessions
+			WHERE study_group_id = $1 AND status = $2 AND starts_on <= $3
+		)
+		SELECT
+			u.id AS user_id, u.first_name, u.last_name, m.role, m.status,
+			count(s.id) AS attended,
+			(SELECT count(*) FROM past_sessions) AS sessions,
+			max(s.starts_on) AS last_attended_on
+		FROM study_group_memberships m
+		JOIN users u ON u.id = m.user_id
+		LEFT JOIN session_attendance a ON a.user_id = m.user_id
+		LEFT JOIN past_sessions s ON s.id = a.session_id
+		WHERE m.study_group_id = $1 AND m.status IN ($4, $5)
+		GROUP BY u.id, m.role, m.status
+		ORDER BY m.status = $4, attended DESC, u.id`,
+		studyGroupID,
+		SessionStatusScheduled,
+		time.Now().UTC(),
+		MembershipStatusActive,
+		MembershipStatusWaitlisted,
+	)
+
+	return summaries, err
+}
+
+// randomCode returns a code of length letters and digits from codeAlphabet.
+func randomCode(length int) (string, error) {
+	b := make([]byte, length)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// the modulo bias over 31 letters doesn't matter for codes that expire
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i]) % len(codeAlphabet)]
+	}
+
+	return string(b), nil
+}
@@ -1,122 +1,567 @@
 package models
 
 import (
-	"errors"
-	"reflect"
-	"strconv"
-	"strings"
+	"database/sql"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/types"
-	"github.com/prosperoa/study-groups/src/utils"
 	"gopkg.in/guregu/null.v3"
 )
 
+// Admission policies decide what happens when a user asks to join a study
+// group. Manual leaves every request on the waitlist for the owner, auto
+// accept makes users members right away while spots are open and auto
+// promote also moves waitlisted users in as spots open up.
+const (
+	AdmissionPolicyManual      = "manual"
+	AdmissionPolicyAutoAccept  = "auto_accept"
+	AdmissionPolicyAutoPromote = "auto_promote"
+)
+
+// Visibilities decide who can find a study group. Public groups show up in
+// searches, unlisted ones are only reached by ID or invite, and private ones
+// also hide their details and members from non-members and can only be
+// joined with an invite.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 type StudyGroup struct {
-	ID             int                 `db:"id"              json:"id"`
-	UserID         int                 `db:"user_id"         json:"user_id"`
-	Name           string              `db:"name"            json:"name"`
-	Members        null.String         `db:"members"         json:"members"`
-	MembersLimit   null.Int            `db:"members_limit"   json:"members_limit"`
-	AvailableSpots int                 `db:"available_spots" json:"available_spots"`
-	Location       null.String         `db:"location"        json:"location"`
-	Description    null.String         `db:"description"     json:"description"`
-	MeetingDate    null.String         `db:"meeting_date"    json:"meeting_date"`
-	Course         types.NullJSONText  `db:"course"          json:"course"`
-	Waitlist       null.String         `db:"waitlist"        json:"waitlist"`
-	CreatedAt      string              `db:"created_on"      json:"-"`
-	UpdatedAt      string              `db:"updated_on"      json:"-"`
-}
-
-func (sg *StudyGroup) MoveUserFromWaitlistToMembers(userID string) error {
-	if !utils.Contains(strings.Split(sg.Waitlist.String, ","), userID) {
-		return errors.New("user is not waitlisted")
-	}
-
-	members := strings.Split(sg.Members.String, ",")
-	waitlist := strings.Split(sg.Waitlist.String, ",")
-
-	if sg.Members.String == "" {
-		sg.Members = null.StringFrom(userID)
-	} else {
-		members = append(members, userID)
-		sg.Members = null.StringFrom(strings.Join(members, ","))
+	ID              int                `db:"id"               json:"id"`
+	UserID          int                `db:"user_id"          json:"user_id"`
+	Name            string             `db:"name"             json:"name"`
+	MembersLimit    null.Int           `db:"members_limit"    json:"members_limit"`
+	AvailableSpots  int                `db:"available_spots"  json:"available_spots"`
+	Location        null.String        `db:"location"         json:"location"`
+	Description     null.String        `db:"description"      json:"description"`
+	MeetingDate     null.String        `db:"meeting_date"     json:"meeting_date"`
+	Timezone        string             `db:"timezone"         json:"timezone"`
+	Course          types.NullJSONText `db:"course"           json:"course"`
+	AdmissionPolicy string             `db:"admission_policy" json:"admission_policy"`
+	Visibility      string             `db:"visibility"       json:"visibility"`
+	CreatedAt       string             `db:"created_on"       json:"-"`
+	UpdatedAt       string             `db:"updated_on"       json:"-"`
+}
+
+// GetForUpdate loads the study group and locks its row until tx ends.
+// Every membership change takes this lock first, so changes to the same
+// group run one after another.
+func (sg *StudyGroup) GetForUpdate(tx *sqlx.Tx, id interface{}) error {
+	return tx.Get(sg, "SELECT * FROM study_groups WHERE id = $1 FOR UPDATE", id)
+}
+
+// MeetingTime returns the meeting date, which is stored as wall clock time
+// in the study group's time zone.
+func (sg StudyGroup) MeetingTime() (time.Time, error) {
+	loc, err := time.LoadLocation(sg.Timezone)
+	if err != nil { return time.Time{}, err }
+
+	t, err := time.Parse(time.RFC3339Nano, sg.MeetingDate.String)
+	if err != nil { return t, err }
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), nil
+}
+
+// DefaultTimezone is the time zone of study groups created without one.
+const DefaultTimezone = "UTC"
+
+// IsValidTimezone reports whether tz names an IANA time zone. The meetings
+// view converts meeting dates with it, so Go's Local isn't allowed.
+func IsValidTimezone(tz string) bool {
+	if tz == "" || tz == "Local" { return false }
+
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
+
+func IsValidAdmissionPolicy(policy string) bool {
+	switch policy {
+	case AdmissionPolicyManual, AdmissionPolicyAutoAccept, AdmissionPolicyAutoPromote:
+		return true
 	}
 
-	sg.Waitlist = null.StringFrom(strings.Join(utils.Splice(waitlist, userID), ","))
+	return false
+}
 
-	return nil
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+
+	return false
+}
+
+// Join adds the user to the study group. They become a member right away
+// if the admission policy accepts joins automatically and a spot is open,
+// otherwise they're put on the waitlist.
+func (sg *StudyGroup) Join(tx *sqlx.Tx, userID int) (StudyGroupMembership, error) {
+	if sg.Visibility == VisibilityPrivate {
+		return StudyGroupMembership{}, ErrInviteOnly
+	}
+
+	return sg.join(tx, userID, sg.AdmissionPolicy != AdmissionPolicyManual, true)
+}
+
+// JoinWithInvite adds the user to the study group through one of its
+// invites. Invited users are approved up front: they take an open spot
+// whatever the admission policy. When the group is full the join is refused
+// with ErrStudyGroupFull and the invite isn't used up, so it can be used
+// again once a spot opens.
+func (sg *StudyGroup) JoinWithInvite(tx *sqlx.Tx, userID int, invite *Invite) (StudyGroupMembership, error) {
+	if invite.StudyGroupID != sg.ID { return StudyGroupMembership{}, ErrInviteNotFound }
+
+	membership, err := sg.join(tx, userID, true, false)
+	if err != nil { return membership, err }
+
+	return membership, invite.Use(tx)
+}
+
+// join adds the user to the members if approved and a spot is open, and to
+// the waitlist otherwise. Approved users who can't wait get
+// ErrStudyGroupFull instead of a place on the waitlist.
+func (sg *StudyGroup) join(tx *sqlx.Tx, userID int, approved, canWait bool) (StudyGroupMembership, error) {
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: sg.ID}
+	err := membership.Get(tx)
+
+	switch {
+	case err == nil && membership.Role == MembershipRoleOwner:
+		return membership, ErrOwnerOfStudyGroup
+	case err == nil && membership.Status == MembershipStatusBanned:
+		return membership, ErrBanned
+	case err == nil && membership.Status == MembershipStatusWaitlisted:
+		return membership, ErrAlreadyWaitlisted
+	case err == nil:
+		return membership, ErrAlreadyMember
+	case err != sql.ErrNoRows:
+		return membership, err
+	}
+
+	membership.Role = MembershipRoleMember
+	membership.Status = MembershipStatusWaitlisted
+
+	if approved {
+		tookSpot, err := sg.takeSpot(tx)
+		if err != nil { return membership, err }
+
+		switch {
+		case tookSpot:
+			membership.Status = MembershipStatusActive
+		case !canWait:
+			return membership, ErrStudyGroupFull
+		}
+	}
+
+	return membership, membership.Create(tx)
 }
 
+func (sg *StudyGroup) MoveUserFromWaitlistToMembers(tx *sqlx.Tx, userID int) error {
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: sg.ID}
+	err := membership.Get(tx)
 
-func (sg *StudyGroup) AddUserToWaitlist(userID string) error {
-	if sg.AvailableSpots == 0 {
-		return errors.New("study group members limit reached")
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrNotWaitlisted
+	case err != nil:
+		return err
+	case membership.Status != MembershipStatusWaitlisted:
+		return ErrNotWaitlisted
 	}
 
-	if utils.Contains(strings.Split(sg.Members.String, ","), userID) {
-		return errors.New("user is already in study group")
+	tookSpot, err := sg.takeSpot(tx)
+
+	switch {
+	case err != nil:
+		return err
+	case !tookSpot:
+		return ErrMembersLimitReached
 	}
 
-	uID, _ := strconv.Atoi(userID)
-	if sg.UserID == uID {
-		return errors.New("user is owner of group")
+	return membership.SetStatus(tx, MembershipStatusActive)
+}
+
+// RemoveUser takes the user off the members or the waitlist of the study
+// group. With the auto promote policy the spot a member leaves open goes to
+// the first user on the waitlist; the IDs of promoted users are returned.
+// An owner can leave as long as someone is left to own the group, see
+// handOffOwnership.
+func (sg *StudyGroup) RemoveUser(tx *sqlx.Tx, userID int) ([]int, error) {
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: sg.ID}
+	err := membership.Get(tx)
+
+	switch {
+	case err == sql.ErrNoRows, err == nil && membership.Status == MembershipStatusBanned:
+		return nil, ErrNotMember
+	case err != nil:
+		return nil, err
+	case membership.Role != MembershipRoleOwner:
+		return sg.removeMembership(tx, membership, false)
 	}
 
-	waitlist := strings.Split(sg.Waitlist.String, ",")
-	if utils.Contains(waitlist, userID) {
-		return errors.New("user is already a member of study group")
+	if err = sg.handOffOwnership(tx, userID); err != nil {
+		return nil, err
 	}
 
-	if sg.Waitlist.String == "" {
-		sg.Waitlist = null.StringFrom(userID)
-	} else {
-		waitlist = append(waitlist, userID)
-		sg.Waitlist = null.StringFrom(strings.Join(waitlist, ","))
+	if err = membership.Delete(tx); err != nil {
+		return nil, err
 	}
 
-	sg.AvailableSpots -= 1
+	return sg.recountAvailableSpots(tx)
+}
+
+// RejectWaitlistedUser declines the user's request to join. Banned users
+// can't ask to join again.
+func (sg *StudyGroup) RejectWaitlistedUser(tx *sqlx.Tx, userID int, ban bool) error {
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: sg.ID}
+	err := membership.Get(tx)
 
-	return nil
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrNotWaitlisted
+	case err != nil:
+		return err
+	case membership.Status != MembershipStatusWaitlisted:
+		return ErrNotWaitlisted
+	}
+
+	_, err = sg.removeMembership(tx, membership, ban)
+	return err
 }
 
-func (sg *StudyGroup) RemoveUser(userID string) (string, null.String, error) {
-	members := strings.Split(sg.Members.String, ",")
-	waitlist := strings.Split(sg.Waitlist.String, ",")
+// RemoveMember kicks the user out of the study group, optionally banning
+// them from joining again. Like RemoveUser it returns the IDs of the users
+// promoted into the spot.
+func (sg *StudyGroup) RemoveMember(tx *sqlx.Tx, userID int, ban bool) ([]int, error) {
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: sg.ID}
+	err := membership.Get(tx)
 
-	uID, _ := strconv.Atoi(userID)
-	if sg.UserID == uID {
-		return "", null.String{}, errors.New("user is owner of study group")
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNotActiveMember
+	case err != nil:
+		return nil, err
+	case membership.Status != MembershipStatusActive:
+		return nil, ErrNotActiveMember
+	case membership.Role == MembershipRoleOwner:
+		return nil, ErrOwnerOfStudyGroup
 	}
 
-	if !utils.Contains(members, userID) && !utils.Contains(waitlist, userID) {
-		return "", null.String{}, errors.New("user is not waitlisted or a member of study group")
+	return sg.removeMembership(tx, membership, ban)
+}
+
+func (sg *StudyGroup) Unban(tx *sqlx.Tx, userID int) error {
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: sg.ID}
+	err := membership.Get(tx)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrNotBanned
+	case err != nil:
+		return err
+	case membership.Status != MembershipStatusBanned:
+		return ErrNotBanned
 	}
 
-	var sgField *null.String
-	var field *[]string
-	var columnName string
+	return membership.Delete(tx)
+}
+
+// SetMemberRole gives an active member of the study group a new role.
+// Owners don't take up spots, so the open spots are recounted and, with
+// the auto promote policy, filled; the IDs of promoted users are returned.
+// The last owner can't step down, ownership has to be transferred first.
+func (sg *StudyGroup) SetMemberRole(tx *sqlx.Tx, userID int, role string) ([]int, error) {
+	membership := StudyGroupMembership{UserID: userID, StudyGroupID: sg.ID}
+	err := membership.Get(tx)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNotActiveMember
+	case err != nil:
+		return nil, err
+	case membership.Status != MembershipStatusActive:
+		return nil, ErrNotActiveMember
+	case membership.Role == role:
+		return nil, nil
+	}
 
-	if utils.Contains(members, userID) {
-		sgField = &sg.Members
-		field = &members
+	if membership.Role == MembershipRoleOwner {
+		next, err := sg.nextOwner(tx, userID)
 
-		f, _ := reflect.TypeOf(sg).Elem().FieldByName("Members")
-		columnName = f.Tag.Get("db")
-	} else {
-		sgField = &sg.Waitlist
-		field = &waitlist
+		switch {
+		case err == ErrNoSuccessor, err == nil && next.Role != MembershipRoleOwner:
+			return nil, ErrLastOwner
+		case err != nil:
+			return nil, err
+		}
+
+		if sg.UserID == userID {
+			if err = sg.setOwner(tx, next.UserID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = membership.SetRole(tx, role); err != nil {
+		return nil, err
+	}
+
+	return sg.recountAvailableSpots(tx)
+}
+
+// TransferOwnership makes the active member toUserID the owner of the
+// study group in place of fromUserID, who stays on as a moderator.
+func (sg *StudyGroup) TransferOwnership(tx *sqlx.Tx, fromUserID, toUserID int) ([]int, error) {
+	from := StudyGroupMembership{UserID: fromUserID, StudyGroupID: sg.ID}
+	to := StudyGroupMembership{UserID: toUserID, StudyGroupID: sg.ID}
+
+	err := from.Get(tx)
 
-		f, _ := reflect.TypeOf(sg).Elem().FieldByName("Waitlist")
-		columnName = f.Tag.Get("db")
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNotOwner
+	case err != nil:
+		return nil, err
+	case from.Role != MembershipRoleOwner:
+		return nil, ErrNotOwner
 	}
 
-	if len(*field) > 1 {
-		*sgField = null.StringFrom(strings.Join(utils.Splice(*field, userID), ","))
+	err = to.Get(tx)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, ErrNotActiveMember
+	case err != nil:
+		return nil, err
+	case to.Status != MembershipStatusActive:
+		return nil, ErrNotActiveMember
+	case to.Role == MembershipRoleOwner:
+		return nil, ErrOwnerOfStudyGroup
+	}
+
+	if err = to.SetRole(tx, MembershipRoleOwner); err != nil {
+		return nil, err
+	}
+
+	if err = from.SetRole(tx, MembershipRoleModerator); err != nil {
+		return nil, err
+	}
+
+	if err = sg.setOwner(tx, toUserID); err != nil {
+		return nil, err
+	}
+
+	return sg.recountAvailableSpots(tx)
+}
+
+// RemoveUserFromStudyGroups takes the user out of every study group before
+// their account is deleted, handing off the groups they own. Groups left
+// with nobody to own them are deleted.
+func RemoveUserFromStudyGroups(tx *sqlx.Tx, userID int) error {
+	var studyGroupIDs []int
+
+	// locked in id order so two account deletions can't deadlock
+	err := tx.Select(&studyGroupIDs,
+	 `SELECT study_group_id FROM study_group_memberships
+		WHERE user_id = $1 AND status <> $2
+		ORDER BY study_group_id`,
+		userID,
+		MembershipStatusBanned,
+	)
+	if err != nil { return err }
+
+	for _, id := range studyGroupIDs {
+		var sg StudyGroup
+
+		if err = sg.GetForUpdate(tx, id); err != nil {
+			return err
+		}
+
+		_, err = sg.RemoveUser(tx, userID)
+
+		if err == ErrNoSuccessor {
+			_, err = tx.Exec("DELETE FROM study_groups WHERE id = $1", id)
+		}
+
+		if err != nil { return err }
+	}
+
+	return nil
+}
+
+// handOffOwnership makes sure the study group keeps an owner once userID
+// leaves it, promoting the next owner if they aren't one already.
+func (sg *StudyGroup) handOffOwnership(tx *sqlx.Tx, userID int) error {
+	successor, err := sg.nextOwner(tx, userID)
+	if err != nil { return err }
+
+	if successor.Role != MembershipRoleOwner {
+		if err = successor.SetRole(tx, MembershipRoleOwner); err != nil {
+			return err
+		}
+	}
+
+	if sg.UserID != userID { return nil }
+
+	return sg.setOwner(tx, successor.UserID)
+}
+
+// nextOwner picks who owns the study group after userID: another owner if
+// there is one, otherwise the longest standing moderator, otherwise the
+// longest standing member.
+func (sg *StudyGroup) nextOwner(tx *sqlx.Tx, userID int) (StudyGroupMembership, error) {
+	var successor StudyGroupMembership
+
+	err := tx.Get(&successor,
+	 `SELECT * FROM study_group_memberships
+		WHERE study_group_id = $1 AND user_id <> $2 AND status = $3
+		ORDER BY
+			CASE role WHEN $4 THEN 0 WHEN $5 THEN 1 ELSE 2 END,
+			joined_on, id
+		LIMIT 1
+		FOR UPDATE`,
+		sg.ID,
+		userID,
+		MembershipStatusActive,
+		MembershipRoleOwner,
+		MembershipRoleModerator,
+	)
+
+	if err == sql.ErrNoRows { err = ErrNoSuccessor }
+
+	return successor, err
+}
+
+// setOwner points the study group at a new primary owner, the one shown as
+// its creator.
+func (sg *StudyGroup) setOwner(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec(
+		"UPDATE study_groups SET user_id = $1 WHERE id = $2",
+		userID,
+		sg.ID,
+	)
+	if err != nil { return err }
+
+	sg.UserID = userID
+	return nil
+}
+
+// recountAvailableSpots recounts the open spots after members changed
+// roles, since only members other than owners take up a spot, and fills
+// them from the waitlist.
+func (sg *StudyGroup) recountAvailableSpots(tx *sqlx.Tx) ([]int, error) {
+	err := tx.Get(&sg.AvailableSpots,
+	 `UPDATE study_groups
+		SET available_spots = GREATEST(0, members_limit - (
+			SELECT count(*) FROM study_group_memberships
+			WHERE study_group_id = $1 AND status = $2 AND role <> $3
+		))
+		WHERE id = $1
+		RETURNING available_spots`,
+		sg.ID,
+		MembershipStatusActive,
+		MembershipRoleOwner,
+	)
+	if err != nil { return nil, err }
+
+	return sg.PromoteFromWaitlist(tx)
+}
+
+// removeMembership deletes the membership, or keeps it as a ban, and gives
+// the spot of an active member back to the study group.
+func (sg *StudyGroup) removeMembership(tx *sqlx.Tx, membership StudyGroupMembership, ban bool) ([]int, error) {
+	wasActive := membership.Status == MembershipStatusActive &&
+		membership.Role != MembershipRoleOwner
+
+	var err error
+	if ban {
+		err = membership.SetStatus(tx, MembershipStatusBanned)
 	} else {
-		*sgField = null.String{}
+		err = membership.Delete(tx)
+	}
+
+	if err != nil || !wasActive {
+		return nil, err
+	}
+
+	if err = sg.updateAvailableSpots(tx, 1); err != nil {
+		return nil, err
 	}
 
-	sg.AvailableSpots += 1
+	return sg.PromoteFromWaitlist(tx)
+}
+
+// PromoteFromWaitlist fills the open spots of an auto promote study group
+// with waitlisted users, first come first served, and returns their IDs.
+func (sg *StudyGroup) PromoteFromWaitlist(tx *sqlx.Tx) ([]int, error) {
+	var promoted []int
+
+	if sg.AdmissionPolicy != AdmissionPolicyAutoPromote {
+		return promoted, nil
+	}
+
+	for sg.AvailableSpots > 0 {
+		var next StudyGroupMembership
+
+		err := tx.Get(&next,
+		 `SELECT * FROM study_group_memberships
+			WHERE study_group_id = $1 AND status = $2
+			ORDER BY joined_on, id
+			LIMIT 1
+			FOR UPDATE`,
+			sg.ID,
+			MembershipStatusWaitlisted,
+		)
+
+		switch {
+		case err == sql.ErrNoRows:
+			return promoted, nil
+		case err != nil:
+			return promoted, err
+		}
+
+		if err = next.SetStatus(tx, MembershipStatusActive); err != nil {
+			return promoted, err
+		}
+
+		if err = sg.updateAvailableSpots(tx, -1); err != nil {
+			return promoted, err
+		}
+
+		promoted = append(promoted, next.UserID)
+	}
+
+	return promoted, nil
+}
+
+// takeSpot claims one of the open spots of the study group. The check and
+// the decrement happen in one statement so two joins can't both take the
+// last spot.
+func (sg *StudyGroup) takeSpot(tx *sqlx.Tx) (bool, error) {
+	err := tx.Get(
+		&sg.AvailableSpots,
+		"UPDATE study_groups SET available_spots = available_spots - 1 WHERE id = $1 AND available_spots > 0 RETURNING available_spots",
+		sg.ID,
+	)
+
+	switch {
+	case err == sql.ErrNoRows:
+		sg.AvailableSpots = 0
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
 
-	return columnName, *sgField, nil
+func (sg *StudyGroup) updateAvailableSpots(tx *sqlx.Tx, delta int) error {
+	return tx.Get(
+		&sg.AvailableSpots,
+		"UPDATE study_groups SET available_spots = available_spots + $1 WHERE id = $2 RETURNING available_spots",
+		delta,
+		sg.ID,
+	)
 }
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+var (
+	ErrThreadNotFound  = errors.New("thread not found")
+	ErrMessageNotFound = errors.New("message not found")
+	ErrThreadLocked    = errors.New("thread is locked")
+	ErrNotAuthor       = errors.New("user is not the author")
+)
+
+// Thread is a discussion inside a study group. Deleted threads are kept,
+// hidden, so moderators' actions can be looked into later.
+type Thread struct {
+	ID            int       `db:"id"              json:"id"`
+	StudyGroupID  int       `db:"study_group_id"  json:"study_group_id"`
+	UserID        null.Int  `db:"user_id"         json:"user_id"`
+	Title         string    `db:"title"           json:"title"`
+	Locked        bool      `db:"locked"          json:"locked"`
+	LastMessageOn time.Time `db:"last_message_on" json:"last_message_on"`
+	DeletedOn     null.Time `db:"deleted_on"      json:"-"`
+	CreatedOn     time.Time `db:"created_on"      json:"created_on"`
+	UpdatedOn     time.Time `db:"updated_on"      json:"-"`
+}
+
+// IsThreadError reports whether err is one of the thread rule violations
+// above rather than a database failure.
+func IsThreadError(err error) bool {
+	switch err {
+	case ErrThreadNotFound, ErrMessageNotFound, ErrThreadLocked, ErrNotAuthor:
+		return true
+	}
+
+	return false
+}
+
+// Create starts the thread with its first message.
+func (t *Thread) Create(tx *sqlx.Tx, body string) (Message, error) {
+	err := tx.Get(t,
+	 `INSERT INTO threads (study_group_id, user_id, title, last_message_on, created_on, updated_on)
+		VALUES ($1, $2, $3, $4, $4, $4)
+		RETURNING *`,
+		t.StudyGroupID,
+		t.UserID,
+		t.Title,
+		time.Now(),
+	)
+	if err != nil { return Message{}, err }
+
+	return t.AddMessage(tx, int(t.UserID.Int64), body)
+}
+
+func (t *Thread) Get(db sqlx.Queryer) error {
+	err := sqlx.Get(db, t,
+		"SELECT * FROM threads WHERE id = $1 AND study_group_id = $2 AND deleted_on IS NULL",
+		t.ID,
+		t.StudyGroupID,
+	)
+	if err == sql.ErrNoRows { return ErrThreadNotFound }
+
+	return err
+}
+
+// GetForUpdate is Get, locking the thread until tx ends.
+func (t *Thread) GetForUpdate(tx *sqlx.Tx) error {
+	err := tx.Get(t,
+		"SELECT * FROM threads WHERE id = $1 AND study_group_id = $2 AND deleted_on IS NULL FOR UPDATE",
+		t.ID,
+		t.StudyGroupID,
+	)
+	if err == sql.ErrNoRows { return ErrThreadNotFound }
+
+	return err
+}
+
+// AddMessage posts a message to the thread. Nobody can post to a locked
+// thread, moderators included; they have to unlock it first.
+func (t *Thread) AddMessage(tx *sqlx.Tx, userID int, body string) (Message, error) {
+	message := Message{ThreadID: t.ID, UserID: null.IntFrom(int64(userID)), Body: body}
+
+	if t.Locked { return message, ErrThreadLocked }
+
+	if err := message.Create(tx); err != nil {
+		return message, err
+	}
+
+	_, err := tx.Exec(
+		"UPDATE threads SET last_message_on = $1 WHERE id = $2",
+		message.CreatedOn,
+		t.ID,
+	)
+	if err == nil { t.LastMessageOn = message.CreatedOn }
+
+	return message, err
+}
+
+func (t *Thread) SetLocked(db sqlx.Queryer, locked bool) error {
+	return sqlx.Get(db, t,
+		"UPDATE threads SET locked = $1, updated_on = $2 WHERE id = $3 RETURNING *",
+		locked,
+		time.Now(),
+		t.ID,
+	)
+}
+
+// Delete hides the thread along with its messages. The author can delete
+// their own threads and moderators anyone's.
+func (t *Thread) Delete(db sqlx.Execer, membership StudyGroupMembership) error {
+	if t.UserID.Int64 != int64(membership.UserID) && !membership.CanModerate() {
+		return ErrNotAuthor
+	}
+
+	_, err := db.Exec(
+		"UPDATE threads SET deleted_on = $1 WHERE id = $2",
+		time.Now(),
+		t.ID,
+	)
+
+	return err
+}
@@ -2,13 +2,12 @@ package models
 
 import (
 	"errors"
-	"reflect"
-	"strings"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/jmoiron/sqlx/types"
+	"github.com/prosperoa/study-groups/src/pagination"
 	"github.com/prosperoa/study-groups/src/server"
-	"github.com/prosperoa/study-groups/src/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/guregu/null.v3"
 )
@@ -25,69 +24,24 @@ type User struct {
 	Major2      null.String        `db:"major2"       json:"major2"`
 	Minor       null.String        `db:"minor"        json:"minor"`
 	Courses     types.NullJSONText `db:"courses"      json:"courses"`
-	StudyGroups null.String        `db:"study_groups" json:"-"`
-	Waitlists   null.String        `db:"waitlists"    json:"-"`
 	Password    string             `db:"password"     json:"-"`
 	CreatedOn   string             `db:"created_on"   json:"-"`
 	UpdatedOn   string             `db:"updated_on"   json:"-"`
-}
-
-type Users []User
-
-func (u *User) AddStudyGroupToWaitlists(studyGroupID string) error {
-	studyGroups := strings.Split(u.StudyGroups.String, ",")
-	waitlists := strings.Split(u.Waitlists.String, ",")
 
-	if utils.Contains(waitlists, studyGroupID) {
-		return errors.New("user is already waitlisted")
-	} else if utils.Contains(studyGroups, studyGroupID) {
-		return errors.New("user is already in study group")
-	}
-
-	if u.Waitlists.String == "" {
-		u.Waitlists = null.StringFrom(studyGroupID)
-	} else {
-		waitlists = append(waitlists, studyGroupID)
-		u.Waitlists = null.StringFrom(strings.Join(waitlists, ","))
-	}
+	EmailVerifiedOn    null.Time `db:"email_verified_on"    json:"email_verified_on"`
+	VerificationSentOn null.Time `db:"verification_sent_on" json:"-"`
 
-	return nil
+	CalendarTokenHash null.String `db:"calendar_token_hash" json:"-"`
 }
 
-func (u *User) LeaveStudyGroup(studyGroupID string) (string, null.String, error) {
-	studyGroups := strings.Split(u.StudyGroups.String, ",")
-	waitlists := strings.Split(u.Waitlists.String, ",")
-
-	if !utils.Contains(studyGroups, studyGroupID) && !utils.Contains(waitlists, studyGroupID) {
-		return "", null.String{}, errors.New("user is not waitlisted or a member of study group")
-	}
-
-	var uField *null.String
-	var field *[]string
-	var columnName string
-
-	if utils.Contains(studyGroups, studyGroupID) {
-		uField = &u.StudyGroups
-		field = &studyGroups
-
-		f, _ := reflect.TypeOf(u).Elem().FieldByName("StudyGroups")
-		columnName = f.Tag.Get("db")
-	} else {
-		uField = &u.Waitlists
-		field = &waitlists
-
-		f, _ := reflect.TypeOf(u).Elem().FieldByName("Waitlists")
-		columnName = f.Tag.Get("db")
-	}
+// VerificationResendInterval is how long a user waits before another
+// verification email can be sent to them.
+const VerificationResendInterval = time.Minute * 5
 
-	if len(*field) > 1 {
-		*uField = null.StringFrom(strings.Join(utils.Splice(*field, studyGroupID), ","))
-	} else {
-		*uField = null.String{}
-	}
+type Users []User
 
-	return columnName, *uField, nil
-}
+// UsersSort is the order users are paged in, by ID.
+var UsersSort = pagination.Sort{Name: "id", Key: "id", Type: "integer"}
 
 func (u *User) Get() error {
 	if u.ID == 0 { return errors.New("invalid user id") }
@@ -95,40 +49,57 @@ func (u *User) Get() error {
 	return server.DB.Get(u, "SELECT * FROM users WHERE id = $1", u.ID)
 }
 
-func (u *Users) Get(page, pageSize int) error {
+// Get loads a page of users in ID order, starting after afterID. One user
+// more than pageSize is loaded so callers can tell whether another page
+// follows.
+func (u *Users) Get(afterID, page, pageSize int) error {
 	if page < 0 {	page = 0 }
-	if pageSize < 0 {	pageSize = 30 }
+	if pageSize <= 0 {	pageSize = 30 }
 
-	return server.DB.Select(u, "SELECT * FROM users LIMIT $1 OFFSET $2",
-		pageSize, pageSize * page,
+	return server.DB.Select(u, "SELECT * FROM users WHERE id > $1 ORDER BY id LIMIT $2 OFFSET $3",
+		afterID, pageSize + 1, pageSize * page,
 	)
 }
 
-func (u *User) Delete() error {
-	var passwordHash string
+func CountUsers() (int, error) {
+	var count int
+	err := server.DB.Get(&count, "SELECT count(*) FROM users")
+
+	return count, err
+}
 
+func (u *User) Delete() error {
 	if u.ID == 0 || u.Password == "" {
 		return errors.New("invalid password")
 	}
 
-	err := server.DB.Get(
-   &passwordHash,
-   "SELECT password FROM users WHERE id = $1",
-    u.ID,
-  )
-	if err != nil { return err }
-
-	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(u.Password))
-	if err != nil { return err }
-
-	err = server.DB.Get(
-    u,
-    "DELETE FROM users WHERE id = $1 RETURNING email, avatar",
-    u.ID,
-  )
-	if err != nil { return err }
-
-	return nil
+	return server.Transact(func(tx *sqlx.Tx) error {
+		var passwordHash string
+
+		err := tx.Get(
+			&passwordHash,
+			"SELECT password FROM users WHERE id = $1 FOR UPDATE",
+			u.ID,
+		)
+		if err != nil { return err }
+
+		err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(u.Password))
+		if err != nil { return err }
+
+		// study groups the user owns are handed off before the delete
+		// cascades to their memberships
+		if err = RemoveUserFromStudyGroups(tx, u.ID); err != nil {
+			return err
+		}
+
+		// refresh tokens go with the user through ON DELETE CASCADE, which
+		// revokes every session
+		return tx.Get(
+			u,
+			"DELETE FROM users WHERE id = $1 RETURNING email, avatar",
+			u.ID,
+		)
+	})
 }
 
 // func GetUserStudyGroups(userID string, page, pageSize int) ([]models.StudyGroup, int, error) {
@@ -238,3 +209,81 @@ func (u *User) UpdateCourses() error {
 
 	return err
 }
+
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedOn.Valid
+}
+
+// VerifyEmail marks the address as verified if it's still the user's
+// current email. It reports whether the user was updated.
+func (u *User) VerifyEmail(email string) (bool, error) {
+	result, err := server.DB.Exec(
+	 `UPDATE users SET email_verified_on = $1
+		WHERE id = $2 AND email = $3 AND email_verified_on IS NULL`,
+		time.Now(),
+		u.ID,
+		email,
+	)
+	if err != nil { return false, err }
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// MarkVerificationSent records that a verification email is being sent,
+// unless one was already sent within VerificationResendInterval. It reports
+// whether sending may go ahead.
+func (u *User) MarkVerificationSent() (bool, error) {
+	result, err := server.DB.Exec(
+	 `UPDATE users SET verification_sent_on = $1
+		WHERE id = $2 AND email_verified_on IS NULL
+			AND (verification_sent_on IS NULL OR verification_sent_on < $3)`,
+		time.Now(),
+		u.ID,
+		time.Now().Add(-VerificationResendInterval),
+	)
+	if err != nil { return false, err }
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// CreateCalendarToken gives the user the secret token of their calendar
+// feed the first time it's asked for. Only a hash of it is kept, so once
+// the user has a token it can't be shown again and "" is returned.
+func (u *User) CreateCalendarToken() (string, error) {
+	var created bool
+
+	token, err := server.GenerateRandomToken(32)
+	if err != nil { return "", err }
+
+	err = server.DB.Get(&created,
+	 `UPDATE users SET calendar_token_hash = COALESCE(calendar_token_hash, $1)
+		WHERE id = $2
+		RETURNING calendar_token_hash = $1`,
+		server.HashToken(token),
+		u.ID,
+	)
+	if err != nil || !created { return "", err }
+
+	return token, nil
+}
+
+// ResetCalendarToken replaces the token of the user's calendar feed, which
+// stops the old feed URL from working.
+func (u *User) ResetCalendarToken() (string, error) {
+	token, err := server.GenerateRandomToken(32)
+	if err != nil { return "", err }
+
+	err = server.DB.Get(&u.CalendarTokenHash,
+		"UPDATE users SET calendar_token_hash = $1 WHERE id = $2 RETURNING calendar_token_hash",
+		server.HashToken(token),
+		u.ID,
+	)
+
+	return token, err
+}
+
+func (u *User) GetByCalendarToken(token string) error {
+	return server.DB.Get(u, "SELECT * FROM users WHERE calendar_token_hash = $1", server.HashToken(token))
+}
@@ -0,0 +1,52 @@
+package notifications
+
+import (
+	"log"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pubsub"
+)
+
+// Event types streamed to the members of a study group. Those that are
+// also notifications share their names.
+const (
+	EventMemberJoined      = "member_joined"
+	EventJoinRequested     = models.NotificationJoinRequested
+	EventRequestAccepted   = models.NotificationRequestAccepted
+	EventRequestRejected   = models.NotificationRequestRejected
+	EventMemberLeft        = models.NotificationMemberLeft
+	EventMemberRemoved     = models.NotificationMemberRemoved
+	EventRoleChanged       = models.NotificationRoleChanged
+	EventStudyGroupUpdated = models.NotificationStudyGroupUpdated
+	EventStudyGroupDeleted = models.NotificationStudyGroupDeleted
+	EventSessionChanged    = models.NotificationSessionChanged
+	EventThreadCreated     = "thread_created"
+	EventMessagePosted     = "message_posted"
+	EventMessageEdited     = "message_edited"
+	EventMessageDeleted    = "message_deleted"
+)
+
+// EndsMembership reports whether event means userID can no longer follow
+// the study group it happened in.
+func EndsMembership(event pubsub.Event, userID int) bool {
+	switch event.Type {
+	case EventStudyGroupDeleted:
+		return true
+	case EventMemberLeft, EventMemberRemoved:
+		return event.UserID == userID
+	}
+
+	return false
+}
+
+// publish sends an event to whoever is streaming the study group's
+// updates. userID is the user the event is about, or 0.
+func publish(eventType string, studyGroupID, userID int, data interface{}) {
+	event, err := pubsub.NewEvent(eventType, studyGroupID, userID, data)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	logErr(pubsub.Default.Publish(pubsub.StudyGroupTopic(studyGroupID), event))
+}
@@ -0,0 +1,30 @@
+package notifications
+
+import (
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+	"gopkg.in/guregu/null.v3"
+)
+
+// addToInbox adds a notification to the user's in-app inbox unless they
+// turned in-app notifications of its type off. studyGroupID is 0 when the
+// notification isn't linked to a study group that still exists.
+func addToInbox(userID int, eventType string, studyGroupID int, text string) {
+	var settings models.NotificationSettings
+
+	if err := settings.Get(server.DB, userID); err != nil {
+		logErr(err)
+		return
+	}
+
+	if !settings.SendsInApp(eventType) { return }
+
+	notification := models.Notification{
+		UserID:       userID,
+		Type:         eventType,
+		StudyGroupID: null.NewInt(int64(studyGroupID), studyGroupID != 0),
+		Text:         text,
+	}
+
+	logErr(notification.Create(server.DB))
+}
@@ -0,0 +1,220 @@
+// Package notifications tells the people involved in a study group about
+// what happens to it, by email, in their in-app inbox and through the
+// events streamed to members following it. Failures are logged rather than
+// returned since the action that triggered a notification has already
+// succeeded.
+package notifications
+
+import (
+	"log"
+
+	"github.com/prosperoa/study-groups/src/email-notifications"
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+// MemberJoined tells the members of studyGroup that userID joined it
+// without having to wait on the waitlist.
+func MemberJoined(studyGroup models.StudyGroup, userID int) {
+	publish(EventMemberJoined, studyGroup.ID, userID, nil)
+}
+
+// JoinRequested tells the owners and moderators of studyGroup that userID
+// is waiting on its waitlist.
+func JoinRequested(studyGroup models.StudyGroup, userID int) {
+	publish(EventJoinRequested, studyGroup.ID, userID, nil)
+
+	requester, ok := getUser(userID)
+	if !ok { return }
+
+	managers, err := models.GetStudyGroupManagers(server.DB, studyGroup.ID)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	text := requester.FirstName + " wants to join " + studyGroup.Name
+
+	for _, manager := range managers {
+		addToInbox(manager.ID, EventJoinRequested, studyGroup.ID, text)
+		logErr(emails.JoinRequestNotification(manager, requester, studyGroup))
+	}
+}
+
+// RequestAccepted tells userID they were moved from the waitlist into the
+// members of studyGroup.
+func RequestAccepted(studyGroup models.StudyGroup, userID int) {
+	publish(EventRequestAccepted, studyGroup.ID, userID, nil)
+
+	user, ok := getUser(userID)
+	if !ok { return }
+
+	addToInbox(userID, EventRequestAccepted, studyGroup.ID, "You've been accepted into " + studyGroup.Name)
+	logErr(emails.RequestAcceptedNotification(user, studyGroup))
+}
+
+// MemberLeft tells the owners of studyGroup that userID left it.
+func MemberLeft(studyGroup models.StudyGroup, userID int) {
+	publish(EventMemberLeft, studyGroup.ID, userID, nil)
+
+	member, ok := getUser(userID)
+	if !ok { return }
+
+	text := member.FirstName + " left " + studyGroup.Name
+
+	for _, owner := range getOwners(studyGroup) {
+		addToInbox(owner.ID, EventMemberLeft, studyGroup.ID, text)
+		logErr(emails.MemberLeftNotification(owner, member, studyGroup))
+	}
+}
+
+// RequestRejected tells userID their request to join studyGroup was
+// declined, passing on the owner's message if they left one.
+func RequestRejected(studyGroup models.StudyGroup, userID int, message string) {
+	publish(EventRequestRejected, studyGroup.ID, userID, nil)
+
+	user, ok := getUser(userID)
+	if !ok { return }
+
+	addToInbox(userID, EventRequestRejected, studyGroup.ID, "Your request to join " + studyGroup.Name + " was declined")
+	logErr(emails.RequestRejectedNotification(user, studyGroup, message))
+}
+
+// MemberRemoved tells userID they were removed from studyGroup.
+func MemberRemoved(studyGroup models.StudyGroup, userID int, message string) {
+	publish(EventMemberRemoved, studyGroup.ID, userID, nil)
+
+	user, ok := getUser(userID)
+	if !ok { return }
+
+	addToInbox(userID, EventMemberRemoved, studyGroup.ID, "You were removed from " + studyGroup.Name)
+	logErr(emails.MemberRemovedNotification(user, studyGroup, message))
+}
+
+// RoleChanged tells userID they were given role in studyGroup.
+func RoleChanged(studyGroup models.StudyGroup, userID int, role string) {
+	publish(EventRoleChanged, studyGroup.ID, userID, map[string]string{"role": role})
+
+	user, ok := getUser(userID)
+	if !ok { return }
+
+	addToInbox(userID, EventRoleChanged, studyGroup.ID, "Your role in " + studyGroup.Name + " is now " + role)
+	logErr(emails.RoleChangedNotification(user, studyGroup, role))
+}
+
+// StudyGroupUpdated tells the members of studyGroup its details changed.
+func StudyGroupUpdated(studyGroup models.StudyGroup) {
+	publish(EventStudyGroupUpdated, studyGroup.ID, 0, studyGroup)
+
+	members, err := models.GetStudyGroupUsers(server.DB, studyGroup.ID, models.MembershipStatusActive)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	text := studyGroup.Name + " was updated"
+
+	for _, member := range members {
+		addToInbox(member.ID, EventStudyGroupUpdated, studyGroup.ID, text)
+		logErr(emails.StudyGroupUpdatedNotification(member, studyGroup))
+	}
+}
+
+// SessionChanged tells the members of studyGroup one of its sessions was
+// cancelled or rescheduled.
+func SessionChanged(studyGroup models.StudyGroup, session models.StudyGroupSession) {
+	publish(EventSessionChanged, studyGroup.ID, 0, session)
+
+	members, err := models.GetStudyGroupUsers(server.DB, studyGroup.ID, models.MembershipStatusActive)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	text := studyGroup.Name + " session moved"
+	if session.Status == models.SessionStatusCancelled {
+		text = studyGroup.Name + " session cancelled"
+	}
+
+	for _, member := range members {
+		addToInbox(member.ID, EventSessionChanged, studyGroup.ID, text)
+		logErr(emails.SessionChangedNotification(member, studyGroup, session))
+	}
+}
+
+// MeetingReminder reminds a member of an upcoming meeting of their study
+// group.
+func MeetingReminder(reminder models.MeetingReminder) {
+	user, ok := getUser(reminder.UserID)
+	if !ok { return }
+
+	text := reminder.StudyGroupName + " meets " + reminder.StartsOn.UTC().Format("Mon, Jan 2 at 3:04pm UTC")
+
+	addToInbox(user.ID, models.NotificationMeetingReminder, reminder.StudyGroupID, text)
+	logErr(emails.MeetingReminderNotification(user, reminder.Meeting))
+}
+
+// StudyGroupDeleted tells the former members of studyGroup it was deleted.
+// They have to be looked up before the delete, which removes memberships.
+func StudyGroupDeleted(studyGroup models.StudyGroup, members models.Users) {
+	publish(EventStudyGroupDeleted, studyGroup.ID, 0, nil)
+
+	text := studyGroup.Name + " was deleted"
+
+	for _, member := range members {
+		addToInbox(member.ID, EventStudyGroupDeleted, 0, text)
+		logErr(emails.StudyGroupDeletedNotification(member, studyGroup))
+	}
+}
+
+// ThreadCreated tells the members of the thread's study group about it and
+// its first message.
+func ThreadCreated(thread models.Thread, message models.Message) {
+	data := map[string]interface{}{
+		"thread":  thread,
+		"message": message,
+	}
+
+	publish(EventThreadCreated, thread.StudyGroupID, int(thread.UserID.Int64), data)
+}
+
+// MessagePosted, MessageEdited and MessageDeleted tell the members of the
+// study group about changes to the messages of its threads.
+func MessagePosted(studyGroupID int, message models.Message) {
+	publish(EventMessagePosted, studyGroupID, int(message.UserID.Int64), message)
+}
+
+func MessageEdited(studyGroupID int, message models.Message) {
+	publish(EventMessageEdited, studyGroupID, int(message.UserID.Int64), message)
+}
+
+func MessageDeleted(studyGroupID, threadID, messageID int) {
+	data := map[string]int{
+		"id":        messageID,
+		"thread_id": threadID,
+	}
+
+	publish(EventMessageDeleted, studyGroupID, 0, data)
+}
+
+func getUser(userID int) (models.User, bool) {
+	user := models.User{ID: userID}
+
+	if err := user.Get(); err != nil {
+		log.Println(err.Error())
+		return user, false
+	}
+
+	return user, true
+}
+
+func getOwners(studyGroup models.StudyGroup) models.Users {
+	owners, err := models.GetStudyGroupOwners(server.DB, studyGroup.ID)
+	if err != nil { log.Println(err.Error()) }
+
+	return owners
+}
+
+func logErr(err error) {
+	if err != nil { log.Println(err.Error()) }
+}
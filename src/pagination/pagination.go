@@ -0,0 +1,143 @@
+// Package pagination pages through list endpoints with keyset cursors.
+// A cursor holds the sort key and ID of the last row of a page, and the
+// next page picks up after it, so rows added or removed in between don't
+// shift pages the way offsets do.
+package pagination
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort orders rows by Key, an SQL expression with `?` placeholders for
+// Args, breaking ties by IDColumn. The key of the last row is kept in the
+// cursor as text and cast back to Type, so Key must turn into text and
+// back without losing anything. Type is one of integer, real or timestamp.
+//
+// Cursors are only good for the sort named Name with the same Args, such as
+// the same search for a relevance sort.
+type Sort struct {
+	Name     string
+	Key      string
+	Args     []interface{}
+	Type     string
+	Desc     bool
+	IDColumn string
+}
+
+type Cursor struct {
+	Sort string `json:"s"`
+	Args string `json:"a,omitempty"`
+	Key  string `json:"k"`
+	ID   int    `json:"id"`
+}
+
+// Info tells clients how to get the next page. Total is only counted when
+// asked for.
+type Info struct {
+	NextCursor string
+	HasMore    bool
+	Total      *int
+}
+
+// Encode turns the cursor into an opaque, URL safe string.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Cursor returns the cursor of the row with the given sort key and ID.
+func (s Sort) Cursor(key string, id int) Cursor {
+	return Cursor{Sort: s.Name, Args: s.argsHash(), Key: key, ID: id}
+}
+
+// Decode reads a cursor that Encode made for s. An empty string is no
+// cursor, which starts from the first page. Cursors of other sorts or with
+// a key that isn't a Type are invalid, so they're turned away before they
+// can break the query.
+func (s Sort) Decode(str string) (*Cursor, error) {
+	if str == "" { return nil, nil }
+
+	b, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil { return nil, ErrInvalidCursor }
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != s.Name || c.Args != s.argsHash() || !s.isKey(c.Key) {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// After is the condition selecting the rows that come after the cursor.
+func (s Sort) After(c Cursor) (string, []interface{}) {
+	op := ">"
+	if s.Desc { op = "<" }
+
+	args := append(append([]interface{}{}, s.Args...), c.Key, c.ID)
+
+	return "(" + s.Key + ", " + s.idColumn() + ") " + op + " (?::" + s.Type + ", ?)", args
+}
+
+func (s Sort) OrderBy() (string, []interface{}) {
+	dir := "ASC"
+	if s.Desc { dir = "DESC" }
+
+	return "ORDER BY " + s.Key + " " + dir + ", " + s.idColumn() + " " + dir, s.Args
+}
+
+// Next returns the cursor of the next page and whether there is one. Pages
+// are fetched with one row more than their size; fetched is how many rows
+// came back and last is the cursor of the last row kept.
+func Next(fetched, pageSize int, last Cursor) (string, bool) {
+	if fetched <= pageSize { return "", false }
+
+	return last.Encode(), true
+}
+
+// argsHash tells apart cursors of the same sort with different args, such
+// as relevance sorts for different searches, without putting the search in
+// the cursor.
+func (s Sort) argsHash() string {
+	if len(s.Args) == 0 { return "" }
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", s.Args)))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// isKey reports whether key is the text of a Type, as Postgres writes it.
+func (s Sort) isKey(key string) bool {
+	var err error
+
+	switch s.Type {
+	case "integer":
+		_, err = strconv.ParseInt(key, 10, 32)
+	case "real":
+		_, err = strconv.ParseFloat(key, 32)
+	case "timestamp":
+		if key == "infinity" || key == "-infinity" { return true }
+
+		_, err = time.Parse("2006-01-02 15:04:05.999999", key)
+	default:
+		return false
+	}
+
+	return err == nil
+}
+
+func (s Sort) idColumn() string {
+	if s.IDColumn == "" { return "id" }
+
+	return s.IDColumn
+}
@@ -0,0 +1,157 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+var (
+	byCreated = Sort{Name: "created", Key: "created_on", Type: "timestamp", Desc: true}
+	bySpots   = Sort{Name: "available_spots", Key: "available_spots", Type: "integer", Desc: true}
+	byRank    = Sort{Name: "relevance", Key: "rank(?)", Args: []interface{}{"calc:*"}, Type: "real", Desc: true}
+)
+
+func encodeJSON(json string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(json))
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		sort Sort
+		key  string
+	}{
+		{byCreated, "2024-05-06 17:00:00"},
+		{byCreated, "2024-05-06 17:00:00.123456"},
+		{byCreated, "infinity"},
+		{bySpots, "12"},
+		{bySpots, "-3"},
+		{byRank, "0.0607927"},
+		{byRank, "1e-05"},
+	}
+
+	for _, tt := range tests {
+		want := tt.sort.Cursor(tt.key, 42)
+
+		got, err := tt.sort.Decode(want.Encode())
+		if err != nil {
+			t.Errorf("%s cursor for %q: %v", tt.sort.Name, tt.key, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("decoded %+v, want %+v", *got, want)
+		}
+	}
+
+	if c, err := byCreated.Decode(""); c != nil || err != nil {
+		t.Errorf("Decode(\"\") = %v, %v, want no cursor", c, err)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	otherSearch := byRank
+	otherSearch.Args = []interface{}{"chem:*"}
+
+	tests := []struct {
+		name   string
+		sort   Sort
+		cursor string
+	}{
+		{"cursor of another sort", bySpots, byCreated.Cursor("2024-05-06 17:00:00", 1).Encode()},
+		{"cursor of another search", otherSearch, byRank.Cursor("0.5", 1).Encode()},
+		{"search cursor without a search", Sort{Name: "relevance", Type: "real"}, byRank.Cursor("0.5", 1).Encode()},
+		{"timestamp as an integer", bySpots, bySpots.Cursor("2024-05-06 17:00:00", 1).Encode()},
+		{"integer as a timestamp", byCreated, byCreated.Cursor("12", 1).Encode()},
+		{"edited key", bySpots, bySpots.Cursor("1); DROP TABLE users; --", 1).Encode()},
+		{"overflowing key", bySpots, bySpots.Cursor("99999999999", 1).Encode()},
+		{"text as a real", byRank, byRank.Cursor("high", 1).Encode()},
+		{"unknown type", Sort{Name: "name", Type: "text"}, Sort{Name: "name", Type: "text"}.Cursor("a", 1).Encode()},
+		{"no id", bySpots, bySpots.Cursor("12", 0).Encode()},
+		{"negative id", bySpots, bySpots.Cursor("12", -1).Encode()},
+		{"no sort", bySpots, encodeJSON(`{"k":"12","id":1}`)},
+		{"not JSON", bySpots, encodeJSON("cursor")},
+		{"not base64", bySpots, "not a cursor!"},
+	}
+
+	for _, tt := range tests {
+		if c, err := tt.sort.Decode(tt.cursor); err != ErrInvalidCursor {
+			t.Errorf("%s: Decode = %+v, %v, want ErrInvalidCursor", tt.name, c, err)
+		}
+	}
+}
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		sort     Sort
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			Sort{Key: "created_on", Type: "timestamp"},
+			"(created_on, id) > (?::timestamp, ?)",
+			[]interface{}{"k", 7},
+		},
+		{
+			bySpots,
+			"(available_spots, id) < (?::integer, ?)",
+			[]interface{}{"k", 7},
+		},
+		{
+			byRank,
+			"(rank(?), id) < (?::real, ?)",
+			[]interface{}{"calc:*", "k", 7},
+		},
+		{
+			Sort{Key: "created_on", Type: "timestamp", IDColumn: "m.id"},
+			"(created_on, m.id) > (?::timestamp, ?)",
+			[]interface{}{"k", 7},
+		},
+	}
+
+	for _, tt := range tests {
+		sql, args := tt.sort.After(Cursor{Key: "k", ID: 7})
+
+		if sql != tt.wantSQL { t.Errorf("After() = %q, want %q", sql, tt.wantSQL) }
+
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("After() args = %v, want %v", args, tt.wantArgs)
+		}
+	}
+
+	// the args of the sort aren't shared with the condition
+	_, args := byRank.After(Cursor{Key: "k", ID: 7})
+	args[0] = "changed"
+
+	if byRank.Args[0] != "calc:*" { t.Errorf("After() changed the sort's args") }
+}
+
+func TestNext(t *testing.T) {
+	last := bySpots.Cursor("3", 9)
+
+	tests := []struct {
+		fetched  int
+		pageSize int
+		hasMore  bool
+	}{
+		{0, 10, false},
+		{9, 10, false},
+		{10, 10, false},
+		{11, 10, true},
+	}
+
+	for _, tt := range tests {
+		next, hasMore := Next(tt.fetched, tt.pageSize, last)
+
+		if hasMore != tt.hasMore {
+			t.Errorf("Next(%d, %d) has more = %t, want %t", tt.fetched, tt.pageSize, hasMore, tt.hasMore)
+		}
+
+		want := ""
+		if tt.hasMore { want = last.Encode() }
+
+		if next != want {
+			t.Errorf("Next(%d, %d) = %q, want %q", tt.fetched, tt.pageSize, next, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+import "sync"
+
+// subscriptionBuffer is how many events a subscriber can fall behind
+// before events are dropped for it.
+const subscriptionBuffer = 32
+
+// MemoryBroker delivers events to subscribers in the same process.
+type MemoryBroker struct {
+	mu     sync.RWMutex
+	topics map[string]map[*memorySubscription]struct{}
+}
+
+type memorySubscription struct {
+	broker *MemoryBroker
+	topic  string
+	events chan Event
+	once   sync.Once
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: map[string]map[*memorySubscription]struct{}{},
+	}
+}
+
+func (b *MemoryBroker) Publish(topic string, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.topics[topic] {
+		select {
+		case sub.events <- event:
+		default:
+			// the subscriber is too slow, it misses this event
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string) (Subscription, error) {
+	sub := &memorySubscription{
+		broker: b,
+		topic:  topic,
+		events: make(chan Event, subscriptionBuffer),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.topics[topic] == nil {
+		b.topics[topic] = map[*memorySubscription]struct{}{}
+	}
+
+	b.topics[topic][sub] = struct{}{}
+
+	return sub, nil
+}
+
+func (s *memorySubscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close unsubscribes and closes the events channel. It's safe to call more
+// than once.
+func (s *memorySubscription) Close() {
+	s.once.Do(func() {
+		b := s.broker
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.topics[s.topic], s)
+		if len(b.topics[s.topic]) == 0 { delete(b.topics, s.topic) }
+
+		close(s.events)
+	})
+}
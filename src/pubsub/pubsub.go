@@ -0,0 +1,55 @@
+// Package pubsub passes events about study groups from the handlers that
+// cause them to the clients streaming them. The Broker interface hides
+// where events travel through, so the in-process broker can be swapped for
+// one backed by Postgres LISTEN/NOTIFY once the API runs on several dynos.
+package pubsub
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Default is the broker the API publishes to and subscribes from.
+var Default Broker = NewMemoryBroker()
+
+// Event is something that happened in a study group. UserID is the user
+// the event is about, if any. Data is kept as JSON so events look the same
+// whether they went through memory or the database.
+type Event struct {
+	Type         string          `json:"type"`
+	StudyGroupID int             `json:"study_group_id"`
+	UserID       int             `json:"user_id,omitempty"`
+	Data         json.RawMessage `json:"data,omitempty"`
+}
+
+type Broker interface {
+	Publish(topic string, event Event) error
+	Subscribe(topic string) (Subscription, error)
+}
+
+// Subscription delivers the events published to a topic until it's
+// closed. Events are dropped for subscribers that fall too far behind
+// rather than holding up the publisher.
+type Subscription interface {
+	Events() <-chan Event
+	Close()
+}
+
+func NewEvent(eventType string, studyGroupID, userID int, data interface{}) (Event, error) {
+	event := Event{
+		Type:         eventType,
+		StudyGroupID: studyGroupID,
+		UserID:       userID,
+	}
+
+	if data == nil { return event, nil }
+
+	var err error
+	event.Data, err = json.Marshal(data)
+
+	return event, err
+}
+
+func StudyGroupTopic(studyGroupID int) string {
+	return "study_group:" + strconv.Itoa(studyGroupID)
+}
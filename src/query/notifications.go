@@ -0,0 +1,17 @@
+package query
+
+import "github.com/prosperoa/study-groups/src/pagination"
+
+// NotificationsSort lists notifications newest first.
+var NotificationsSort = pagination.Sort{Name: "newest", Key: "id", Type: "integer", Desc: true}
+
+// Notifications builds the list of the user's notifications, leaving out
+// the ones already read when unreadOnly is set. Each row comes with the
+// text of its sort key as sort_key, like the study group search.
+func Notifications(userID int, unreadOnly bool) *Builder {
+	q := New("SELECT *, id::text AS sort_key FROM notifications WHERE user_id = ?", userID)
+
+	if unreadOnly { q.Where("read_on IS NULL") }
+
+	return q
+}
@@ -0,0 +1,72 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prosperoa/study-groups/src/pagination"
+)
+
+// Builder assembles a SQL statement out of fragments written with `?`
+// placeholders. Values are only ever kept as bind arguments, never
+// formatted into the statement, so user input can't change the query.
+type Builder struct {
+	parts []string
+	args  []interface{}
+}
+
+func New(base string, args ...interface{}) *Builder {
+	return &Builder{
+		parts: []string{base},
+		args:  args,
+	}
+}
+
+// Where appends an AND condition to the statement.
+func (b *Builder) Where(condition string, args ...interface{}) *Builder {
+	return b.Append("AND "+condition, args...)
+}
+
+func (b *Builder) Append(fragment string, args ...interface{}) *Builder {
+	b.parts = append(b.parts, fragment)
+	b.args = append(b.args, args...)
+
+	return b
+}
+
+// Paginate orders the statement by sort and limits it to a page. Pages
+// start after cursor when there is one and pageIndex pages in otherwise.
+// One row more than pageSize is fetched so pagination.Next can tell
+// whether another page follows. It has to be appended last.
+func (b *Builder) Paginate(sort pagination.Sort, cursor *pagination.Cursor, pageSize, pageIndex int) *Builder {
+	offset := pageSize * pageIndex
+
+	if cursor != nil {
+		condition, args := sort.After(*cursor)
+		b.Where(condition, args...)
+		offset = 0
+	}
+
+	orderBy, args := sort.OrderBy()
+	b.Append(orderBy, args...)
+
+	return b.Append("LIMIT ? OFFSET ?", pageSize + 1, offset)
+}
+
+// Count builds a statement counting the rows of b, which mustn't be
+// paginated yet.
+func (b *Builder) Count() *Builder {
+	return New(
+		"SELECT count(*) FROM (" + strings.Join(b.parts, " ") + ") counted",
+		append([]interface{}{}, b.args...)...,
+	)
+}
+
+// SQL returns the statement with its placeholders numbered for Postgres.
+func (b *Builder) SQL() string {
+	return sqlx.Rebind(sqlx.DOLLAR, strings.Join(b.parts, " "))
+}
+
+func (b *Builder) Args() []interface{} {
+	return b.args
+}
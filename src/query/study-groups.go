@@ -0,0 +1,150 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
+)
+
+const (
+	SortRelevance      = "relevance"
+	SortMeetingDate    = "meeting_date"
+	SortCreated        = "created"
+	SortAvailableSpots = "available_spots"
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+// searchDocument and searchText have to be written exactly as in the
+// expression indexes of migration 019 for Postgres to use them.
+const (
+	searchDocument = "study_group_document(name, description, location, course::text)"
+	searchText     = "study_group_search_text(name, location, course::text)"
+)
+
+// nextMeeting is when the study group next meets, out of its sessions,
+// schedule and meeting date, or infinity when it has no upcoming meetings.
+// Meetings are stored in UTC.
+const nextMeeting = `COALESCE((
+	SELECT min(m.starts_on) FROM meetings m
+	WHERE m.study_group_id = study_groups.id AND m.starts_on >= now() AT TIME ZONE 'UTC'
+), 'infinity')`
+
+// course is stored as JSON in a varchar column, so it has to be cast before
+// its fields can be read, the same way the functions of migration 019 do.
+const courseJSON = "nullif(course, '')::json"
+
+// StudyGroupSort returns the order the search is sorted in: by relevance
+// when there's a q param and by creation, newest first, otherwise. Groups
+// can also be sorted by their next meeting, soonest first with groups that
+// have none last, or by available spots, most first.
+func StudyGroupSort(filter models.StudyGroupsFilter) (pagination.Sort, error) {
+	name := filter.Sort
+
+	if name == "" && filter.Q != "" { name = SortRelevance }
+
+	switch name {
+	case SortRelevance:
+		if filter.Q == "" { break }
+
+		return pagination.Sort{
+			Name: SortRelevance,
+			Key:  "(ts_rank(" + searchDocument + ", to_tsquery('english', ?)) + word_similarity(?, " + searchText + "))",
+			Args: []interface{}{prefixQuery(filter.Q), filter.Q},
+			Type: "real",
+			Desc: true,
+		}, nil
+	case SortMeetingDate:
+		return pagination.Sort{Name: SortMeetingDate, Key: nextMeeting, Type: "timestamp"}, nil
+	case "", SortCreated:
+		return pagination.Sort{Name: SortCreated, Key: "created_on", Type: "timestamp", Desc: true}, nil
+	case SortAvailableSpots:
+		return pagination.Sort{Name: SortAvailableSpots, Key: "available_spots", Type: "integer", Desc: true}, nil
+	}
+
+	return pagination.Sort{}, ErrInvalidSort
+}
+
+// StudyGroups builds the study group search for userID, leaving out the
+// groups they own or already belong to. Only public groups can be found.
+// Each row comes with the text of its sort key as sort_key, for cursors;
+// the search is left for Paginate to order and limit.
+//
+// The q param is matched against the full text of the group and, to catch
+// typos, by trigram similarity against its name, location and course. Text
+// filters are matched by trigram similarity so partial words still match.
+func StudyGroups(filter models.StudyGroupsFilter, userID int, sort pagination.Sort) *Builder {
+	q := New(
+		"SELECT *, " + sort.Key + "::text AS sort_key FROM study_groups WHERE visibility = ? AND user_id != ? AND available_spots >= ?",
+		append(append([]interface{}{}, sort.Args...),
+			models.VisibilityPublic,
+			userID,
+			filter.AvailableSpots,
+		)...,
+	)
+
+	q.Where(`NOT EXISTS(
+		SELECT 1 FROM study_group_memberships
+		WHERE study_group_id = study_groups.id AND user_id = ?
+	)`, userID)
+
+	if filter.Q != "" {
+		q.Where("(" + searchDocument + " @@ to_tsquery('english', ?) OR ? <% " + searchText + ")",
+			prefixQuery(filter.Q),
+			filter.Q,
+		)
+	}
+
+	if filter.StudyGroupName != "" {
+		q.Where("? <% name", filter.StudyGroupName)
+	}
+
+	if filter.Location != "" {
+		q.Where("? <% location", filter.Location)
+	}
+
+	// groups with a schedule match on any of their expanded meetings
+	if filter.MeetingDate != "" {
+		date := strings.Split(filter.MeetingDate, "T")[0]
+		q.Where(`(meeting_date::date = ? OR EXISTS(
+			SELECT 1 FROM study_group_occurrences
+			WHERE study_group_id = study_groups.id AND local_date = ?
+		))`, date, date)
+	}
+
+	if filter.CourseCode != "" {
+		q.Where("? <% (" + courseJSON + " ->> 'code')", filter.CourseCode)
+	}
+
+	if filter.CourseName != "" {
+		q.Where("? <% (" + courseJSON + " ->> 'name')", filter.CourseName)
+	}
+
+	if filter.Instructor != "" {
+		q.Where("? <% (" + courseJSON + " ->> 'instructor')", filter.Instructor)
+	}
+
+	if filter.Term != "" {
+		q.Where("? <% (" + courseJSON + " ->> 'term')", filter.Term)
+	}
+
+	return q
+}
+
+// prefixQuery turns what the user typed into a tsquery matching every word
+// as a prefix, so "calc" finds "Calculus". Only letters and digits are kept,
+// which leaves no tsquery syntax for input to break.
+func prefixQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
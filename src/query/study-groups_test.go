@@ -0,0 +1,147 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
+)
+
+var hostileInputs = []string{
+	"x' OR '1'='1",
+	"x'; DROP TABLE users; --",
+	"x\"; DELETE FROM study_groups; /*",
+	"x -- comment",
+	"x $1 ? $$ :name",
+	`x\'; SELECT pg_sleep(10); --`,
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+func hostileFilter(input string) models.StudyGroupsFilter {
+	return models.StudyGroupsFilter{
+		PageFilter:     models.PageFilter{BaseFilter: models.BaseFilter{PageIndex: 1, PageSize: 10}},
+		Q:              input,
+		StudyGroupName: input,
+		Location:       input,
+		MeetingDate:    input,
+		CourseCode:     input,
+		CourseName:     input,
+		Instructor:     input,
+		Term:           input,
+		AvailableSpots: 1,
+	}
+}
+
+// checkBound fails unless every input is left out of the statement and
+// bound as an argument instead, with a placeholder for each argument.
+func checkBound(t *testing.T, q *Builder, inputs ...string) {
+	t.Helper()
+
+	sql := q.SQL()
+
+	for _, input := range inputs {
+		if strings.Contains(sql, input) {
+			t.Errorf("input %q made it into the statement:\n%s", input, sql)
+		}
+
+		found := false
+		for _, arg := range q.Args() {
+			if arg == input { found = true }
+		}
+
+		if !found { t.Errorf("input %q isn't bound as an argument", input) }
+	}
+
+	if strings.Contains(sql, "?") {
+		t.Errorf("statement has unnumbered placeholders:\n%s", sql)
+	}
+
+	matches := placeholder.FindAllStringSubmatch(sql, -1)
+	if len(matches) != len(q.Args()) {
+		t.Errorf("%d placeholders for %d args:\n%s", len(matches), len(q.Args()), sql)
+	}
+}
+
+func TestStudyGroupsBindsFilters(t *testing.T) {
+	for _, input := range hostileInputs {
+		filter := hostileFilter(input)
+
+		for _, name := range []string{SortRelevance, SortMeetingDate, SortCreated, SortAvailableSpots} {
+			filter.Sort = name
+
+			sort, err := StudyGroupSort(filter)
+			if err != nil { t.Fatalf("sort %s: %v", name, err) }
+
+			q := StudyGroups(filter, 1, sort)
+
+			// the date is cut at its time, which is the part that's bound
+			checkBound(t, q, input, strings.Split(input, "T")[0])
+		}
+	}
+}
+
+func TestStudyGroupsBindsCursor(t *testing.T) {
+	for _, input := range hostileInputs {
+		filter := hostileFilter("calculus")
+
+		sort, err := StudyGroupSort(filter)
+		if err != nil { t.Fatal(err) }
+
+		q := StudyGroups(filter, 1, sort)
+		q.Paginate(sort, &pagination.Cursor{Key: input, ID: 7}, filter.PageSize, filter.PageIndex)
+
+		checkBound(t, q, input)
+	}
+}
+
+func TestStudyGroupsCountBindsFilters(t *testing.T) {
+	for _, input := range hostileInputs {
+		filter := hostileFilter(input)
+
+		sort, err := StudyGroupSort(filter)
+		if err != nil { t.Fatal(err) }
+
+		checkBound(t, StudyGroups(filter, 1, sort).Count(), input)
+	}
+}
+
+func TestStudyGroupSortRejectsUnknownSorts(t *testing.T) {
+	for _, input := range append(hostileInputs, "name", "relevance DESC") {
+		filter := hostileFilter("calculus")
+		filter.Sort = input
+
+		if _, err := StudyGroupSort(filter); err != ErrInvalidSort {
+			t.Errorf("sort %q: got %v, want ErrInvalidSort", input, err)
+		}
+	}
+
+	// relevance needs something to be relevant to
+	if _, err := StudyGroupSort(models.StudyGroupsFilter{Sort: SortRelevance}); err != ErrInvalidSort {
+		t.Errorf("relevance without q: got %v, want ErrInvalidSort", err)
+	}
+}
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"calc", "calc:*"},
+		{"Linear Algebra", "linear:* & algebra:*"},
+		{"  CS-101  ", "cs:* & 101:*"},
+		{"x' | !y & (z) <-> w:*", "x:* & y:* & z:* & w:*"},
+		{"'; DROP TABLE users; --", "drop:* & table:* & users:*"},
+		{"Über Mathématiques", "über:* & mathématiques:*"},
+		{"!!! --- ;;;", ""},
+	}
+
+	for _, tt := range tests {
+		if got := prefixQuery(tt.text); got != tt.want {
+			t.Errorf("prefixQuery(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package query
+
+import (
+	"github.com/prosperoa/study-groups/src/models"
+	"github.com/prosperoa/study-groups/src/pagination"
+)
+
+// ThreadsSort lists threads the most recently active first.
+var ThreadsSort = pagination.Sort{Name: "last_message", Key: "last_message_on", Type: "timestamp", Desc: true}
+
+// MessagesSort lists the messages of a thread oldest first.
+var MessagesSort = pagination.Sort{Name: "oldest", Key: "id", Type: "integer"}
+
+// Threads builds the list of the study group's threads that weren't
+// deleted.
+func Threads(studyGroupID int) *Builder {
+	return New(
+		"SELECT *, last_message_on::text AS sort_key FROM threads WHERE study_group_id = ? AND deleted_on IS NULL",
+		studyGroupID,
+	)
+}
+
+// Messages builds the list of the thread's messages, deleted ones included
+// as placeholders.
+func Messages(threadID int) *Builder {
+	return New("SELECT " + models.MessageColumns + ", id::text AS sort_key FROM messages WHERE thread_id = ?", threadID)
+}
@@ -0,0 +1,188 @@
+// Package recurrence expands recurring meeting schedules. It supports the
+// part of RFC 5545 recurrence rules study groups need: daily, weekly and
+// monthly rules with an interval, the days of the week for weekly rules,
+// an end given by UNTIL or COUNT, and exception dates.
+package recurrence
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+const (
+	untilFormat    = "20060102T150405Z"
+	floatingFormat = "20060102T150405"
+	dateFormat     = "20060102"
+)
+
+var (
+	ErrInvalidRule     = errors.New("invalid recurrence rule")
+	ErrUnsupportedRule = errors.New("unsupported recurrence rule")
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Rule is a parsed RRULE. A zero Until and Count means the rule repeats
+// forever.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	Until    time.Time
+	Count    int
+}
+
+// Parse parses an RRULE such as "FREQ=WEEKLY;BYDAY=TU,TH;UNTIL=20241213".
+// UNTIL values without a time zone are read as UTC.
+func Parse(s string) (Rule, error) {
+	return ParseInLocation(s, time.UTC)
+}
+
+// ParseInLocation is like Parse but reads UNTIL values without a time zone
+// in loc, the time zone of the schedule the rule belongs to. A date-only
+// UNTIL includes the whole day.
+func ParseInLocation(s string, loc *time.Location) (Rule, error) {
+	rule := Rule{Interval: 1}
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" { return rule, ErrInvalidRule }
+
+	for _, part := range strings.Split(s, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" { return rule, ErrInvalidRule }
+
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+
+		switch key {
+		case "FREQ":
+			rule.Freq = Frequency(value)
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+			if err == nil && rule.Interval < 1 { err = ErrInvalidRule }
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+			if err == nil && rule.Count < 1 { err = ErrInvalidRule }
+		case "UNTIL":
+			rule.Until, err = parseUntil(value, loc)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(value)
+		case "WKST":
+			// weeks always start on Monday, the RFC 5545 default
+			if value != "MO" { err = ErrUnsupportedRule }
+		default:
+			err = ErrUnsupportedRule
+		}
+
+		if err == ErrUnsupportedRule { return rule, err }
+		if err != nil { return rule, ErrInvalidRule }
+	}
+
+	switch {
+	case rule.Freq != Daily && rule.Freq != Weekly && rule.Freq != Monthly:
+		return rule, ErrUnsupportedRule
+	case len(rule.ByDay) > 0 && rule.Freq != Weekly:
+		return rule, ErrUnsupportedRule
+	case rule.Count > 0 && !rule.Until.IsZero():
+		// RFC 5545 doesn't allow both
+		return rule, ErrInvalidRule
+	}
+
+	return rule, nil
+}
+
+// String formats the rule back into an RRULE, with UNTIL in UTC.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL=" + strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+
+		for i, day := range r.ByDay {
+			days[i] = strings.ToUpper(day.String()[:2])
+		}
+
+		parts = append(parts, "BYDAY=" + strings.Join(days, ","))
+	}
+
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL=" + r.Until.UTC().Format(untilFormat))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT=" + strconv.Itoa(r.Count))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(untilFormat, value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation(floatingFormat, value, loc); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation(dateFormat, value, loc)
+	if err != nil { return t, err }
+
+	return t.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// parseByDay parses a list of weekdays like "TU,TH" into Monday first
+// order. Ordinal days such as "1MO" aren't supported.
+func parseByDay(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	seen := map[time.Weekday]bool{}
+
+	for _, code := range strings.Split(value, ",") {
+		day, ok := weekdays[code]
+
+		switch {
+		case !ok && len(code) > 2:
+			return nil, ErrUnsupportedRule
+		case !ok:
+			return nil, ErrInvalidRule
+		case seen[day]:
+			continue
+		}
+
+		seen[day] = true
+		days = append(days, day)
+	}
+
+	sort.Slice(days, func(i, j int) bool {
+		return daysFromMonday(days[i]) < daysFromMonday(days[j])
+	})
+
+	return days, nil
+}
+
+func daysFromMonday(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
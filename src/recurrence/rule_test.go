@@ -0,0 +1,127 @@
+package recurrence
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil { t.Fatal(err) }
+
+	return loc
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rrule string
+		want  Rule
+	}{
+		{"FREQ=DAILY", Rule{Freq: Daily, Interval: 1}},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2", Rule{Freq: Weekly, Interval: 2}},
+		{"freq=weekly;byday=th,tu,th", Rule{Freq: Weekly, Interval: 1, ByDay: []time.Weekday{time.Tuesday, time.Thursday}}},
+		{"FREQ=WEEKLY;BYDAY=SU,MO;WKST=MO", Rule{Freq: Weekly, Interval: 1, ByDay: []time.Weekday{time.Monday, time.Sunday}}},
+		{"FREQ=MONTHLY;COUNT=6", Rule{Freq: Monthly, Interval: 1, Count: 6}},
+		{"FREQ=DAILY;UNTIL=20241213T170000Z", Rule{Freq: Daily, Interval: 1, Until: time.Date(2024, 12, 13, 17, 0, 0, 0, time.UTC)}},
+		{"FREQ=DAILY;UNTIL=20241213", Rule{Freq: Daily, Interval: 1, Until: time.Date(2024, 12, 13, 23, 59, 59, 0, time.UTC)}},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.rrule)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.rrule, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.rrule, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		rrule string
+		err   error
+	}{
+		{"", ErrInvalidRule},
+		{"FREQ", ErrInvalidRule},
+		{"FREQ=", ErrInvalidRule},
+		{"FREQ=DAILY;INTERVAL=0", ErrInvalidRule},
+		{"FREQ=DAILY;INTERVAL=x", ErrInvalidRule},
+		{"FREQ=DAILY;COUNT=0", ErrInvalidRule},
+		{"FREQ=DAILY;UNTIL=tomorrow", ErrInvalidRule},
+		{"FREQ=DAILY;COUNT=3;UNTIL=20241213", ErrInvalidRule},
+		{"FREQ=WEEKLY;BYDAY=XX", ErrInvalidRule},
+		{"FREQ=YEARLY", ErrUnsupportedRule},
+		{"FREQ=HOURLY", ErrUnsupportedRule},
+		{"FREQ=DAILY;BYDAY=MO", ErrUnsupportedRule},
+		{"FREQ=WEEKLY;BYDAY=1MO", ErrUnsupportedRule},
+		{"FREQ=WEEKLY;WKST=SU", ErrUnsupportedRule},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", ErrUnsupportedRule},
+		{"FREQ=MONTHLY;BYSETPOS=-1", ErrUnsupportedRule},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.rrule); err != tt.err {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.rrule, err, tt.err)
+		}
+	}
+}
+
+// UNTIL values without a time zone are read in the schedule's time zone,
+// and a date-only UNTIL ends with the last second of that local day, even
+// on days that are 23 or 25 hours long.
+func TestParseInLocationUntilAcrossDST(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+
+	tests := []struct {
+		until string
+		want  time.Time
+	}{
+		// spring forward: the day is 23 hours long
+		{"20240310", time.Date(2024, 3, 11, 3, 59, 59, 0, time.UTC)},
+		// fall back: the day is 25 hours long
+		{"20241103", time.Date(2024, 11, 4, 4, 59, 59, 0, time.UTC)},
+		// local times either side of the changes
+		{"20240309T180000", time.Date(2024, 3, 9, 23, 0, 0, 0, time.UTC)},
+		{"20240310T180000", time.Date(2024, 3, 10, 22, 0, 0, 0, time.UTC)},
+		{"20241102T180000", time.Date(2024, 11, 2, 22, 0, 0, 0, time.UTC)},
+		{"20241103T180000", time.Date(2024, 11, 3, 23, 0, 0, 0, time.UTC)},
+		// UTC values ignore the location
+		{"20240310T120000Z", time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseInLocation("FREQ=DAILY;UNTIL=" + tt.until, newYork)
+		if err != nil {
+			t.Errorf("UNTIL=%s: %v", tt.until, err)
+			continue
+		}
+
+		if !rule.Until.Equal(tt.want) {
+			t.Errorf("UNTIL=%s = %s, want %s", tt.until, rule.Until.UTC(), tt.want)
+		}
+	}
+}
+
+func TestRuleString(t *testing.T) {
+	tests := []string{
+		"FREQ=DAILY",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE,SU",
+		"FREQ=MONTHLY;UNTIL=20241213T170000Z",
+		"FREQ=WEEKLY;BYDAY=TU;COUNT=10",
+	}
+
+	for _, rrule := range tests {
+		rule, err := Parse(rrule)
+		if err != nil { t.Fatalf("Parse(%q): %v", rrule, err) }
+
+		if got := rule.String(); got != rrule {
+			t.Errorf("String() = %q, want %q", got, rrule)
+		}
+	}
+}
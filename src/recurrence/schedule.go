@@ -0,0 +1,114 @@
+package recurrence
+
+import "time"
+
+// maxPeriods bounds the expansion of rules that never end, which would
+// otherwise loop forever when nothing falls in the window asked for.
+const maxPeriods = 10000
+
+// Schedule is a meeting starting at Start and, if Rule is set, repeating
+// by it. Occurrences keep the wall clock time of Start in its location, so
+// a 6pm meeting stays at 6pm across daylight saving changes. Occurrences
+// falling on one of the ExDates are skipped; only the date of each
+// exception is looked at.
+type Schedule struct {
+	Start   time.Time
+	Rule    *Rule
+	ExDates []time.Time
+}
+
+// Between returns the occurrences of the schedule starting at or after
+// from and before to.
+func (s Schedule) Between(from, to time.Time) []time.Time {
+	var occurrences []time.Time
+
+	s.each(func(t time.Time) bool {
+		if !t.Before(to) { return false }
+
+		if !t.Before(from) && !s.isException(t) {
+			occurrences = append(occurrences, t)
+		}
+
+		return true
+	})
+
+	return occurrences
+}
+
+// each calls fn with every occurrence in order until fn returns false or
+// the rule ends. Exceptions are still passed to fn since, as in RFC 5545,
+// they count towards COUNT.
+func (s Schedule) each(fn func(time.Time) bool) {
+	if s.Rule == nil {
+		fn(s.Start)
+		return
+	}
+
+	rule := *s.Rule
+	if rule.Interval < 1 { rule.Interval = 1 }
+
+	count := 0
+
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range s.period(rule, period * rule.Interval) {
+			switch {
+			case t.Before(s.Start):
+				continue
+			case !rule.Until.IsZero() && t.After(rule.Until):
+				return
+			case rule.Count > 0 && count >= rule.Count:
+				return
+			}
+
+			count++
+			if !fn(t) { return }
+		}
+	}
+}
+
+// period returns the candidate occurrences n days, weeks or months after
+// the start.
+func (s Schedule) period(rule Rule, n int) []time.Time {
+	start := s.Start
+	year, month, day := start.Date()
+	hour, min, sec := start.Clock()
+	loc := start.Location()
+
+	switch rule.Freq {
+	case Daily:
+		return []time.Time{time.Date(year, month, day + n, hour, min, sec, 0, loc)}
+
+	case Monthly:
+		t := time.Date(year, month + time.Month(n), day, hour, min, sec, 0, loc)
+
+		// months without the day, like the 31st in April, are skipped
+		if t.Day() != day { return nil }
+
+		return []time.Time{t}
+	}
+
+	days := rule.ByDay
+	if len(days) == 0 { days = []time.Weekday{start.Weekday()} }
+
+	monday := day - daysFromMonday(start.Weekday()) + n * 7
+	occurrences := make([]time.Time, len(days))
+
+	for i, weekday := range days {
+		occurrences[i] = time.Date(
+			year, month, monday + daysFromMonday(weekday), hour, min, sec, 0, loc,
+		)
+	}
+
+	return occurrences
+}
+
+func (s Schedule) isException(t time.Time) bool {
+	year, month, day := t.Date()
+
+	for _, exDate := range s.ExDates {
+		y, m, d := exDate.Date()
+		if y == year && m == month && d == day { return true }
+	}
+
+	return false
+}
@@ -0,0 +1,235 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, rrule string, loc *time.Location) *Rule {
+	t.Helper()
+
+	rule, err := ParseInLocation(rrule, loc)
+	if err != nil { t.Fatalf("ParseInLocation(%q): %v", rrule, err) }
+
+	return &rule
+}
+
+func checkOccurrences(t *testing.T, got, want []time.Time) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d occurrences, want %d:\n%v", len(got), len(want), got)
+	}
+
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("occurrence %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+var (
+	from = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	to   = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Meetings keep their local time across daylight saving changes, so their
+// UTC time moves instead.
+func TestBetweenKeepsWallClockAcrossDST(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+
+	tests := []struct {
+		name  string
+		start time.Time
+		rrule string
+		want  []time.Time
+	}{
+		{
+			"weekly over spring forward",
+			time.Date(2024, 3, 4, 18, 0, 0, 0, newYork),
+			"FREQ=WEEKLY;COUNT=3",
+			[]time.Time{
+				time.Date(2024, 3, 4, 23, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 11, 22, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 18, 22, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			"daily over fall back",
+			time.Date(2024, 11, 2, 9, 30, 0, 0, newYork),
+			"FREQ=DAILY;COUNT=3",
+			[]time.Time{
+				time.Date(2024, 11, 2, 13, 30, 0, 0, time.UTC),
+				time.Date(2024, 11, 3, 14, 30, 0, 0, time.UTC),
+				time.Date(2024, 11, 4, 14, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			// the local UNTIL day is 23 hours long and its meeting is kept
+			"daily until the day clocks spring forward",
+			time.Date(2024, 3, 8, 20, 0, 0, 0, newYork),
+			"FREQ=DAILY;UNTIL=20240310",
+			[]time.Time{
+				time.Date(2024, 3, 9, 1, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 10, 1, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Schedule{Start: tt.start, Rule: mustParse(t, tt.rrule, newYork)}
+			got := s.Between(from, to)
+
+			checkOccurrences(t, got, tt.want)
+
+			for _, occurrence := range got {
+				hour, min, _ := occurrence.Clock()
+				startHour, startMin, _ := tt.start.Clock()
+
+				if hour != startHour || min != startMin {
+					t.Errorf("%s isn't at %02d:%02d local time", occurrence, startHour, startMin)
+				}
+			}
+		})
+	}
+}
+
+// Exceptions count towards COUNT, as in RFC 5545, so they shorten the
+// schedule rather than pushing its end back.
+func TestBetweenCountWithExDates(t *testing.T) {
+	start := time.Date(2024, 5, 6, 17, 0, 0, 0, time.UTC)
+
+	s := Schedule{
+		Start: start,
+		Rule:  mustParse(t, "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", time.UTC),
+		ExDates: []time.Time{
+			time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC),
+			// not an occurrence, so it changes nothing
+			time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	checkOccurrences(t, s.Between(from, to), []time.Time{
+		time.Date(2024, 5, 6, 17, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 13, 17, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 15, 17, 0, 0, 0, time.UTC),
+	})
+}
+
+// Only the date of an exception matters, in the time zone of the exception.
+func TestBetweenExDateMatchesLocalDate(t *testing.T) {
+	tokyo := mustLoad(t, "Asia/Tokyo")
+
+	s := Schedule{
+		Start:   time.Date(2024, 5, 6, 8, 0, 0, 0, tokyo),
+		Rule:    mustParse(t, "FREQ=DAILY;COUNT=3", tokyo),
+		ExDates: []time.Time{time.Date(2024, 5, 7, 0, 0, 0, 0, tokyo)},
+	}
+
+	checkOccurrences(t, s.Between(from, to), []time.Time{
+		time.Date(2024, 5, 6, 8, 0, 0, 0, tokyo),
+		time.Date(2024, 5, 8, 8, 0, 0, 0, tokyo),
+	})
+}
+
+// Monthly rules repeat on the day of the start. Months too short for it
+// are skipped rather than moved to their last day. BYMONTHDAY isn't
+// supported, see TestParseErrors.
+func TestBetweenMonthlySkipsShortMonths(t *testing.T) {
+	s := Schedule{
+		Start: time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC),
+		Rule:  mustParse(t, "FREQ=MONTHLY;COUNT=5", time.UTC),
+	}
+
+	checkOccurrences(t, s.Between(from, to), []time.Time{
+		time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 31, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 7, 31, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 8, 31, 18, 0, 0, 0, time.UTC),
+	})
+
+	leap := Schedule{
+		Start: time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC),
+		Rule:  mustParse(t, "FREQ=MONTHLY;INTERVAL=12;COUNT=2", time.UTC),
+	}
+
+	checkOccurrences(t, leap.Between(from, to), []time.Time{
+		time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC),
+		time.Date(2028, 2, 29, 18, 0, 0, 0, time.UTC),
+	})
+}
+
+func TestBetweenUntilIsInclusive(t *testing.T) {
+	start := time.Date(2024, 5, 6, 17, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		until string
+		want  int
+	}{
+		{"20240508T170000Z", 3},
+		{"20240508T165959Z", 2},
+		{"20240508T170001Z", 3},
+		{"20240508", 3},
+		{"20240506T170000Z", 1},
+		{"20240506T165959Z", 0},
+	}
+
+	for _, tt := range tests {
+		s := Schedule{Start: start, Rule: mustParse(t, "FREQ=DAILY;UNTIL=" + tt.until, time.UTC)}
+
+		if got := len(s.Between(from, to)); got != tt.want {
+			t.Errorf("UNTIL=%s: %d occurrences, want %d", tt.until, got, tt.want)
+		}
+	}
+}
+
+func TestBetweenWindow(t *testing.T) {
+	s := Schedule{
+		Start: time.Date(2024, 5, 6, 17, 0, 0, 0, time.UTC),
+		Rule:  mustParse(t, "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", time.UTC),
+	}
+
+	// from is inclusive and to exclusive
+	checkOccurrences(t, s.Between(
+		time.Date(2024, 5, 10, 17, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 24, 17, 0, 0, 0, time.UTC),
+	), []time.Time{
+		time.Date(2024, 5, 10, 17, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 20, 17, 0, 0, 0, time.UTC),
+	})
+}
+
+// A rule that never ends is only expanded for maxPeriods periods, so a
+// window past them comes back empty instead of looping forever.
+func TestBetweenStopsAfterMaxPeriods(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := Schedule{Start: start, Rule: mustParse(t, "FREQ=DAILY", time.UTC)}
+
+	last := start.AddDate(0, 0, maxPeriods - 1)
+
+	all := s.Between(start, last.AddDate(1, 0, 0))
+	if len(all) != maxPeriods {
+		t.Errorf("got %d occurrences, want %d", len(all), maxPeriods)
+	}
+
+	if len(all) > 0 && !all[len(all) - 1].Equal(last) {
+		t.Errorf("last occurrence = %s, want %s", all[len(all) - 1], last)
+	}
+
+	if got := s.Between(last.AddDate(0, 0, 1), last.AddDate(100, 0, 0)); len(got) != 0 {
+		t.Errorf("got %d occurrences past maxPeriods", len(got))
+	}
+}
+
+func TestBetweenWithoutRule(t *testing.T) {
+	start := time.Date(2024, 5, 6, 17, 0, 0, 0, time.UTC)
+
+	checkOccurrences(t, Schedule{Start: start}.Between(from, to), []time.Time{start})
+
+	if got := (Schedule{Start: start}).Between(start.Add(time.Second), to); len(got) != 0 {
+		t.Errorf("got %v after the only meeting", got)
+	}
+}
@@ -1,6 +1,10 @@
 package server
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"os"
 	"time"
@@ -15,6 +19,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"github.com/prosperoa/study-groups/src/pagination"
 	"gopkg.in/go-playground/validator.v9"
 )
 
@@ -25,12 +30,29 @@ var (
 	Validate   = validator.New()
 
 	JWTSigningKey = []byte(os.Getenv("JWT_SIGNING_TOKEN"))
+
+	// EmailTokenSigningKey signs the tokens in email links. It's kept apart
+	// from JWTSigningKey so they can never pass for auth tokens.
+	EmailTokenSigningKey = emailTokenSigningKey()
+
+	// APIURL is where the API is served from, used for links handed out to
+	// other apps such as calendar feeds
+	APIURL = os.Getenv("API_URL")
+
+	// ClientURL is where the app is served from, used for links to its pages
+	// such as invite links
+	ClientURL = os.Getenv("CLIENT_URL")
 )
 
 const (
 	AWSRegion   = "us-west-1"
 	S3Bucket    = "study-groups"
 	S3BucketURL = "https://study-groups.s3.us-west-1.amazonaws.com/"
+
+	AuthTokenTTL    = time.Minute * 15
+	RefreshTokenTTL = time.Hour * 24 * 30
+
+	EmailVerificationTTL = time.Hour * 24 * 7
 )
 
 func InitServer() error {
@@ -72,12 +94,13 @@ func InitServer() error {
 	return nil
 }
 
-func GenerateAuthToken(userID string) (string, error) {
+func GenerateAuthToken(userID, sessionID string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := make(jwt.MapClaims)
 
 	claims["user_id"] = userID
-	claims["exp"] = time.Now().Add(time.Hour * 730).Unix() // ~ 1 month
+	claims["sid"] = sessionID
+	claims["exp"] = time.Now().Add(AuthTokenTTL).Unix()
 	claims["iat"] = time.Now().Unix()
 
 	token.Claims = claims
@@ -90,6 +113,137 @@ func GenerateAuthToken(userID string) (string, error) {
 	return tokenString, nil
 }
 
+// GenerateEmailVerificationToken signs the link sent to confirm a user's
+// email address. The address is part of the token so the link stops
+// working if the user's email changes.
+func GenerateEmailVerificationToken(userID, email string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := make(jwt.MapClaims)
+
+	claims["purpose"] = "verify_email"
+	claims["user_id"] = userID
+	claims["email"] = email
+	claims["exp"] = time.Now().Add(EmailVerificationTTL).Unix()
+	claims["iat"] = time.Now().Unix()
+
+	token.Claims = claims
+	tokenString, err := token.SignedString(EmailTokenSigningKey)
+
+	if err != nil {
+		return tokenString, errors.New("error while signing verification token")
+	}
+
+	return tokenString, nil
+}
+
+func ParseEmailVerificationToken(t string) (userID, email string, err error) {
+	errMsg := errors.New("invalid verification token")
+
+	token, err := jwt.Parse(t, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errMsg
+		}
+
+		return EmailTokenSigningKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return "", "", errMsg
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	if claims["purpose"] != "verify_email" {
+		return "", "", errMsg
+	}
+
+	userID, _ = claims["user_id"].(string)
+	email, _ = claims["email"].(string)
+
+	return userID, email, nil
+}
+
+// GenerateUnsubscribeToken signs the user's request to stop receiving
+// emails of notificationType. It doesn't expire so links in old emails keep
+// working.
+func GenerateUnsubscribeToken(userID, notificationType string) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := make(jwt.MapClaims)
+
+	claims["purpose"] = "unsubscribe"
+	claims["user_id"] = userID
+	claims["type"] = notificationType
+	claims["iat"] = time.Now().Unix()
+
+	token.Claims = claims
+	tokenString, err := token.SignedString(EmailTokenSigningKey)
+
+	if err != nil {
+		return tokenString, errors.New("error while signing unsubscribe token")
+	}
+
+	return tokenString, nil
+}
+
+func ParseUnsubscribeToken(t string) (userID, notificationType string, err error) {
+	errMsg := errors.New("invalid unsubscribe token")
+
+	token, err := jwt.Parse(t, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errMsg
+		}
+
+		return EmailTokenSigningKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return "", "", errMsg
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	if claims["purpose"] != "unsubscribe" {
+		return "", "", errMsg
+	}
+
+	userID, _ = claims["user_id"].(string)
+	notificationType, _ = claims["type"].(string)
+
+	return userID, notificationType, nil
+}
+
+// emailTokenSigningKey returns EMAIL_TOKEN_SIGNING_KEY or, when it isn't
+// set, a key derived from JWTSigningKey.
+func emailTokenSigningKey() []byte {
+	if key := os.Getenv("EMAIL_TOKEN_SIGNING_KEY"); key != "" {
+		return []byte(key)
+	}
+
+	mac := hmac.New(sha256.New, JWTSigningKey)
+	mac.Write([]byte("email tokens"))
+
+	return mac.Sum(nil)
+}
+
+// GenerateRandomToken returns n random bytes, hex encoded. It's used for
+// refresh tokens and session IDs, which are opaque to clients.
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken is used to store secrets such as refresh tokens so that a
+// database leak doesn't hand out working credentials.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func ValidateEmail(email string) (errMsg error) {
 	errMsg = errors.New("invalid email address")
 
@@ -110,6 +264,23 @@ func ValidateEmail(email string) (errMsg error) {
 }
 
 func Respond(c *gin.Context, data interface{}, message string, httpStatus int) {
+	c.JSON(httpStatus, envelope(data, message, httpStatus))
+}
+
+// RespondPage is Respond for a page of a list, telling the client where the
+// next page starts and, when it was counted, how many items there are.
+func RespondPage(c *gin.Context, data interface{}, page pagination.Info, message string, httpStatus int) {
+	body := envelope(data, message, httpStatus)
+	body["has_more"] = page.HasMore
+	body["next_cursor"] = nil
+
+	if page.HasMore { body["next_cursor"] = page.NextCursor }
+	if page.Total != nil { body["total"] = *page.Total }
+
+	c.JSON(httpStatus, body)
+}
+
+func envelope(data interface{}, message string, httpStatus int) map[string]interface{} {
 	var success bool
 
 	// HTTP Status Code >= 400 indicates error
@@ -119,13 +290,10 @@ func Respond(c *gin.Context, data interface{}, message string, httpStatus int) {
 		success = false
 	}
 
-	c.JSON(
-		httpStatus,
-		map[string]interface{}{
-			"data":    data,
-			"status":  httpStatus,
-			"message": message,
-			"success": success,
-		},
-	)
+	return map[string]interface{}{
+		"data":    data,
+		"status":  httpStatus,
+		"message": message,
+		"success": success,
+	}
 }
@@ -0,0 +1,29 @@
+package server
+
+import "github.com/jmoiron/sqlx"
+
+// Transact runs fn inside a transaction. The transaction is committed when
+// fn returns nil and rolled back when it returns an error or panics; a
+// failed commit is returned like any other error.
+func Transact(fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	return fn(tx)
+}
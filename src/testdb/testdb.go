@@ -0,0 +1,37 @@
+// Package testdb connects tests that need Postgres to the database named
+// by TEST_DATABASE_URL, which has to be migrated with db/migrations. Tests
+// using it are skipped when the variable isn't set.
+package testdb
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/prosperoa/study-groups/src/server"
+)
+
+// Open points server.DB at the test database, skipping t if there isn't
+// one. The tables given are emptied first.
+func Open(t *testing.T, tables ...string) *sqlx.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" { t.Skip("TEST_DATABASE_URL isn't set") }
+
+	if server.DB == nil {
+		db, err := sqlx.Connect("postgres", url)
+		if err != nil { t.Fatal(err) }
+
+		server.DB = db
+	}
+
+	if len(tables) > 0 {
+		_, err := server.DB.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE")
+		if err != nil { t.Fatal(err) }
+	}
+
+	return server.DB
+}